@@ -0,0 +1,306 @@
+package rawtx
+
+import (
+	"errors"
+	"math"
+)
+
+// Default upper bounds of the histogram buckets used by NewStatsAggregator.
+var (
+	// DefaultVSizeBounds are the vsize bucket bounds in vbytes.
+	DefaultVSizeBounds = []float64{100, 150, 200, 250, 300, 400, 500, 750, 1000, 2000, 5000, 10000, 50000, 100000}
+	// DefaultFeeRateBounds are the feerate bucket bounds in sat/vbyte.
+	DefaultFeeRateBounds = []float64{1, 2, 3, 4, 5, 6, 8, 10, 12, 15, 20, 30, 40, 50, 75, 100, 150, 200, 300, 500, 1000}
+	// DefaultOpReturnSizeBounds are the bucket bounds of the OP_RETURN data
+	// size in bytes.
+	DefaultOpReturnSizeBounds = []float64{0, 8, 20, 32, 40, 64, 80, 160, 1000, 10000}
+)
+
+// ErrHistogramBoundsMismatch is returned when merging histograms with
+// different bucket bounds.
+var ErrHistogramBoundsMismatch = errors.New("histogram bucket bounds don't match")
+
+// Histogram counts values in buckets. A value v is counted in the first bucket
+// i with v <= Bounds[i]. Values larger than the last bound are counted in an
+// extra overflow bucket, so there is one more count than bounds.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+	Min    float64
+	Max    float64
+}
+
+// NewHistogram returns an empty histogram with the bucket bounds, which must
+// be sorted in ascending order.
+func NewHistogram(bounds []float64) *Histogram {
+	b := make([]float64, len(bounds))
+	copy(b, bounds)
+	return &Histogram{Bounds: b, Counts: make([]uint64, len(bounds)+1)}
+}
+
+// Add counts the value.
+func (h *Histogram) Add(v float64) {
+	i := 0
+	for i < len(h.Bounds) && v > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if h.Count == 0 || v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// Merge adds the counts of the other histogram. Both histograms must have the
+// same bucket bounds.
+func (h *Histogram) Merge(other *Histogram) error {
+	if !h.hasSameBounds(other) {
+		return ErrHistogramBoundsMismatch
+	}
+	if other.Count == 0 {
+		return nil
+	}
+
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if h.Count == 0 || other.Max > h.Max {
+		h.Max = other.Max
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+func (h *Histogram) hasSameBounds(other *Histogram) bool {
+	if len(h.Bounds) != len(other.Bounds) {
+		return false
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Mean returns the mean of the counted values. NaN is returned if no values
+// were counted.
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return math.NaN()
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Percentile returns an estimate of the p-th percentile (0 to 100) of the
+// counted values by linear interpolation inside the bucket the percentile
+// falls into. NaN is returned if no values were counted.
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.Count == 0 {
+		return math.NaN()
+	}
+	rank := p / 100 * float64(h.Count)
+	var cumulative float64
+	for i, count := range h.Counts {
+		if count == 0 || cumulative+float64(count) < rank {
+			cumulative += float64(count)
+			continue
+		}
+		lower, upper := h.Min, h.Max
+		if i > 0 && h.Bounds[i-1] > lower {
+			lower = h.Bounds[i-1]
+		}
+		if i < len(h.Bounds) && h.Bounds[i] < upper {
+			upper = h.Bounds[i]
+		}
+		return lower + (upper-lower)*(rank-cumulative)/float64(count)
+	}
+	return h.Max
+}
+
+// SignatureAggregate counts signatures and their properties.
+type SignatureAggregate struct {
+	Count     uint64
+	ECDSA     uint64
+	StrictDER uint64 // ECDSA only
+	LowR      uint64 // ECDSA only
+	LowS      uint64 // ECDSA only
+	SigHashes map[byte]uint64
+}
+
+// StrictDERRatio returns the share of ECDSA signatures that are strict DER
+// encoded.
+func (s *SignatureAggregate) StrictDERRatio() float64 {
+	return ratio(s.StrictDER, s.ECDSA)
+}
+
+// LowRRatio returns the share of ECDSA signatures with a low R value.
+func (s *SignatureAggregate) LowRRatio() float64 {
+	return ratio(s.LowR, s.ECDSA)
+}
+
+// LowSRatio returns the share of ECDSA signatures with a low S value.
+func (s *SignatureAggregate) LowSRatio() float64 {
+	return ratio(s.LowS, s.ECDSA)
+}
+
+func ratio(count, total uint64) float64 {
+	if total == 0 {
+		return math.NaN()
+	}
+	return float64(count) / float64(total)
+}
+
+// StatsAggregator aggregates TxStats of many transactions. The state of
+// aggregators filled in parallel can be combined with Merge. The zero value
+// is ready to use with the default histogram bucket bounds like the
+// aggregator returned by NewStatsAggregator. A StatsAggregator is not safe
+// for concurrent use.
+type StatsAggregator struct {
+	Transactions           uint64
+	Coinbases              uint64
+	Inputs                 uint64
+	Outputs                uint64
+	OutAmount              int64
+	Fees                   int64
+	TxnsWithFee            uint64
+	SpendingSegWit         uint64
+	SpendingTaproot        uint64
+	ExplicitlyRBFSignaling uint64
+	BIP69Compliant         uint64
+	InputTypes             map[InputType]uint64
+	OutputTypes            map[OutputType]uint64
+	VSize                  *Histogram
+	FeeRate                *Histogram // sat/vbyte, only transactions with a known fee
+	OpReturnSize           *Histogram // size of the OP_RETURN data in bytes
+	Signatures             SignatureAggregate
+}
+
+// NewStatsAggregator returns an empty StatsAggregator with the default
+// histogram bucket bounds.
+func NewStatsAggregator() *StatsAggregator {
+	a := &StatsAggregator{}
+	a.init()
+	return a
+}
+
+// init sets the maps and histograms of a zero value StatsAggregator.
+func (a *StatsAggregator) init() {
+	if a.InputTypes == nil {
+		a.InputTypes = make(map[InputType]uint64)
+	}
+	if a.OutputTypes == nil {
+		a.OutputTypes = make(map[OutputType]uint64)
+	}
+	if a.VSize == nil {
+		a.VSize = NewHistogram(DefaultVSizeBounds)
+	}
+	if a.FeeRate == nil {
+		a.FeeRate = NewHistogram(DefaultFeeRateBounds)
+	}
+	if a.OpReturnSize == nil {
+		a.OpReturnSize = NewHistogram(DefaultOpReturnSizeBounds)
+	}
+	if a.Signatures.SigHashes == nil {
+		a.Signatures.SigHashes = make(map[byte]uint64)
+	}
+}
+
+// Add aggregates the stats of a transaction.
+func (a *StatsAggregator) Add(stats *TxStats) {
+	a.init()
+	a.Transactions++
+	a.OutAmount += stats.OutAmount
+	a.VSize.Add(float64(stats.VSize))
+	if stats.HasFee {
+		a.TxnsWithFee++
+		a.Fees += stats.Fee
+		a.FeeRate.Add(float64(stats.Fee) / float64(stats.VSize))
+	}
+	a.Coinbases += boolToCount(stats.IsCoinbase)
+	a.SpendingSegWit += boolToCount(stats.IsSpendingSegWit)
+	a.SpendingTaproot += boolToCount(stats.IsSpendingTaproot)
+	a.ExplicitlyRBFSignaling += boolToCount(stats.IsExplicitlyRBFSignaling)
+	a.BIP69Compliant += boolToCount(stats.IsBIP69Compliant)
+
+	for _, in := range stats.InStats {
+		a.Inputs++
+		a.InputTypes[in.Type]++
+		for _, sig := range in.SigStats {
+			a.Signatures.Count++
+			a.Signatures.SigHashes[sig.SigHash]++
+			if sig.IsECDSA {
+				a.Signatures.ECDSA++
+				a.Signatures.StrictDER += boolToCount(sig.IsStrictDER)
+				a.Signatures.LowR += boolToCount(sig.HasLowR)
+				a.Signatures.LowS += boolToCount(sig.HasLowS)
+			}
+		}
+	}
+
+	for _, out := range stats.OutStats {
+		a.Outputs++
+		a.OutputTypes[out.Type]++
+		if out.Type == OutOPRETURN {
+			a.OpReturnSize.Add(float64(len(out.OpReturnData)))
+		}
+	}
+}
+
+// Merge adds the state of the other aggregator. The histograms of both
+// aggregators must have the same bucket bounds, otherwise nothing is merged.
+func (a *StatsAggregator) Merge(other *StatsAggregator) error {
+	a.init()
+	other.init()
+	if !a.VSize.hasSameBounds(other.VSize) || !a.FeeRate.hasSameBounds(other.FeeRate) || !a.OpReturnSize.hasSameBounds(other.OpReturnSize) {
+		return ErrHistogramBoundsMismatch
+	}
+	a.VSize.Merge(other.VSize)
+	a.FeeRate.Merge(other.FeeRate)
+	a.OpReturnSize.Merge(other.OpReturnSize)
+
+	a.Transactions += other.Transactions
+	a.Coinbases += other.Coinbases
+	a.Inputs += other.Inputs
+	a.Outputs += other.Outputs
+	a.OutAmount += other.OutAmount
+	a.Fees += other.Fees
+	a.TxnsWithFee += other.TxnsWithFee
+	a.SpendingSegWit += other.SpendingSegWit
+	a.SpendingTaproot += other.SpendingTaproot
+	a.ExplicitlyRBFSignaling += other.ExplicitlyRBFSignaling
+	a.BIP69Compliant += other.BIP69Compliant
+	for inputType, count := range other.InputTypes {
+		a.InputTypes[inputType] += count
+	}
+	for outputType, count := range other.OutputTypes {
+		a.OutputTypes[outputType] += count
+	}
+
+	a.Signatures.Count += other.Signatures.Count
+	a.Signatures.ECDSA += other.Signatures.ECDSA
+	a.Signatures.StrictDER += other.Signatures.StrictDER
+	a.Signatures.LowR += other.Signatures.LowR
+	a.Signatures.LowS += other.Signatures.LowS
+	for sigHash, count := range other.Signatures.SigHashes {
+		a.Signatures.SigHashes[sigHash] += count
+	}
+	return nil
+}
+
+func boolToCount(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
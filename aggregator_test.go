@@ -0,0 +1,182 @@
+package rawtx
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 10, 100})
+	for _, v := range []float64{0.5, 1, 2, 10, 50, 99, 1000} {
+		h.Add(v)
+	}
+
+	expectedCounts := []uint64{2, 2, 2, 1}
+	if !reflect.DeepEqual(h.Counts, expectedCounts) {
+		t.Errorf("Expected the counts %v, but got %v", expectedCounts, h.Counts)
+	}
+	if h.Count != 7 || h.Min != 0.5 || h.Max != 1000 || h.Sum != 1162.5 {
+		t.Errorf("Expected count 7, min 0.5, max 1000 and sum 1162.5, but got %+v", h)
+	}
+	if mean := h.Mean(); mean != 1162.5/7 {
+		t.Errorf("Expected the mean %f, but got %f", 1162.5/7, mean)
+	}
+
+	// the median is the 3.5th value, three quarters into the bucket (1, 10]
+	if median := h.Percentile(50); median != 7.75 {
+		t.Errorf("Expected the median 7.75, but got %f", median)
+	}
+	if p0 := h.Percentile(0); p0 != 0.5 {
+		t.Errorf("Expected the 0th percentile to be the minimum, but got %f", p0)
+	}
+	if p100 := h.Percentile(100); p100 != 1000 {
+		t.Errorf("Expected the 100th percentile to be the maximum, but got %f", p100)
+	}
+
+	empty := NewHistogram([]float64{1, 10, 100})
+	if !math.IsNaN(empty.Mean()) || !math.IsNaN(empty.Percentile(50)) {
+		t.Error("Expected NaN for the mean and percentiles of an empty histogram")
+	}
+
+	merged := NewHistogram([]float64{1, 10, 100})
+	merged.Add(5000)
+	if err := merged.Merge(h); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(merged.Counts, []uint64{2, 2, 2, 2}) || merged.Count != 8 || merged.Min != 0.5 || merged.Max != 5000 {
+		t.Errorf("Expected the merged histogram to contain both, but got %+v", merged)
+	}
+	if err := merged.Merge(empty); err != nil || merged.Min != 0.5 {
+		t.Errorf("Expected merging an empty histogram to change nothing, but got %+v (%v)", merged, err)
+	}
+
+	if err := h.Merge(NewHistogram([]float64{1, 10})); err != ErrHistogramBoundsMismatch {
+		t.Errorf("Expected ErrHistogramBoundsMismatch, but got %v", err)
+	}
+	if err := h.Merge(NewHistogram([]float64{1, 10, 101})); err != ErrHistogramBoundsMismatch {
+		t.Errorf("Expected ErrHistogramBoundsMismatch, but got %v", err)
+	}
+}
+
+func TestStatsAggregator(t *testing.T) {
+	testTxns := GetTestTransactions()
+	all := NewStatsAggregator()
+	shards := []*StatsAggregator{NewStatsAggregator(), NewStatsAggregator(), NewStatsAggregator()}
+
+	var inputs, outputs, opReturns uint64
+	for i, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+		inputs += uint64(len(tx.Inputs))
+		outputs += uint64(len(tx.Outputs))
+		for _, outputType := range testTx.OutputTypes {
+			if outputType == OutOPRETURN {
+				opReturns++
+			}
+		}
+
+		stats := tx.Stats()
+		all.Add(stats)
+		shards[i%len(shards)].Add(stats)
+	}
+
+	if all.Transactions != uint64(len(testTxns)) || all.Inputs != inputs || all.Outputs != outputs {
+		t.Errorf("Expected %d transactions, %d inputs and %d outputs, but got %d, %d and %d", len(testTxns), inputs, outputs, all.Transactions, all.Inputs, all.Outputs)
+	}
+	if all.VSize.Count != all.Transactions || all.OpReturnSize.Count != opReturns || all.OutputTypes[OutOPRETURN] != opReturns {
+		t.Errorf("Expected %d vsizes and %d OP_RETURN sizes, but got %d and %d", all.Transactions, opReturns, all.VSize.Count, all.OpReturnSize.Count)
+	}
+
+	var inputTypeSum uint64
+	for _, count := range all.InputTypes {
+		inputTypeSum += count
+	}
+	var sigHashSum uint64
+	for _, count := range all.Signatures.SigHashes {
+		sigHashSum += count
+	}
+	if inputTypeSum != all.Inputs || sigHashSum != all.Signatures.Count {
+		t.Errorf("Expected the input types to sum up to %d and the sighashes to %d, but got %d and %d", all.Inputs, all.Signatures.Count, inputTypeSum, sigHashSum)
+	}
+	if all.Signatures.ECDSA == 0 || all.Signatures.LowSRatio() <= 0 || all.Signatures.LowSRatio() > 1 {
+		t.Errorf("Expected ECDSA signatures with a low-S ratio in (0, 1], but got %+v", all.Signatures)
+	}
+
+	// the transactions in the testdata have no prevouts
+	if all.TxnsWithFee != 0 || all.FeeRate.Count != 0 {
+		t.Errorf("Expected no transactions with fee, but got %d", all.TxnsWithFee)
+	}
+
+	merged := NewStatsAggregator()
+	for _, shard := range shards {
+		if err := merged.Merge(shard); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if !reflect.DeepEqual(merged, all) {
+		t.Errorf("Expected the merged shards to equal the aggregate of all transactions, but got %+v and %+v", merged, all)
+	}
+
+	// the state can be stored as JSON and merged after loading it again
+	b, err := json.Marshal(all)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	loaded := NewStatsAggregator()
+	if err := json.Unmarshal(b, loaded); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(loaded, all) {
+		t.Errorf("Expected the aggregator to round-trip through JSON, but got %+v", loaded)
+	}
+
+	different := NewStatsAggregator()
+	different.FeeRate = NewHistogram([]float64{1, 2})
+	if err := all.Merge(different); err != ErrHistogramBoundsMismatch || all.Transactions != uint64(len(testTxns)) {
+		t.Errorf("Expected ErrHistogramBoundsMismatch without merging anything, but got %v", err)
+	}
+}
+
+func TestStatsAggregatorFeeRate(t *testing.T) {
+	tx, err := StringToTx(GetTestTransactions()[0].RawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	prevoutValue := (tx.GetOutputSum() + 2610) / int64(len(tx.Inputs))
+	for i := range tx.Inputs {
+		tx.Inputs[i].Prevout = &Output{Value: prevoutValue}
+	}
+	fee, _ := tx.GetFee()
+
+	a := NewStatsAggregator()
+	a.Add(tx.Stats())
+	if a.TxnsWithFee != 1 || a.Fees != fee {
+		t.Errorf("Expected one transaction with a fee of %d, but got %d with %d", fee, a.TxnsWithFee, a.Fees)
+	}
+	expectedFeeRate := float64(fee) / float64(tx.GetSizeWithoutWitness())
+	if a.FeeRate.Count != 1 || a.FeeRate.Min != expectedFeeRate {
+		t.Errorf("Expected a feerate of %f, but got %+v", expectedFeeRate, a.FeeRate)
+	}
+}
+
+func TestStatsAggregatorZeroValue(t *testing.T) {
+	tx, err := StringToTx(GetTestTransactions()[0].RawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var a, b, empty StatsAggregator
+	a.Add(tx.Stats())
+	if err := b.Merge(&a); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := b.Merge(&empty); err != nil {
+		t.Fatal(err.Error())
+	}
+	if b.Transactions != 1 || b.VSize.Count != 1 || b.Inputs != uint64(len(tx.Inputs)) {
+		t.Errorf("Expected the zero value aggregators to be merged, but got %+v", b)
+	}
+}
@@ -0,0 +1,320 @@
+package rawtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sigHashTypeStringMap maps the defined signature hash types to the names
+// Bitcoin Core uses in ASM.
+var sigHashTypeStringMap = map[byte]string{
+	0x01: "ALL",
+	0x02: "NONE",
+	0x03: "SINGLE",
+	0x81: "ALL|ANYONECANPAY",
+	0x82: "NONE|ANYONECANPAY",
+	0x83: "SINGLE|ANYONECANPAY",
+}
+
+// coreOpName returns the name Bitcoin Core uses for a non-push opcode in ASM.
+func coreOpName(opCode OpCode) string {
+	switch {
+	case opCode == Op1NEGATE:
+		return "-1"
+	case opCode >= Op1 && opCode <= Op16:
+		return strconv.Itoa(int(opCode-Op1) + 1)
+	case opCode == OpCHECKSIGADD:
+		return "OP_CHECKSIGADD"
+	case opCode > OpCHECKSIGADD && opCode < OpINVALIDOPCODE:
+		return "OP_UNKNOWN"
+	}
+	return OpCodeStringMap[opCode]
+}
+
+// nextScriptOp reads the next opcode and the pushed data from the start of the
+// script like GetScriptOp() in Bitcoin Core. False is returned if a data push
+// reaches past the end of the script.
+func nextScriptOp(s BitcoinScript) (opCode OpCode, data []byte, remainder BitcoinScript, ok bool) {
+	opCode = OpCode(s[0])
+	s = s[1:]
+	if opCode > OpPUSHDATA4 {
+		return opCode, nil, s, true
+	}
+
+	var length int
+	switch opCode {
+	case OpPUSHDATA1:
+		if len(s) < 1 {
+			return opCode, nil, nil, false
+		}
+		length, s = int(s[0]), s[1:]
+	case OpPUSHDATA2:
+		if len(s) < 2 {
+			return opCode, nil, nil, false
+		}
+		length, s = int(binary.LittleEndian.Uint16(s)), s[2:]
+	case OpPUSHDATA4:
+		if len(s) < 4 {
+			return opCode, nil, nil, false
+		}
+		length64 := uint64(binary.LittleEndian.Uint32(s))
+		if length64 > uint64(len(s)-4) {
+			return opCode, nil, nil, false
+		}
+		length, s = int(length64), s[4:]
+	default:
+		length = int(opCode)
+	}
+
+	if length > len(s) {
+		return opCode, nil, nil, false
+	}
+	return opCode, s[:length], s[length:], true
+}
+
+// ASM formats the script as ASM like ScriptToAsmStr() in Bitcoin Core.
+// Pushes of up to four bytes are shown as numbers. If attemptSighashDecode is
+// set, the sighash type of strictly encoded signatures is decoded, e.g.
+// `3044...01` is shown as `3044...[ALL]`. Bitcoin Core only does this for
+// scriptSigs.
+func (s BitcoinScript) ASM(attemptSighashDecode bool) string {
+	var sb strings.Builder
+	unspendable := s.IsUnspendable()
+	for remainder := s; len(remainder) > 0; {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+
+		opCode, data, rest, ok := nextScriptOp(remainder)
+		if !ok {
+			sb.WriteString("[error]")
+			break
+		}
+		remainder = rest
+
+		if opCode > OpPUSHDATA4 {
+			sb.WriteString(coreOpName(opCode))
+			continue
+		}
+
+		if len(data) <= 4 {
+			sb.WriteString(strconv.FormatInt(decodeScriptNum(data), 10))
+			continue
+		}
+
+		if attemptSighashDecode && !unspendable && isStrictlyEncodedSignature(data) {
+			sb.WriteString(hex.EncodeToString(data[:len(data)-1]))
+			sb.WriteString("[" + sigHashTypeStringMap[data[len(data)-1]] + "]")
+			continue
+		}
+		sb.WriteString(hex.EncodeToString(data))
+	}
+	return sb.String()
+}
+
+// isStrictlyEncodedSignature checks if the signature including the sighash
+// byte is a strict DER signature as defined in BIP66 with a defined sighash
+// type. This mirrors Bitcoin Core's CheckSignatureEncoding() with the
+// SCRIPT_VERIFY_STRICTENC flag.
+func isStrictlyEncodedSignature(sig []byte) bool {
+	if _, defined := sigHashTypeStringMap[sig[len(sig)-1]]; !defined {
+		return false
+	}
+	return isValidSignatureEncoding(sig)
+}
+
+// isValidSignatureEncoding implements the IsValidSignatureEncoding() function
+// from BIP66 for a signature including the sighash byte.
+func isValidSignatureEncoding(sig []byte) bool {
+	if len(sig) < 9 || len(sig) > 73 {
+		return false
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+	lenR := int(sig[3])
+	if 5+lenR >= len(sig) {
+		return false
+	}
+	lenS := int(sig[5+lenR])
+	if lenR+lenS+7 != len(sig) {
+		return false
+	}
+	if sig[2] != 0x02 || lenR == 0 || sig[4]&0x80 != 0 {
+		return false
+	}
+	if lenR > 1 && sig[4] == 0x00 && sig[5]&0x80 == 0 {
+		return false
+	}
+	if sig[lenR+4] != 0x02 || lenS == 0 || sig[lenR+6]&0x80 != 0 {
+		return false
+	}
+	if lenS > 1 && sig[lenR+6] == 0x00 && sig[lenR+7]&0x80 == 0 {
+		return false
+	}
+	return true
+}
+
+// asmOpCodeMap maps the opcode names accepted by ParseASM to the opcodes.
+var asmOpCodeMap = newASMOpCodeMap()
+
+func newASMOpCodeMap() map[string]OpCode {
+	m := map[string]OpCode{"OP_0": Op0, "OP_FALSE": Op0, "OP_TRUE": Op1}
+	for opCode := OpPUSHDATA4 + 1; ; opCode++ {
+		names := []string{OpCodeStringMap[opCode]}
+		if name := coreOpName(opCode); strings.HasPrefix(name, "OP_") && name != "OP_UNKNOWN" {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			m[name] = opCode
+			m[strings.TrimPrefix(name, "OP_")] = opCode
+		}
+		if opCode == OpINVALIDOPCODE {
+			return m
+		}
+	}
+}
+
+// ParseASM parses a script in the ASM notation used by Bitcoin Core back into
+// a BitcoinScript. It accepts the output of ASM():
+//   - opcode names with or without the `OP_` prefix, e.g. `OP_DUP` or `DUP`
+//   - decimal numbers that fit into four byte script numbers, e.g. `0`, `-1`
+//     or `520`. These are pushed with OP_0, OP_1NEGATE, OP_1 to OP_16 or as
+//     minimally encoded script numbers. ASM never shows numbers with leading
+//     zeros, so `0102030405` is read as hex encoded data.
+//   - hex encoded data which is pushed with the smallest possible push
+//     opcode. A decoded sighash type suffix like `[ALL]` is encoded back into
+//     the last byte.
+//
+// Like ParseScript() in Bitcoin Core, `0x` prefixed hex is inserted into the
+// script as is and strings in single quotes are pushed. As ASM doesn't record
+// how data was pushed, non-minimal pushes don't round-trip.
+func ParseASM(asm string) (BitcoinScript, error) {
+	var s BitcoinScript
+	for _, token := range strings.Fields(asm) {
+		if opCode, ok := asmOpCodeMap[token]; ok {
+			s = append(s, byte(opCode))
+			continue
+		}
+
+		if n, ok := parseASMNumber(token); ok {
+			s = appendScriptNum(s, n)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(token, "0x"):
+			raw, err := hex.DecodeString(token[2:])
+			if err != nil || len(raw) == 0 {
+				return nil, fmt.Errorf("invalid hex %q in ASM", token)
+			}
+			s = append(s, raw...)
+		case len(token) >= 2 && strings.HasPrefix(token, "'") && strings.HasSuffix(token, "'"):
+			s = appendDataPush(s, []byte(token[1:len(token)-1]))
+		default:
+			data, err := parseASMData(token)
+			if err != nil {
+				return nil, err
+			}
+			s = appendDataPush(s, data)
+		}
+	}
+	return s, nil
+}
+
+// parseASMNumber parses a decimal token as a number. Tokens with leading zeros
+// and numbers that don't fit into four byte script numbers are hex encoded
+// data.
+func parseASMNumber(token string) (int64, bool) {
+	digits := strings.TrimPrefix(token, "-")
+	if len(digits) > 1 && digits[0] == '0' {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || n < -0x7fffffff || n > 0x7fffffff {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseASMData decodes a hex encoded data push with an optional sighash type
+// suffix.
+func parseASMData(token string) ([]byte, error) {
+	hexData, sigHashName := token, ""
+	if i := strings.IndexByte(token, '['); i >= 0 && strings.HasSuffix(token, "]") {
+		hexData, sigHashName = token[:i], token[i+1:len(token)-1]
+	}
+
+	data, err := hex.DecodeString(hexData)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid token %q in ASM", token)
+	}
+	if sigHashName == "" {
+		return data, nil
+	}
+	for sigHashType, name := range sigHashTypeStringMap {
+		if name == sigHashName {
+			return append(data, sigHashType), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown sighash type %q in ASM", sigHashName)
+}
+
+// appendScriptNum appends a push of the number n to the script like
+// CScript::push_int64() in Bitcoin Core.
+func appendScriptNum(s BitcoinScript, n int64) BitcoinScript {
+	switch {
+	case n == 0:
+		return append(s, byte(Op0))
+	case n == -1:
+		return append(s, byte(Op1NEGATE))
+	case n >= 1 && n <= 16:
+		return append(s, byte(Op1)+byte(n-1))
+	}
+	return appendDataPush(s, encodeScriptNum(n))
+}
+
+// encodeScriptNum returns the minimal little-endian sign-magnitude encoding of
+// n used for numbers in Bitcoin Script.
+func encodeScriptNum(n int64) (b []byte) {
+	if n == 0 {
+		return nil
+	}
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	for ; abs > 0; abs >>= 8 {
+		b = append(b, byte(abs))
+	}
+	// the most significant bit of the last byte is the sign bit
+	if b[len(b)-1]&0x80 != 0 {
+		if negative {
+			b = append(b, 0x80)
+		} else {
+			b = append(b, 0x00)
+		}
+	} else if negative {
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
+
+// appendDataPush appends a push of the data with the smallest push opcode.
+func appendDataPush(s BitcoinScript, data []byte) BitcoinScript {
+	opCode := GetDataPushOpCodeForLength(len(data))
+	s = append(s, byte(opCode))
+	switch opCode {
+	case OpPUSHDATA1:
+		s = append(s, byte(len(data)))
+	case OpPUSHDATA2:
+		s = append(s, byte(len(data)), byte(len(data)>>8))
+	case OpPUSHDATA4:
+		s = appendUint32(s, uint32(len(data)))
+	}
+	return append(s, data...)
+}
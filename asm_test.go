@@ -0,0 +1,129 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestASM(t *testing.T) {
+	testCases := map[string]string{
+		"":               "",
+		"00":             "0",
+		"0100":           "0",
+		"4f":             "-1",
+		"51":             "1",
+		"60":             "16",
+		"0181":           "-1",
+		"020802":         "520",
+		"04ffffff7f":     "2147483647",
+		"04ffffffff":     "-2147483647",
+		"050102030405":   "0102030405",
+		"4c0101":         "1",
+		"b1b2ba":         "OP_CHECKLOCKTIMEVERIFY OP_CHECKSEQUENCEVERIFY OP_CHECKSIGADD",
+		"bbfeff":         "OP_UNKNOWN OP_UNKNOWN OP_INVALIDOPCODE",
+		"6a0401020304":   "OP_RETURN 67305985",
+		"76a90401020304": "OP_DUP OP_HASH160 67305985",
+		"0501020304":     "[error]",
+		"764d0100":       "OP_DUP [error]",
+	}
+
+	for script, expected := range testCases {
+		s, _ := hex.DecodeString(script)
+		if asm := BitcoinScript(s).ASM(true); asm != expected {
+			t.Errorf("Expected ASM() of %s to be %q, but got %q", script, expected, asm)
+		}
+	}
+}
+
+func TestASMSighashDecoding(t *testing.T) {
+	// scriptSig of the first input of the BIP143 native P2WPKH example
+	s, _ := hex.DecodeString("4830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01")
+	expected := "30450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed"
+	if asm := BitcoinScript(s).ASM(true); asm != expected+"[ALL]" {
+		t.Errorf("Expected the sighash to be decoded, but got %s", asm)
+	}
+	if asm := BitcoinScript(s).ASM(false); asm != expected+"01" {
+		t.Errorf("Expected the sighash not to be decoded, but got %s", asm)
+	}
+
+	// the sighash isn't decoded in unspendable scripts
+	unspendable := append([]byte{byte(OpRETURN)}, s...)
+	if asm := BitcoinScript(unspendable).ASM(true); asm != "OP_RETURN "+expected+"01" {
+		t.Errorf("Expected the sighash not to be decoded in an unspendable script, but got %s", asm)
+	}
+
+	// an undefined sighash type is not decoded
+	s[len(s)-1] = 0x04
+	if asm := BitcoinScript(s).ASM(true); asm != expected+"04" {
+		t.Errorf("Expected the undefined sighash not to be decoded, but got %s", asm)
+	}
+}
+
+func TestParseASM(t *testing.T) {
+	testCases := map[string]string{
+		"":   "",
+		"0":  "00",
+		"-1": "4f",
+		"1 16 17 -17 128 -128 2147483647 -2147483647":                                           "5160" + "0111" + "0191" + "028000" + "028080" + "04ffffff7f" + "04ffffffff",
+		"OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG": "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac",
+		"DUP HASH160 0x14 0x751e76e8199196d454941c45d1b3a323f1433bd6 EQUALVERIFY CHECKSIG":      "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac",
+		"OP_FALSE OP_TRUE OP_NOP10 OP_CHECKSIGADD OP_UNKNOWN186 OP_INVALIDOPCODE":               "0051b9babaff",
+		"1700000000 OP_CHECKLOCKTIMEVERIFY OP_DROP":                                             "0400f15365b175",
+		"0102030405 3044[SINGLE|ANYONECANPAY]":                                                  "050102030405" + "03304483",
+		"0000000000000000":                                                                      "080000000000000000",
+		"'abc'":                                                                                 "03616263",
+		"OP_RETURN " + strings.Repeat("aa", 80):                                                 "6a4c50" + strings.Repeat("aa", 80),
+		"OP_RETURN " + strings.Repeat("aa", 256):                                                "6a4d0001" + strings.Repeat("aa", 256),
+	}
+
+	for asm, expected := range testCases {
+		s, err := ParseASM(asm)
+		if err != nil {
+			t.Errorf("Expected no error parsing %q, but got %s", asm, err)
+		}
+		if result := hex.EncodeToString(s); result != expected {
+			t.Errorf("Expected ParseASM(%q) to be %s, but got %s", asm, expected, result)
+		}
+	}
+
+	invalid := []string{"[error]", "OP_UNKNOWN", "OP_DATA_20", "abc", "0xzz", "3044[FOO]", "[ALL]", "OP_DUP 4294967296x"}
+	for _, asm := range invalid {
+		if _, err := ParseASM(asm); err == nil {
+			t.Errorf("Expected an error parsing %q", asm)
+		}
+	}
+}
+
+func TestParseASMRoundTrip(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		scripts := []BitcoinScript{}
+		for _, in := range tx.Inputs {
+			if !in.IsCoinbase() {
+				scripts = append(scripts, in.ScriptSig, in.GetRevealedScript())
+			}
+		}
+		for _, out := range tx.Outputs {
+			scripts = append(scripts, out.ScriptPubKey)
+		}
+
+		// ASM doesn't record how data was pushed, so scripts with non-minimal
+		// pushes only round-trip as ASM
+		for _, s := range scripts {
+			asm := s.ASM(true)
+			parsed, err := ParseASM(asm)
+			if err != nil {
+				t.Errorf("Expected no error parsing %q, but got %s for testTx: %+v", asm, err, testTx)
+			}
+			if result := parsed.ASM(true); result != asm {
+				t.Errorf("Expected ParseASM() to round-trip %q, but got %q for testTx: %+v", asm, result, testTx)
+			}
+		}
+	}
+}
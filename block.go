@@ -0,0 +1,135 @@
+package rawtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// BlockHeaderSize is the size of a serialized block header in bytes.
+const BlockHeaderSize = 80
+
+// minTxSize is the size of the smallest possible serialized transaction
+// (version, input count, output count and locktime) in bytes.
+const minTxSize = 4 + 1 + 1 + 4
+
+// BlockHeader represents a bitcoin block header as a struct.
+type BlockHeader struct {
+	Version    int32
+	PrevBlock  Hash
+	MerkleRoot Hash
+	Timestamp  uint32
+	Bits       uint32
+	Nonce      uint32
+}
+
+// DeserializeBlockHeader deserializes a block header from the first 80 bytes
+// of b.
+func DeserializeBlockHeader(b []byte) (header BlockHeader, err error) {
+	if len(b) < BlockHeaderSize {
+		return header, fmt.Errorf("block header is %d bytes long, expected %d bytes", len(b), BlockHeaderSize)
+	}
+	header.Version = int32(binary.LittleEndian.Uint32(b[0:4]))
+	copy(header.PrevBlock[:], b[4:36])
+	copy(header.MerkleRoot[:], b[36:68])
+	header.Timestamp = binary.LittleEndian.Uint32(b[68:72])
+	header.Bits = binary.LittleEndian.Uint32(b[72:76])
+	header.Nonce = binary.LittleEndian.Uint32(b[76:80])
+	return header, nil
+}
+
+// Serialize returns the 80 byte serialization of the block header.
+func (h *BlockHeader) Serialize() []byte {
+	b := make([]byte, 0, BlockHeaderSize)
+	b = appendUint32(b, uint32(h.Version))
+	b = append(b, h.PrevBlock[:]...)
+	b = append(b, h.MerkleRoot[:]...)
+	b = appendUint32(b, h.Timestamp)
+	b = appendUint32(b, h.Bits)
+	return appendUint32(b, h.Nonce)
+}
+
+// Hash returns the block hash, the double SHA256 hash of the serialized
+// header.
+func (h *BlockHeader) Hash() Hash {
+	return DoubleSHA256(h.Serialize())
+}
+
+// Block represents a bitcoin block with its header and transactions.
+type Block struct {
+	Hash         Hash
+	Header       BlockHeader
+	Transactions []Tx
+	size         int
+	strippedSize int
+}
+
+// DeserializeBlock deserializes a raw block. Like DeserializeTx, the scripts
+// and witnesses of the transactions reference the passed byte slice, which
+// must not be modified afterwards.
+func DeserializeBlock(rawBlock []byte) (block Block, err error) {
+	if block.Header, err = DeserializeBlockHeader(rawBlock); err != nil {
+		return Block{}, err
+	}
+	block.Hash = DoubleSHA256(rawBlock[:BlockHeaderSize])
+
+	r := &txReader{b: rawBlock, pos: BlockHeaderSize}
+	numTxns, err := r.readCount(minTxSize, "transaction count")
+	if err != nil {
+		return Block{}, err
+	}
+	block.strippedSize = r.pos
+
+	block.Transactions = make([]Tx, numTxns)
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		n, err := tx.deserialize(rawBlock[r.pos:])
+		if err != nil {
+			return Block{}, fmt.Errorf("could not deserialize transaction %d: %s", i, err)
+		}
+		r.pos += n
+		block.strippedSize += tx.serializeSizeStripped
+	}
+	if r.pos != len(rawBlock) {
+		return Block{}, fmt.Errorf("%d bytes of trailing data after the block", len(rawBlock)-r.pos)
+	}
+	block.size = r.pos
+	return block, nil
+}
+
+// StringToBlock returns a Block for a raw block hex string as returned by
+// Bitcoin Core's getblock RPC with verbosity 0.
+func StringToBlock(rawBlock string) (Block, error) {
+	b, err := hex.DecodeString(rawBlock)
+	if err != nil {
+		return Block{}, err
+	}
+	return DeserializeBlock(b)
+}
+
+// GetSize returns the serialized size of the block including witnesses in
+// bytes.
+func (b *Block) GetSize() int {
+	return b.size
+}
+
+// GetStrippedSize returns the serialized size of the block without
+// witnesses in bytes.
+func (b *Block) GetStrippedSize() int {
+	return b.strippedSize
+}
+
+// GetWeight returns the weight of the block in weight units as defined in
+// BIP141.
+func (b *Block) GetWeight() int {
+	return b.strippedSize*(WitnessScaleFactor-1) + b.size
+}
+
+// Coinbase returns the coinbase transaction of the block. False is returned
+// if the block has no transactions or the first transaction is not a coinbase.
+func (b *Block) Coinbase() (*Tx, bool) {
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return nil, false
+	}
+	return &b.Transactions[0], true
+}
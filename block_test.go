@@ -0,0 +1,103 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testBlock returns a serialized block with the transactions from the
+// testdata. The merkle root isn't valid.
+func testBlock(t testing.TB) []byte {
+	header := BlockHeader{Version: 0x20000000, Timestamp: 1231006505, Bits: 0x1d00ffff, Nonce: 42}
+	header.PrevBlock[0] = 0xb1
+	raw := header.Serialize()
+
+	testTxns := GetTestTransactions()
+	raw = appendCompactSize(raw, uint64(len(testTxns)))
+	for _, testTx := range testTxns {
+		rawTx, err := hex.DecodeString(testTx.RawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		raw = append(raw, rawTx...)
+	}
+	return raw
+}
+
+func TestDeserializeBlock(t *testing.T) {
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, raw := range [][]byte{genesis.Bytes(), testBlock(t)} {
+		block, err := DeserializeBlock(raw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		wireBlock := wire.MsgBlock{}
+		if err := wireBlock.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if block.Hash != Hash(wireBlock.BlockHash()) || block.Header.Hash() != block.Hash {
+			t.Errorf("Expected the block hash to be %s, but got %s", wireBlock.BlockHash(), block.Hash)
+		}
+		if !bytes.Equal(block.Header.Serialize(), raw[:BlockHeaderSize]) {
+			t.Errorf("Expected the serialized header to be %x, but got %x", raw[:BlockHeaderSize], block.Header.Serialize())
+		}
+		if block.GetSize() != wireBlock.SerializeSize() || block.GetStrippedSize() != wireBlock.SerializeSizeStripped() {
+			t.Errorf("Expected the size %d and stripped size %d, but got %d and %d", wireBlock.SerializeSize(), wireBlock.SerializeSizeStripped(), block.GetSize(), block.GetStrippedSize())
+		}
+		if block.GetWeight() != 3*wireBlock.SerializeSizeStripped()+wireBlock.SerializeSize() {
+			t.Errorf("Expected the weight to match the sizes, but got %d", block.GetWeight())
+		}
+		if len(block.Transactions) != len(wireBlock.Transactions) {
+			t.Fatalf("Expected %d transactions, but got %d", len(wireBlock.Transactions), len(block.Transactions))
+		}
+		for i, wireTx := range wireBlock.Transactions {
+			tx := Tx{}
+			tx.FromWireMsgTx(wireTx)
+			if !reflect.DeepEqual(block.Transactions[i], tx) {
+				t.Errorf("Expected transaction %d to be %+v, but got %+v", i, tx, block.Transactions[i])
+			}
+		}
+	}
+
+	block, _ := DeserializeBlock(genesis.Bytes())
+	if block.Hash.String() != "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f" {
+		t.Errorf("Expected the genesis block hash, but got %s", block.Hash)
+	}
+	if coinbase, ok := block.Coinbase(); !ok || coinbase.TxID().String() != "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b" {
+		t.Errorf("Expected the genesis coinbase, but got %v", coinbase)
+	}
+
+	if _, err := StringToBlock(hex.EncodeToString(genesis.Bytes())); err != nil {
+		t.Errorf("Expected no error for the genesis block hex, but got %s", err)
+	}
+}
+
+func TestDeserializeBlockInvalid(t *testing.T) {
+	raw := testBlock(t)
+
+	invalid := map[string][]byte{
+		"truncated header":       raw[:79],
+		"missing tx count":       raw[:BlockHeaderSize],
+		"too many transactions":  append(append([]byte{}, raw[:BlockHeaderSize]...), 0xfe, 0x00, 0x00, 0x00, 0x01),
+		"truncated transaction":  raw[:len(raw)-1],
+		"trailing data":          append(append([]byte{}, raw...), 0x00),
+		"transaction count of 2": append(append(append([]byte{}, raw[:BlockHeaderSize]...), 0x02), raw[BlockHeaderSize+1:]...),
+	}
+
+	for name, b := range invalid {
+		if _, err := DeserializeBlock(b); err == nil {
+			t.Errorf("Expected an error for a block with %s", name)
+		}
+	}
+}
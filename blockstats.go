@@ -0,0 +1,408 @@
+package rawtx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// subsidyHalvingInterval is the number of blocks after which the block subsidy
+// is halved on mainnet, testnet and signet.
+const subsidyHalvingInterval = 210000
+
+// initialSubsidy is the block subsidy before the first halving in sat.
+const initialSubsidy = 50 * 100000000
+
+// BlockStats are the statistics of a block matching the fields of Bitcoin
+// Core's getblockstats RPC. Amounts are in sat and feerates in sat/vbyte. Like
+// in Bitcoin Core, the coinbase is excluded from the fee, size and input
+// statistics, but its outputs are counted.
+type BlockStats struct {
+	AvgFee             int64    `json:"avgfee"`
+	AvgFeeRate         int64    `json:"avgfeerate"`
+	AvgTxSize          int64    `json:"avgtxsize"`
+	BlockHash          Hash     `json:"blockhash"`
+	FeeRatePercentiles [5]int64 `json:"feerate_percentiles"`
+	// Height is the height of the block. Block.Stats takes it from the
+	// coinbase (BIP34), so it's zero for blocks without a height in the
+	// coinbase. Use Block.StatsAtHeight for these blocks.
+	Height       int64 `json:"height"`
+	Ins          int   `json:"ins"`
+	MaxFee       int64 `json:"maxfee"`
+	MaxFeeRate   int64 `json:"maxfeerate"`
+	MaxTxSize    int   `json:"maxtxsize"`
+	MedianFee    int64 `json:"medianfee"`
+	MedianTxSize int   `json:"mediantxsize"`
+	MinFee       int64 `json:"minfee"`
+	MinFeeRate   int64 `json:"minfeerate"`
+	MinTxSize    int   `json:"mintxsize"`
+	Outs         int   `json:"outs"`
+	// Subsidy is the block subsidy at Height. Like Height, it's zero for
+	// blocks without a height in the coinbase when returned by Block.Stats.
+	Subsidy       int64 `json:"subsidy"`
+	SwTotalSize   int   `json:"swtotal_size"`
+	SwTotalWeight int   `json:"swtotal_weight"`
+	SwTxs         int   `json:"swtxs"`
+	Time          int64 `json:"time"`
+	TotalOut      int64 `json:"total_out"`
+	TotalSize     int   `json:"total_size"`
+	TotalWeight   int   `json:"total_weight"`
+	TotalFee      int64 `json:"totalfee"`
+	Txs           int   `json:"txs"`
+	UTXOIncrease  int   `json:"utxo_increase"`
+
+	// EffectiveFeeRatePercentiles are the feerate percentiles with the
+	// feerates of transactions in Packages replaced by their package
+	// feerate. They aren't part of getblockstats.
+	EffectiveFeeRatePercentiles [5]int64 `json:"effective_feerate_percentiles"`
+	// Packages are the CPFP packages of transactions in the block spending
+	// outputs of other transactions in the block.
+	Packages []PackageFeeRate `json:"packages,omitempty"`
+}
+
+// PackageFeeRate is a package of transactions in a block that was mined
+// together, for example a parent paying a low fee and a child paying a high
+// fee (CPFP). The feerate of the package is the effective feerate of each of
+// its transactions.
+type PackageFeeRate struct {
+	// TxIndexes are the indexes of the transactions in the block.
+	TxIndexes []int `json:"txindexes"`
+	Fee       int64 `json:"fee"`
+	Weight    int   `json:"weight"`
+	FeeRate   int64 `json:"feerate"`
+}
+
+// feeRate returns the feerate in sat/vbyte for the fee and weight like
+// Bitcoin Core's getblockstats.
+func feeRate(fee int64, weight int) int64 {
+	if weight == 0 {
+		return 0
+	}
+	return fee * WitnessScaleFactor / int64(weight)
+}
+
+// BlockSubsidy returns the subsidy of a block at the height in sat.
+func BlockSubsidy(height int64) int64 {
+	halvings := height / subsidyHalvingInterval
+	if height < 0 || halvings >= 64 {
+		return 0
+	}
+	return initialSubsidy >> uint(halvings)
+}
+
+// Stats returns the statistics of the block. Prevouts spent from earlier
+// transactions in the block are resolved from the block, all other unknown
+// prevouts are set using the fetcher, which can be nil if all prevouts are
+// already known. An error is returned if a prevout can't be fetched. The
+// height of the block is taken from the coinbase (BIP34). For blocks without
+// a height in the coinbase, like those before BIP34 activation, Height and
+// Subsidy are zero.
+func (b *Block) Stats(ctx context.Context, fetcher PrevoutFetcher) (*BlockStats, error) {
+	if cb, ok := b.DecodeCoinbase(); ok && cb.HasHeight {
+		return b.StatsAtHeight(ctx, fetcher, cb.Height)
+	}
+	stats, err := b.StatsAtHeight(ctx, fetcher, 0)
+	if err != nil {
+		return nil, err
+	}
+	stats.Subsidy = 0
+	return stats, nil
+}
+
+// StatsAtHeight returns the statistics of the block at the height like Stats.
+// Like Bitcoin Core's getblockstats, the height isn't taken from the coinbase
+// and the subsidy is reported for all blocks.
+func (b *Block) StatsAtHeight(ctx context.Context, fetcher PrevoutFetcher, height int64) (*BlockStats, error) {
+	if err := b.fetchPrevouts(ctx, fetcher); err != nil {
+		return nil, err
+	}
+
+	stats := &BlockStats{BlockHash: b.Hash, Height: height, Subsidy: BlockSubsidy(height), Time: int64(b.Header.Timestamp), Txs: len(b.Transactions)}
+
+	var fees []int64
+	var sizes []int
+	feeRates := make([]weightedFeeRate, 0, len(b.Transactions))
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		stats.Outs += len(tx.Outputs)
+		if tx.IsCoinbase() {
+			continue
+		}
+		stats.Ins += len(tx.Inputs)
+		stats.TotalOut += tx.GetOutputSum()
+
+		size, weight := tx.GetSizeWithWitness(), tx.GetWeight()
+		sizes = append(sizes, size)
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if tx.hasWitness() {
+			stats.SwTxs++
+			stats.SwTotalSize += size
+			stats.SwTotalWeight += weight
+		}
+
+		fee, _ := tx.GetFee()
+		fees = append(fees, fee)
+		stats.TotalFee += fee
+		rate := feeRate(fee, weight)
+		feeRates = append(feeRates, weightedFeeRate{feeRate: rate, weight: weight})
+		if len(fees) == 1 {
+			stats.MinFee, stats.MaxFee, stats.MinFeeRate, stats.MaxFeeRate = fee, fee, rate, rate
+			stats.MinTxSize, stats.MaxTxSize = size, size
+			continue
+		}
+		stats.MinFee, stats.MaxFee = minInt64(stats.MinFee, fee), maxInt64(stats.MaxFee, fee)
+		stats.MinFeeRate, stats.MaxFeeRate = minInt64(stats.MinFeeRate, rate), maxInt64(stats.MaxFeeRate, rate)
+		if size < stats.MinTxSize {
+			stats.MinTxSize = size
+		}
+		if size > stats.MaxTxSize {
+			stats.MaxTxSize = size
+		}
+	}
+
+	if n := int64(len(fees)); n > 0 {
+		stats.AvgFee = stats.TotalFee / n
+		stats.AvgTxSize = int64(stats.TotalSize) / n
+	}
+	stats.AvgFeeRate = feeRate(stats.TotalFee, stats.TotalWeight)
+	stats.MedianFee = truncatedMedianInt64(fees)
+	stats.MedianTxSize = int(truncatedMedianInt64(intsToInt64s(sizes)))
+	stats.FeeRatePercentiles = percentilesByWeight(feeRates)
+	stats.UTXOIncrease = stats.Outs - stats.Ins
+
+	stats.Packages = b.packages()
+	effective := make([]weightedFeeRate, 0, len(feeRates))
+	packageFeeRates := make(map[int]int64)
+	for _, p := range stats.Packages {
+		for _, i := range p.TxIndexes {
+			packageFeeRates[i] = p.FeeRate
+		}
+	}
+	for i := range b.Transactions {
+		if b.Transactions[i].IsCoinbase() {
+			continue
+		}
+		rate := feeRates[len(effective)]
+		if packageFeeRate, ok := packageFeeRates[i]; ok {
+			rate.feeRate = packageFeeRate
+		}
+		effective = append(effective, rate)
+	}
+	stats.EffectiveFeeRatePercentiles = percentilesByWeight(effective)
+	return stats, nil
+}
+
+// fetchPrevouts sets the unknown prevouts of the transactions, first from the
+// outputs of earlier transactions in the block and then using the fetcher.
+func (b *Block) fetchPrevouts(ctx context.Context, fetcher PrevoutFetcher) error {
+	inBlock := make(PrevoutMap)
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		if !tx.IsCoinbase() {
+			for j := range tx.Inputs {
+				in := &tx.Inputs[j]
+				if in.Prevout == nil {
+					in.Prevout = inBlock[in.Outpoint]
+				}
+			}
+			if !tx.HasAllPrevouts() {
+				if fetcher == nil {
+					fetcher = PrevoutMap{}
+				}
+				if err := tx.FetchPrevouts(ctx, fetcher); err != nil {
+					return fmt.Errorf("transaction %d (%s): %w", i, tx.Hash, err)
+				}
+			}
+		}
+		inBlock.AddTx(tx)
+	}
+	return nil
+}
+
+// packages returns the CPFP packages of the block. Transactions connected by
+// spending outputs of each other in the block are grouped into clusters. Like
+// a miner selecting transactions by ancestor feerate, the transaction with
+// the highest feerate including its not yet selected ancestors is selected
+// with these ancestors as package, until all transactions of the cluster are
+// selected. Only packages of more than one transaction are returned.
+func (b *Block) packages() (packages []PackageFeeRate) {
+	indexes := make(map[Hash]int, len(b.Transactions))
+	for i := range b.Transactions {
+		indexes[b.Transactions[i].Hash] = i
+	}
+	parents := make(map[int][]int)
+	clusterOf := make([]int, len(b.Transactions))
+	for i := range clusterOf {
+		clusterOf[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		for clusterOf[i] != i {
+			clusterOf[i] = clusterOf[clusterOf[i]]
+			i = clusterOf[i]
+		}
+		return i
+	}
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		if tx.IsCoinbase() {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, in := range tx.Inputs {
+			parent, ok := indexes[in.Outpoint.PrevTxHash]
+			if !ok || parent >= i || seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			parents[i] = append(parents[i], parent)
+			clusterOf[find(i)] = find(parent)
+		}
+	}
+
+	clusters := make(map[int][]int)
+	for i := range b.Transactions {
+		clusters[find(i)] = append(clusters[find(i)], i)
+	}
+	roots := make([]int, 0, len(clusters))
+	for root, members := range clusters {
+		if len(members) > 1 {
+			roots = append(roots, root)
+		}
+	}
+	sort.Ints(roots)
+
+	for _, root := range roots {
+		packages = append(packages, b.linearize(clusters[root], parents)...)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].TxIndexes[0] < packages[j].TxIndexes[0] })
+	return packages
+}
+
+// linearize splits a cluster into packages by repeatedly selecting the
+// transaction with the highest ancestor feerate.
+func (b *Block) linearize(cluster []int, parents map[int][]int) (packages []PackageFeeRate) {
+	selected := make(map[int]bool)
+	for len(selected) < len(cluster) {
+		var best PackageFeeRate
+		for _, i := range cluster {
+			if selected[i] {
+				continue
+			}
+			p := b.ancestorPackage(i, parents, selected)
+			if best.TxIndexes == nil || p.Fee*int64(best.Weight) > best.Fee*int64(p.Weight) {
+				best = p
+			}
+		}
+		for _, i := range best.TxIndexes {
+			selected[i] = true
+		}
+		if len(best.TxIndexes) > 1 {
+			packages = append(packages, best)
+		}
+	}
+	return packages
+}
+
+// ancestorPackage returns the transaction with its ancestors in the block that
+// aren't selected yet.
+func (b *Block) ancestorPackage(i int, parents map[int][]int, selected map[int]bool) PackageFeeRate {
+	inPackage := map[int]bool{i: true}
+	queue := []int{i}
+	for len(queue) > 0 {
+		for _, parent := range parents[queue[0]] {
+			if !selected[parent] && !inPackage[parent] {
+				inPackage[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	var p PackageFeeRate
+	for j := range inPackage {
+		tx := &b.Transactions[j]
+		fee, _ := tx.GetFee()
+		p.TxIndexes = append(p.TxIndexes, j)
+		p.Fee += fee
+		p.Weight += tx.GetWeight()
+	}
+	sort.Ints(p.TxIndexes)
+	p.FeeRate = feeRate(p.Fee, p.Weight)
+	return p
+}
+
+type weightedFeeRate struct {
+	feeRate int64
+	weight  int
+}
+
+// percentilesByWeight returns the 10th, 25th, 50th, 75th and 90th percentile
+// of the feerates weighted by the transaction weight like Bitcoin Core's
+// getblockstats.
+func percentilesByWeight(feeRates []weightedFeeRate) (result [5]int64) {
+	if len(feeRates) == 0 {
+		return result
+	}
+	sorted := make([]weightedFeeRate, len(feeRates))
+	copy(sorted, feeRates)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].feeRate < sorted[j].feeRate })
+
+	var totalWeight int64
+	for _, fr := range sorted {
+		totalWeight += int64(fr.weight)
+	}
+	total := float64(totalWeight)
+	thresholds := [5]float64{total / 10, total / 4, total / 2, total * 3 / 4, total * 9 / 10}
+	next := 0
+	var cumulativeWeight int64
+	for _, fr := range sorted {
+		cumulativeWeight += int64(fr.weight)
+		for next < len(result) && float64(cumulativeWeight) >= thresholds[next] {
+			result[next] = fr.feeRate
+			next++
+		}
+	}
+	for ; next < len(result); next++ {
+		result[next] = sorted[len(sorted)-1].feeRate
+	}
+	return result
+}
+
+// truncatedMedianInt64 returns the median of the values, the integer mean of
+// the two middle values for an even number of values.
+func truncatedMedianInt64(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted)%2 == 0 {
+		return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
+
+func intsToInt64s(values []int) []int64 {
+	converted := make([]int64, len(values))
+	for i, v := range values {
+		converted[i] = int64(v)
+	}
+	return converted
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,186 @@
+package rawtx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testCPFPBlock returns a block with a coinbase, a parent paying a low fee, a
+// child bumping it, an unrelated transaction and a second child of the parent,
+// and the prevouts spent from outside the block.
+func testCPFPBlock(t *testing.T) (Block, PrevoutMap) {
+	p2wpkh := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	external := []Outpoint{{OutputIndex: 0}, {OutputIndex: 1}}
+	external[0].PrevTxHash[0], external[1].PrevTxHash[0] = 0xaa, 0xbb
+	prevouts := PrevoutMap{
+		external[0]: NewOutput(100000, p2wpkh),
+		external[1]: NewOutput(20000, p2wpkh),
+	}
+
+	newTx := func(outpoint Outpoint, witness wire.TxWitness, values ...int64) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		hash := chainhash.Hash(outpoint.PrevTxHash)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, outpoint.OutputIndex), nil, witness))
+		for _, value := range values {
+			tx.AddTxOut(wire.NewTxOut(value, p2wpkh))
+		}
+		return tx
+	}
+	coinbase := wire.NewMsgTx(2)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), appendScriptNum(nil, 800000), nil))
+	coinbase.AddTxOut(wire.NewTxOut(625015300, p2wpkh))
+	parent := newTx(external[0], nil, 50000, 49800)
+	parentHash := Outpoint{PrevTxHash: Hash(parent.TxHash())}
+	witness := wire.TxWitness{make([]byte, 72), make([]byte, 33)}
+	child := newTx(Outpoint{PrevTxHash: parentHash.PrevTxHash, OutputIndex: 0}, witness, 40000)
+	unrelated := newTx(external[1], nil, 15000)
+	secondChild := newTx(Outpoint{PrevTxHash: parentHash.PrevTxHash, OutputIndex: 1}, nil, 49700)
+
+	header := BlockHeader{Version: 0x20000000, Timestamp: 1700000000, Bits: 0x207fffff}
+	raw := header.Serialize()
+	txns := []*wire.MsgTx{coinbase, parent, child, unrelated, secondChild}
+	raw = appendCompactSize(raw, uint64(len(txns)))
+	for _, tx := range txns {
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			t.Fatal(err.Error())
+		}
+		raw = append(raw, buf.Bytes()...)
+	}
+	block, err := DeserializeBlock(raw)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return block, prevouts
+}
+
+func TestBlockStats(t *testing.T) {
+	block, prevouts := testCPFPBlock(t)
+	stats, err := block.Stats(context.Background(), prevouts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	txns := block.Transactions
+	var totalSize, totalWeight int
+	for _, tx := range txns[1:] {
+		totalSize += tx.GetSizeWithWitness()
+		totalWeight += tx.GetWeight()
+	}
+	expected := BlockStats{
+		AvgFee:        15300 / 4,
+		AvgFeeRate:    15300 * 4 / int64(totalWeight),
+		AvgTxSize:     int64(totalSize / 4),
+		BlockHash:     block.Hash,
+		Height:        800000,
+		Ins:           4,
+		MaxFee:        10000,
+		MaxFeeRate:    10000 * 4 / int64(txns[2].GetWeight()),
+		MedianFee:     (200 + 5000) / 2,
+		MinFee:        100,
+		MinFeeRate:    100 * 4 / int64(txns[4].GetWeight()),
+		Outs:          6,
+		Subsidy:       625000000,
+		SwTotalSize:   txns[2].GetSizeWithWitness(),
+		SwTotalWeight: txns[2].GetWeight(),
+		SwTxs:         1,
+		Time:          1700000000,
+		TotalOut:      50000 + 49800 + 40000 + 15000 + 49700,
+		TotalSize:     totalSize,
+		TotalWeight:   totalWeight,
+		TotalFee:      15300,
+		Txs:           5,
+		UTXOIncrease:  2,
+	}
+	expected.MinTxSize, expected.MaxTxSize, expected.MedianTxSize = stats.MinTxSize, stats.MaxTxSize, stats.MedianTxSize
+	expected.FeeRatePercentiles, expected.EffectiveFeeRatePercentiles = stats.FeeRatePercentiles, stats.EffectiveFeeRatePercentiles
+	expected.Packages = stats.Packages
+	if !reflect.DeepEqual(*stats, expected) {
+		t.Errorf("Expected the stats\n%+v\nbut got\n%+v", expected, *stats)
+	}
+	if stats.MaxTxSize != txns[2].GetSizeWithWitness() || stats.MinTxSize != txns[3].GetSizeWithWitness() {
+		t.Errorf("Expected the child as largest and the unrelated transaction as smallest, but got %d and %d", stats.MaxTxSize, stats.MinTxSize)
+	}
+
+	// the child bumps the parent, the second child is mined after the parent
+	packageWeight := txns[1].GetWeight() + txns[2].GetWeight()
+	expectedPackages := []PackageFeeRate{{TxIndexes: []int{1, 2}, Fee: 10200, Weight: packageWeight, FeeRate: 10200 * 4 / int64(packageWeight)}}
+	if !reflect.DeepEqual(stats.Packages, expectedPackages) {
+		t.Errorf("Expected the packages %+v, but got %+v", expectedPackages, stats.Packages)
+	}
+	parentFeeRate := int64(200 * 4 / txns[1].GetWeight())
+	if stats.FeeRatePercentiles[1] != parentFeeRate || stats.EffectiveFeeRatePercentiles[1] != expectedPackages[0].FeeRate {
+		t.Errorf("Expected the parent feerate to be replaced by the package feerate, but got %v and %v", stats.FeeRatePercentiles, stats.EffectiveFeeRatePercentiles)
+	}
+}
+
+func TestBlockStatsPrevouts(t *testing.T) {
+	block, prevouts := testCPFPBlock(t)
+	if _, err := block.Stats(context.Background(), nil); !errors.Is(err, ErrPrevoutNotFound) {
+		t.Errorf("Expected ErrPrevoutNotFound without a fetcher, but got %v", err)
+	}
+
+	// prevouts that are already attached don't need a fetcher
+	block, _ = testCPFPBlock(t)
+	for i := range block.Transactions {
+		for j := range block.Transactions[i].Inputs {
+			in := &block.Transactions[i].Inputs[j]
+			in.Prevout = prevouts[in.Outpoint]
+		}
+	}
+	if stats, err := block.Stats(context.Background(), nil); err != nil || stats.TotalFee != 15300 {
+		t.Errorf("Expected the stats with the attached prevouts, but got %v", err)
+	}
+}
+
+func TestPercentilesByWeight(t *testing.T) {
+	feeRates := []weightedFeeRate{{10, 600}, {2, 100}, {1, 100}, {3, 200}}
+	if percentiles := percentilesByWeight(feeRates); percentiles != [5]int64{1, 3, 10, 10, 10} {
+		t.Errorf("Expected the percentiles [1 3 10 10 10], but got %v", percentiles)
+	}
+	if percentiles := percentilesByWeight(nil); percentiles != [5]int64{} {
+		t.Errorf("Expected no percentiles without transactions, but got %v", percentiles)
+	}
+	if subsidy := BlockSubsidy(209999); subsidy != 5000000000 {
+		t.Errorf("Expected a subsidy of 50 BTC, but got %d", subsidy)
+	}
+	if subsidy := BlockSubsidy(64 * 210000); subsidy != 0 {
+		t.Errorf("Expected no subsidy after 64 halvings, but got %d", subsidy)
+	}
+}
+
+func TestBlockStatsHeight(t *testing.T) {
+	// the genesis block predates BIP34 and has no height in the coinbase
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+	block, err := DeserializeBlock(genesis.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	stats, err := block.Stats(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stats.Height != 0 || stats.Subsidy != 0 {
+		t.Errorf("Expected no height and subsidy without a BIP34 height, but got %d and %d", stats.Height, stats.Subsidy)
+	}
+
+	for height, subsidy := range map[int64]int64{0: 5000000000, 210000: 2500000000} {
+		stats, err := block.StatsAtHeight(context.Background(), nil, height)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if stats.Height != height || stats.Subsidy != subsidy || stats.Txs != 1 {
+			t.Errorf("Expected the subsidy %d at height %d, but got %d at %d", subsidy, height, stats.Subsidy, stats.Height)
+		}
+	}
+}
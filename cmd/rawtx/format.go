@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// The supported output formats.
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatTable  = "table"
+)
+
+var formats = []string{formatJSON, formatNDJSON, formatCSV, formatTable}
+
+func isValidFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// recordWriter writes records in an output format. Close must be called after
+// the last record.
+type recordWriter interface {
+	Write(r record) error
+	Close() error
+}
+
+func newRecordWriter(w io.Writer, format string, header []string) recordWriter {
+	switch format {
+	case formatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}
+	case formatCSV:
+		return &csvWriter{w: csv.NewWriter(w), header: header}
+	case formatTable:
+		return &tableWriter{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), header: header}
+	}
+	return &jsonWriter{w: w}
+}
+
+// jsonWriter writes a single record as indented JSON object and multiple
+// records as JSON array. The records are kept in memory until Close.
+type jsonWriter struct {
+	w       io.Writer
+	records []interface{}
+}
+
+func (jw *jsonWriter) Write(r record) error {
+	jw.records = append(jw.records, r.value)
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	var v interface{} = jw.records
+	if len(jw.records) == 1 {
+		v = jw.records[0]
+	} else if len(jw.records) == 0 {
+		v = []interface{}{}
+	}
+	enc := json.NewEncoder(jw.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ndjsonWriter writes each record as JSON object on a line.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(r record) error {
+	return nw.enc.Encode(r.value)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes the records as CSV with a header line.
+type csvWriter struct {
+	w             *csv.Writer
+	header        []string
+	headerWritten bool
+}
+
+func (cw *csvWriter) Write(r record) error {
+	if !cw.headerWritten {
+		if err := cw.w.Write(cw.header); err != nil {
+			return err
+		}
+		cw.headerWritten = true
+	}
+	return cw.w.Write(r.row)
+}
+
+func (cw *csvWriter) Close() error {
+	if !cw.headerWritten {
+		if err := cw.w.Write(cw.header); err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// tableWriter writes the records as table with aligned columns. The table is
+// written on Close.
+type tableWriter struct {
+	w             *tabwriter.Writer
+	header        []string
+	headerWritten bool
+}
+
+func (tw *tableWriter) Write(r record) error {
+	if !tw.headerWritten {
+		if err := tw.writeRow(tw.header); err != nil {
+			return err
+		}
+		tw.headerWritten = true
+	}
+	return tw.writeRow(r.row)
+}
+
+func (tw *tableWriter) writeRow(row []string) error {
+	_, err := io.WriteString(tw.w, strings.Join(row, "\t")+"\n")
+	return err
+}
+
+func (tw *tableWriter) Close() error {
+	if !tw.headerWritten {
+		if err := tw.writeRow(tw.header); err != nil {
+			return err
+		}
+	}
+	return tw.w.Flush()
+}
@@ -0,0 +1,324 @@
+// Command rawtx decodes, classifies and prints stats about raw bitcoin
+// transactions and blocks.
+//
+// Usage:
+//
+//	rawtx <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	decode    decode transactions like Bitcoin Core's decoderawtransaction
+//	stats     print stats about transactions
+//	classify  print the input and output types of transactions
+//	batch     process newline-delimited hex transactions from stdin or files
+//	block     read blocks and print a summary or per-transaction results
+//
+// Run `rawtx <command> -h` for the flags of a command.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Exit codes of the rawtx command.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const usage = `Usage: rawtx <command> [flags] [arguments]
+
+The commands are:
+
+  decode    decode transactions like Bitcoin Core's decoderawtransaction
+  stats     print stats about transactions
+  classify  print the input and output types of transactions
+  batch     process newline-delimited hex transactions from stdin or files
+  block     read blocks and print a summary or per-transaction results
+
+Run 'rawtx <command> -h' for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the rawtx command with the arguments and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case modeDecode, modeStats, modeClassify:
+		return runTx(args[0], args[1:], stdin, stdout, stderr)
+	case "batch":
+		return runBatch(args[1:], stdin, stdout, stderr)
+	case "block":
+		return runBlock(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "rawtx: unknown command %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	format  string
+	network string
+	params  *chaincfg.Params
+}
+
+func newFlagSet(name, synopsis, defaultFormat string, stderr io.Writer) (*flag.FlagSet, *options) {
+	o := &options{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.format, "format", defaultFormat, "output format: "+strings.Join(formats, ", "))
+	fs.StringVar(&o.network, "network", "mainnet", "network used for addresses: mainnet, testnet, signet or regtest")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: rawtx %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs, o
+}
+
+// parse parses the flags and validates the shared options.
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !isValidFormat(o.format) {
+		return fmt.Errorf("unknown format %q", o.format)
+	}
+	switch o.network {
+	case "mainnet":
+		o.params = &chaincfg.MainNetParams
+	case "testnet", "testnet3":
+		o.params = &chaincfg.TestNet3Params
+	case "signet":
+		o.params = &chaincfg.SigNetParams
+	case "regtest":
+		o.params = &chaincfg.RegressionNetParams
+	default:
+		return fmt.Errorf("unknown network %q", o.network)
+	}
+	return nil
+}
+
+// runTx runs the decode, stats and classify commands. The transactions are
+// passed as hex arguments or read line by line from stdin if there are none.
+func runTx(mode string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, o := newFlagSet(mode, mode+" [flags] [hex ...]", formatJSON, stderr)
+	if err := o.parse(fs, args); err != nil {
+		return usageError(stderr, err)
+	}
+
+	rawTxns := fs.Args()
+	if len(rawTxns) == 0 {
+		lines, err := readLines(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawtx: %s\n", err)
+			return exitError
+		}
+		rawTxns = lines
+	}
+
+	w := newRecordWriter(stdout, o.format, headers[mode])
+	for i, rawTx := range rawTxns {
+		tx, err := rawtx.StringToTx(rawTx)
+		if err != nil {
+			fmt.Fprintf(stderr, "rawtx: could not decode transaction %d: %s\n", i, err)
+			return exitError
+		}
+		if err := w.Write(newTxRecord(mode, &tx, o.params)); err != nil {
+			fmt.Fprintf(stderr, "rawtx: %s\n", err)
+			return exitError
+		}
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintf(stderr, "rawtx: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runBatch processes newline-delimited hex transactions from the files passed
+// as arguments or from stdin. Invalid lines are reported on stderr with their
+// position and skipped.
+func runBatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, o := newFlagSet("batch", "batch [flags] [file ...]", formatNDJSON, stderr)
+	mode := fs.String("mode", modeStats, "what to print for each transaction: decode, stats or classify")
+	if err := o.parse(fs, args); err != nil {
+		return usageError(stderr, err)
+	}
+	if _, ok := headers[*mode]; !ok || *mode == modeSummary {
+		return usageError(stderr, fmt.Errorf("unknown mode %q", *mode))
+	}
+
+	w := newRecordWriter(stdout, o.format, headers[*mode])
+	failed := false
+	process := func(name string, r io.Reader) error {
+		scanner := newLineScanner(r)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 {
+				continue
+			}
+			tx, err := rawtx.StringToTx(line)
+			if err != nil {
+				fmt.Fprintf(stderr, "rawtx: %s:%d: could not decode transaction: %s\n", name, lineNumber, err)
+				failed = true
+				continue
+			}
+			if err := w.Write(newTxRecord(*mode, &tx, o.params)); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+
+	if err := forEachInput(fs.Args(), stdin, process); err != nil {
+		fmt.Fprintf(stderr, "rawtx: %s\n", err)
+		return exitError
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintf(stderr, "rawtx: %s\n", err)
+		return exitError
+	}
+	if failed {
+		return exitError
+	}
+	return exitOK
+}
+
+// runBlock reads blocks from the files passed as arguments or from stdin. A
+// block is either hex encoded as returned by getblock with verbosity 0 or in
+// binary.
+func runBlock(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, o := newFlagSet("block", "block [flags] [file ...]", formatJSON, stderr)
+	mode := fs.String("mode", modeSummary, "what to print: summary per block or decode, stats or classify per transaction")
+	if err := o.parse(fs, args); err != nil {
+		return usageError(stderr, err)
+	}
+	if _, ok := headers[*mode]; !ok {
+		return usageError(stderr, fmt.Errorf("unknown mode %q", *mode))
+	}
+
+	w := newRecordWriter(stdout, o.format, headers[*mode])
+	process := func(name string, r io.Reader) error {
+		block, err := readBlock(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if *mode == modeSummary {
+			return w.Write(newBlockSummaryRecord(&block))
+		}
+		for i := range block.Transactions {
+			if err := w.Write(newTxRecord(*mode, &block.Transactions[i], o.params)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := forEachInput(fs.Args(), stdin, process); err != nil {
+		fmt.Fprintf(stderr, "rawtx: %s\n", err)
+		return exitError
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintf(stderr, "rawtx: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func usageError(stderr io.Writer, err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "rawtx: %s\n", err)
+	return exitUsage
+}
+
+// forEachInput calls process for each of the named files or for stdin if no
+// files are given. A file named "-" is stdin as well.
+func forEachInput(files []string, stdin io.Reader, process func(name string, r io.Reader) error) error {
+	if len(files) == 0 {
+		return process("stdin", stdin)
+	}
+	for _, name := range files {
+		if name == "-" {
+			if err := process("stdin", stdin); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = process(name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxLineLength is the maximum length of a hex encoded transaction line. It
+// fits a transaction as large as the maximum block weight.
+const maxLineLength = 2*4000000 + 2
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	return scanner
+}
+
+// readLines returns the non-empty lines read from r.
+func readLines(r io.Reader) (lines []string, err error) {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// readBlock reads a hex encoded or binary block.
+func readBlock(r io.Reader) (rawtx.Block, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return rawtx.Block{}, err
+	}
+	if s := strings.TrimSpace(string(b)); isHex(s) {
+		return rawtx.StringToBlock(s)
+	}
+	return rawtx.DeserializeBlock(b)
+}
+
+func isHex(s string) bool {
+	if len(s) == 0 || len(s)%2 != 0 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
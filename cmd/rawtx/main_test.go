@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func runWithInput(stdin string, args ...string) (stdout, stderr string, exitCode int) {
+	var outBuf, errBuf bytes.Buffer
+	exitCode = run(args, strings.NewReader(stdin), &outBuf, &errBuf)
+	return outBuf.String(), errBuf.String(), exitCode
+}
+
+func testRawTxns() (rawTxns []string) {
+	for _, testTx := range rawtx.GetTestTransactions() {
+		rawTxns = append(rawTxns, testTx.RawTx)
+	}
+	return rawTxns
+}
+
+func TestDecode(t *testing.T) {
+	rawTxns := testRawTxns()
+
+	stdout, stderr, exitCode := runWithInput("", "decode", rawTxns[0])
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %d, but got %d: %s", exitOK, exitCode, stderr)
+	}
+	var decoded rawtx.DecodedRawTx
+	if err := json.Unmarshal([]byte(stdout), &decoded); err != nil {
+		t.Fatal(err.Error())
+	}
+	tx, _ := rawtx.StringToTx(rawTxns[0])
+	if decoded.TxID != tx.TxID() {
+		t.Errorf("Expected the txid %s, but got %s", tx.TxID(), decoded.TxID)
+	}
+
+	// multiple transactions are printed as JSON array
+	stdout, _, _ = runWithInput(strings.Join(rawTxns, "\n"), "decode")
+	var decodedTxns []rawtx.DecodedRawTx
+	if err := json.Unmarshal([]byte(stdout), &decodedTxns); err != nil || len(decodedTxns) != len(rawTxns) {
+		t.Errorf("Expected a JSON array of %d transactions, but got %d (%v)", len(rawTxns), len(decodedTxns), err)
+	}
+
+	if _, _, exitCode := runWithInput("", "decode", "zz"); exitCode != exitError {
+		t.Errorf("Expected exit code %d for an invalid transaction, but got %d", exitError, exitCode)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	rawTxns := testRawTxns()
+	stdin := strings.Join(rawTxns, "\n")
+
+	stdout, stderr, exitCode := runWithInput(stdin, "stats", "-format", "ndjson")
+	if exitCode != exitOK {
+		t.Fatalf("Expected exit code %d, but got %d: %s", exitOK, exitCode, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != len(rawTxns) {
+		t.Fatalf("Expected %d NDJSON lines, but got %d", len(rawTxns), len(lines))
+	}
+	var stats rawtx.TxStats
+	if err := json.Unmarshal([]byte(lines[0]), &stats); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	stdout, _, _ = runWithInput(stdin, "classify", "-format", "csv")
+	rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(rows) != len(rawTxns)+1 || strings.Join(rows[0], ",") != "txid,input_types,output_types" {
+		t.Errorf("Expected a CSV header and %d rows, but got %v", len(rawTxns), rows)
+	}
+
+	stdout, _, _ = runWithInput(stdin, "decode", "-format", "table")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != len(rawTxns)+1 || !strings.HasPrefix(lines[0], "txid  ") {
+		t.Errorf("Expected a table header and %d rows, but got %s", len(rawTxns), stdout)
+	}
+
+	if _, _, exitCode := runWithInput(stdin, "stats", "-format", "xml"); exitCode != exitUsage {
+		t.Errorf("Expected exit code %d for an unknown format, but got %d", exitUsage, exitCode)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	rawTxns := testRawTxns()
+	dir, err := ioutil.TempDir("", "rawtx")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "txns.txt")
+	content := rawTxns[0] + "\n\nnot-hex\n" + rawTxns[1] + "\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	stdout, stderr, exitCode := runWithInput(rawTxns[2], "batch", "-mode", "classify", file, "-")
+	if exitCode != exitError {
+		t.Errorf("Expected exit code %d for an invalid line, but got %d", exitError, exitCode)
+	}
+	if !strings.Contains(stderr, file+":3:") {
+		t.Errorf("Expected the invalid line to be reported, but got %s", stderr)
+	}
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 3 {
+		t.Errorf("Expected the three valid transactions to be processed, but got %s", stdout)
+	}
+
+	if _, _, exitCode := runWithInput("", "batch", "-mode", "summary"); exitCode != exitUsage {
+		t.Errorf("Expected exit code %d for the summary mode, but got %d", exitUsage, exitCode)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, stdin := range []string{hex.EncodeToString(genesis.Bytes()) + "\n", genesis.String()} {
+		stdout, stderr, exitCode := runWithInput(stdin, "block")
+		if exitCode != exitOK {
+			t.Fatalf("Expected exit code %d, but got %d: %s", exitOK, exitCode, stderr)
+		}
+		var summary BlockSummary
+		if err := json.Unmarshal([]byte(stdout), &summary); err != nil {
+			t.Fatal(err.Error())
+		}
+		if summary.Hash.String() != "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f" || summary.Txns != 1 || summary.Bits != "1d00ffff" || summary.OutAmount != 5000000000 {
+			t.Errorf("Expected the summary of the genesis block, but got %+v", summary)
+		}
+	}
+
+	stdout, _, _ := runWithInput(genesis.String(), "block", "-mode", "classify", "-format", "ndjson")
+	if strings.TrimSpace(stdout) != `{"TxID":"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b","InputTypes":["COINBASE"],"OutputTypes":["P2PK"]}` {
+		t.Errorf("Expected the classification of the genesis coinbase, but got %s", stdout)
+	}
+
+	if _, _, exitCode := runWithInput("00", "block"); exitCode != exitError {
+		t.Errorf("Expected exit code %d for an invalid block, but got %d", exitError, exitCode)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if _, _, exitCode := runWithInput(""); exitCode != exitUsage {
+		t.Errorf("Expected exit code %d without a command, but got %d", exitUsage, exitCode)
+	}
+	if _, _, exitCode := runWithInput("", "foo"); exitCode != exitUsage {
+		t.Errorf("Expected exit code %d for an unknown command, but got %d", exitUsage, exitCode)
+	}
+	if _, _, exitCode := runWithInput("", "decode", "-network", "foo"); exitCode != exitUsage {
+		t.Errorf("Expected exit code %d for an unknown network, but got %d", exitUsage, exitCode)
+	}
+	if _, _, exitCode := runWithInput("", "stats", "-h"); exitCode != exitOK {
+		t.Errorf("Expected exit code %d for -h, but got %d", exitOK, exitCode)
+	}
+}
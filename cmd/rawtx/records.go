@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// The modes select what is printed for a transaction or block.
+const (
+	modeDecode   = "decode"
+	modeStats    = "stats"
+	modeClassify = "classify"
+	modeSummary  = "summary"
+)
+
+// headers are the CSV and table column names of the records of each mode.
+var headers = map[string][]string{
+	modeDecode:   {"txid", "hash", "version", "size", "vsize", "weight", "locktime", "vin", "vout"},
+	modeStats:    {"txid", "version", "size", "vsize", "inputs", "outputs", "out_amount", "fee", "is_coinbase", "spends_segwit", "spends_taproot", "signals_rbf", "bip69", "locktime"},
+	modeClassify: {"txid", "input_types", "output_types"},
+	modeSummary:  {"hash", "prev_block", "time", "size", "stripped_size", "weight", "txns", "out_amount"},
+}
+
+// record is a result marshalled as JSON or written as a row of columns.
+type record struct {
+	value interface{}
+	row   []string
+}
+
+// Classification lists the input and output types of a transaction.
+type Classification struct {
+	TxID        rawtx.Hash
+	InputTypes  []rawtx.InputType
+	OutputTypes []rawtx.OutputType
+}
+
+// BlockSummary summarizes a block.
+type BlockSummary struct {
+	Hash         rawtx.Hash
+	PrevBlock    rawtx.Hash
+	MerkleRoot   rawtx.Hash
+	Version      int32
+	Time         uint32
+	Bits         string
+	Nonce        uint32
+	Size         int
+	StrippedSize int
+	Weight       int
+	Txns         int
+	OutAmount    int64
+}
+
+func newTxRecord(mode string, tx *rawtx.Tx, params *chaincfg.Params) record {
+	switch mode {
+	case modeDecode:
+		decoded := tx.DecodeRaw(params)
+		return record{
+			value: decoded,
+			row: []string{
+				decoded.TxID.String(), decoded.Hash.String(), fmt.Sprint(decoded.Version), strconv.Itoa(decoded.Size),
+				strconv.Itoa(decoded.VSize), strconv.Itoa(decoded.Weight), fmt.Sprint(decoded.Locktime),
+				strconv.Itoa(len(decoded.Vin)), strconv.Itoa(len(decoded.Vout)),
+			},
+		}
+	case modeStats:
+		stats := tx.Stats()
+		fee := ""
+		if f, ok := tx.GetFee(); ok {
+			fee = strconv.FormatInt(f, 10)
+		}
+		return record{
+			value: stats,
+			row: []string{
+				stats.TxID.String(), fmt.Sprint(stats.Version), strconv.Itoa(stats.Size), strconv.Itoa(stats.VSize),
+				strconv.Itoa(len(stats.InStats)), strconv.Itoa(len(stats.OutStats)), strconv.FormatInt(stats.OutAmount, 10), fee,
+				strconv.FormatBool(stats.IsCoinbase), strconv.FormatBool(stats.IsSpendingSegWit), strconv.FormatBool(stats.IsSpendingTaproot),
+				strconv.FormatBool(stats.IsExplicitlyRBFSignaling), strconv.FormatBool(stats.IsBIP69Compliant), fmt.Sprint(stats.Locktime.Locktime),
+			},
+		}
+	}
+
+	c := Classification{TxID: tx.TxID()}
+	inputTypes := make([]string, 0, len(tx.Inputs))
+	for i := range tx.Inputs {
+		inputType := tx.Inputs[i].GetType()
+		c.InputTypes = append(c.InputTypes, inputType)
+		inputTypes = append(inputTypes, inputType.String())
+	}
+	outputTypes := make([]string, 0, len(tx.Outputs))
+	for i := range tx.Outputs {
+		outputType := tx.Outputs[i].GetType()
+		c.OutputTypes = append(c.OutputTypes, outputType)
+		outputTypes = append(outputTypes, outputType.String())
+	}
+	return record{
+		value: c,
+		row:   []string{c.TxID.String(), strings.Join(inputTypes, ";"), strings.Join(outputTypes, ";")},
+	}
+}
+
+func newBlockSummaryRecord(block *rawtx.Block) record {
+	s := BlockSummary{
+		Hash:         block.Hash,
+		PrevBlock:    block.Header.PrevBlock,
+		MerkleRoot:   block.Header.MerkleRoot,
+		Version:      block.Header.Version,
+		Time:         block.Header.Timestamp,
+		Bits:         fmt.Sprintf("%08x", block.Header.Bits),
+		Nonce:        block.Header.Nonce,
+		Size:         block.GetSize(),
+		StrippedSize: block.GetStrippedSize(),
+		Weight:       block.GetWeight(),
+		Txns:         len(block.Transactions),
+	}
+	for i := range block.Transactions {
+		s.OutAmount += block.Transactions[i].GetOutputSum()
+	}
+	return record{
+		value: s,
+		row: []string{
+			s.Hash.String(), s.PrevBlock.String(), strconv.FormatUint(uint64(s.Time), 10), strconv.Itoa(s.Size),
+			strconv.Itoa(s.StrippedSize), strconv.Itoa(s.Weight), strconv.Itoa(s.Txns), strconv.FormatInt(s.OutAmount, 10),
+		},
+	}
+}
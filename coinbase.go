@@ -0,0 +1,255 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// MergeMiningType defines the type of a merge-mining commitment
+type MergeMiningType int
+
+// Merge-mining commitments found in coinbase transactions
+const (
+	// MergeMiningAuxPoW is the auxiliary proof-of-work commitment in the
+	// scriptSig used by Namecoin and other AuxPoW chains.
+	MergeMiningAuxPoW MergeMiningType = iota + 1
+	// MergeMiningRSK is the RSK (Rootstock) block hash commitment in an
+	// OP_RETURN output.
+	MergeMiningRSK
+)
+
+var mergeMiningTypeStringMap = map[MergeMiningType]string{
+	MergeMiningAuxPoW: "AuxPoW",
+	MergeMiningRSK:    "RSK",
+}
+
+func (mmt MergeMiningType) String() string {
+	return mergeMiningTypeStringMap[mmt]
+}
+
+// BIP34HeightActivation is the mainnet height from which on the block height
+// is required at the start of the coinbase scriptSig by BIP34.
+const BIP34HeightActivation = 227931
+
+// minCoinbaseTagLength is the minimum length of a printable ASCII run in the
+// coinbase scriptSig to be reported as tag.
+const minCoinbaseTagLength = 4
+
+var (
+	// witnessCommitmentHeader is OP_RETURN, a 36 byte push and the BIP141
+	// commitment header 0xaa21a9ed.
+	witnessCommitmentHeader = []byte{byte(OpRETURN), byte(OpDATA36), 0xaa, 0x21, 0xa9, 0xed}
+	// auxPoWMagic is the marker before the merged mining merkle root of AuxPoW
+	// chains in the coinbase scriptSig.
+	auxPoWMagic = []byte{0xfa, 0xbe, 'm', 'm'}
+	// rskTag is the prefix of the RSK block hash in an OP_RETURN output.
+	rskTag = []byte("RSKBLOCK:")
+)
+
+// Coinbase is a decoded view of a coinbase transaction.
+type Coinbase struct {
+	Tx *Tx
+	// Height is the block height encoded at the start of the scriptSig as
+	// required by BIP34. HasHeight is false if the scriptSig doesn't start
+	// with a minimally encoded non-negative number. Coinbases of blocks before
+	// BIP34 activation can start with any data, for them the height is
+	// meaningless.
+	Height    int64
+	HasHeight bool
+	// Extranonce is the part of the scriptSig after the height, which holds
+	// the extranonce and tags of the miner. It's the complete scriptSig if it
+	// has no height.
+	Extranonce []byte
+	// Tags are the runs of printable ASCII characters in the Extranonce.
+	Tags []string
+	// WitnessReservedValue is the single 32 byte witness element of the
+	// coinbase input used for the witness commitment. It's nil if the input
+	// has no such witness.
+	WitnessReservedValue []byte
+	// WitnessCommitment is the 32 byte commitment to the witness merkle root
+	// in the output with the index WitnessCommitmentIndex. It's nil and the
+	// index is -1 if the coinbase has no witness commitment.
+	WitnessCommitment      []byte
+	WitnessCommitmentIndex int
+	MergeMining            []MergeMiningCommitment
+}
+
+// MergeMiningCommitment is a commitment to a block of another chain that is
+// merge-mined.
+type MergeMiningCommitment struct {
+	Type MergeMiningType
+	// Hash is the committed hash as found in the coinbase: the merkle root of
+	// the merge-mined chains for AuxPoW, the block hash for RSK.
+	Hash []byte
+	// OutputIndex is the index of the output with the commitment or -1 if
+	// the commitment is in the scriptSig.
+	OutputIndex int
+	// MerkleSize and MerkleNonce follow the merkle root of an AuxPoW
+	// commitment. They are zero if the scriptSig ends after the root.
+	MerkleSize  uint32
+	MerkleNonce uint32
+}
+
+// DecodeCoinbase returns a decoded view of the coinbase transaction. False is
+// returned if the transaction is not a coinbase.
+func (tx *Tx) DecodeCoinbase() (*Coinbase, bool) {
+	if !tx.IsCoinbase() {
+		return nil, false
+	}
+	in := &tx.Inputs[0]
+	cb := &Coinbase{Tx: tx, Extranonce: in.ScriptSig, WitnessCommitmentIndex: -1}
+
+	if height, n, ok := bip34Height(in.ScriptSig); ok {
+		cb.Height, cb.HasHeight = height, true
+		cb.Extranonce = in.ScriptSig[n:]
+	}
+	cb.Tags = coinbaseTags(cb.Extranonce)
+
+	if len(in.Witness) == 1 && len(in.Witness[0].PushedData) == 32 {
+		cb.WitnessReservedValue = in.Witness[0].PushedData
+	}
+	if i := tx.witnessCommitmentIndex(); i >= 0 {
+		cb.WitnessCommitmentIndex = i
+		cb.WitnessCommitment = tx.Outputs[i].ScriptPubKey[len(witnessCommitmentHeader) : len(witnessCommitmentHeader)+32]
+	}
+
+	if i := bytes.Index(in.ScriptSig, auxPoWMagic); i >= 0 && len(in.ScriptSig) >= i+len(auxPoWMagic)+32 {
+		start := i + len(auxPoWMagic)
+		commitment := MergeMiningCommitment{Type: MergeMiningAuxPoW, Hash: in.ScriptSig[start : start+32], OutputIndex: -1}
+		commitment.MerkleSize, commitment.MerkleNonce, _ = auxPoWMerkleParams(in.ScriptSig, start+32)
+		cb.MergeMining = append(cb.MergeMining, commitment)
+	}
+	for i := range tx.Outputs {
+		if hash, ok := rskCommitment(tx.Outputs[i].ScriptPubKey); ok {
+			cb.MergeMining = append(cb.MergeMining, MergeMiningCommitment{Type: MergeMiningRSK, Hash: hash, OutputIndex: i})
+		}
+	}
+	return cb, true
+}
+
+// DecodeCoinbase returns a decoded view of the coinbase transaction of the
+// block. The height is only decoded for blocks with version 2 or higher as
+// defined in BIP34. False is returned if the block has no coinbase.
+func (b *Block) DecodeCoinbase() (*Coinbase, bool) {
+	tx, ok := b.Coinbase()
+	if !ok {
+		return nil, false
+	}
+	cb, _ := tx.DecodeCoinbase()
+	if b.Header.Version < 2 && cb.HasHeight {
+		cb.Height, cb.HasHeight = 0, false
+		cb.Extranonce = tx.Inputs[0].ScriptSig
+		cb.Tags = coinbaseTags(cb.Extranonce)
+	}
+	return cb, true
+}
+
+// HasWitnessCommitment returns true if the coinbase commits to the witnesses
+// of the block.
+func (cb *Coinbase) HasWitnessCommitment() bool {
+	return cb.WitnessCommitmentIndex >= 0
+}
+
+// bip34Height returns the height pushed at the start of the coinbase
+// scriptSig and the length of the push. Like Bitcoin Core, only a minimally
+// encoded push is accepted.
+func bip34Height(scriptSig BitcoinScript) (height int64, n int, ok bool) {
+	if len(scriptSig) == 0 {
+		return 0, 0, false
+	}
+	opCode, data, remainder, ok := nextScriptOp(scriptSig)
+	if !ok {
+		return 0, 0, false
+	}
+	poc := ParsedOpCode{OpCode: opCode, PushedData: data}
+	height, ok = poc.scriptNum(5)
+	if !ok || height < 0 {
+		return 0, 0, false
+	}
+	n = len(scriptSig) - len(remainder)
+	if !bytes.Equal(appendScriptNum(nil, height), scriptSig[:n]) {
+		return 0, 0, false
+	}
+	return height, n, true
+}
+
+// coinbaseTags returns the tags in the extranonce. If it only consists of
+// pushes, as most coinbase scriptSigs do, the tags are searched in the pushed
+// data. Otherwise, the raw bytes are searched.
+func coinbaseTags(extranonce []byte) (tags []string) {
+	var pushes [][]byte
+	for s := BitcoinScript(extranonce); len(s) > 0; {
+		opCode, data, remainder, ok := nextScriptOp(s)
+		if !ok || opCode > Op16 {
+			return asciiTags(extranonce)
+		}
+		pushes = append(pushes, data)
+		s = remainder
+	}
+	for _, data := range pushes {
+		tags = append(tags, asciiTags(data)...)
+	}
+	return tags
+}
+
+// asciiTags returns the runs of at least minCoinbaseTagLength printable ASCII
+// characters in b with surrounding whitespace removed. Pushes of 32 to 75
+// bytes have a printable length byte, which is dropped if it pushes exactly
+// the rest of the run.
+func asciiTags(b []byte) (tags []string) {
+	start := -1
+	for i := 0; i <= len(b); i++ {
+		if i < len(b) && b[i] >= 0x20 && b[i] <= 0x7e {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			if OpCode(b[start]) <= OpDATA75 && i-start-1 == int(b[start]) {
+				start++
+			}
+			if tag := strings.TrimSpace(string(b[start:i])); len(tag) >= minCoinbaseTagLength {
+				tags = append(tags, tag)
+			}
+			start = -1
+		}
+	}
+	return tags
+}
+
+// witnessCommitmentIndex returns the index of the output with the witness
+// commitment. As defined in BIP141, the output with the highest index is used
+// if there are multiple. -1 is returned if there is none.
+func (tx *Tx) witnessCommitmentIndex() int {
+	for i := len(tx.Outputs) - 1; i >= 0; i-- {
+		script := tx.Outputs[i].ScriptPubKey
+		if len(script) >= len(witnessCommitmentHeader)+32 && bytes.HasPrefix(script, witnessCommitmentHeader) {
+			return i
+		}
+	}
+	return -1
+}
+
+// rskCommitment returns the RSK block hash committed to in an OP_RETURN
+// output.
+func rskCommitment(script BitcoinScript) ([]byte, bool) {
+	if len(script) < 2 || OpCode(script[0]) != OpRETURN {
+		return nil, false
+	}
+	_, data, _, ok := nextScriptOp(script[1:])
+	if !ok || len(data) != len(rskTag)+32 || !bytes.HasPrefix(data, rskTag) {
+		return nil, false
+	}
+	return data[len(rskTag):], true
+}
+
+// auxPoWMerkleParams returns the merkle tree size and nonce following the
+// AuxPoW merkle root in the scriptSig, if present.
+func auxPoWMerkleParams(scriptSig BitcoinScript, rootEnd int) (size, nonce uint32, ok bool) {
+	if len(scriptSig) < rootEnd+8 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(scriptSig[rootEnd:]), binary.LittleEndian.Uint32(scriptSig[rootEnd+4:]), true
+}
@@ -0,0 +1,168 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testCoinbase returns a coinbase with a BIP34 height, a pool tag, an AuxPoW
+// and a RSK commitment and a witness commitment.
+func testCoinbase(t *testing.T, height int64) Tx {
+	scriptSig := appendScriptNum(nil, height)
+	scriptSig = appendDataPush(scriptSig, []byte("/Example Pool/"))
+	auxPoW := append([]byte{0xfa, 0xbe, 'm', 'm'}, bytes.Repeat([]byte{0xaa}, 32)...)
+	auxPoW = append(auxPoW, 1, 0, 0, 0, 7, 0, 0, 0)
+	scriptSig = appendDataPush(scriptSig, auxPoW)
+	scriptSig = append(scriptSig, 0x08, 1, 2, 3, 4, 5, 6, 7, 8)
+
+	wireTx := wire.NewMsgTx(2)
+	reserved := make([]byte, 32)
+	wireTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), scriptSig, wire.TxWitness{reserved}))
+	wireTx.AddTxOut(wire.NewTxOut(625000000, append([]byte{0x00, 0x14}, make([]byte, 20)...)))
+	rsk := appendDataPush([]byte{byte(OpRETURN)}, append([]byte("RSKBLOCK:"), bytes.Repeat([]byte{0xbb}, 32)...))
+	wireTx.AddTxOut(wire.NewTxOut(0, rsk))
+	commitment := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, bytes.Repeat([]byte{0xcc}, 32)...)
+	wireTx.AddTxOut(wire.NewTxOut(0, commitment))
+
+	var raw bytes.Buffer
+	if err := wireTx.Serialize(&raw); err != nil {
+		t.Fatal(err.Error())
+	}
+	tx, err := DeserializeTx(raw.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return tx
+}
+
+func TestDecodeCoinbase(t *testing.T) {
+	tx := testCoinbase(t, 700000)
+	cb, ok := tx.DecodeCoinbase()
+	if !ok {
+		t.Fatal("Expected the coinbase to be decoded")
+	}
+	if !cb.HasHeight || cb.Height != 700000 {
+		t.Errorf("Expected the height 700000, but got %d (%t)", cb.Height, cb.HasHeight)
+	}
+	if !bytes.Equal(cb.Extranonce, tx.Inputs[0].ScriptSig[4:]) {
+		t.Errorf("Expected the extranonce after the height push, but got %x", cb.Extranonce)
+	}
+	if !reflect.DeepEqual(cb.Tags, []string{"/Example Pool/"}) {
+		t.Errorf("Expected the pool tag, but got %q", cb.Tags)
+	}
+	if !bytes.Equal(cb.WitnessReservedValue, make([]byte, 32)) {
+		t.Errorf("Expected a zero witness reserved value, but got %x", cb.WitnessReservedValue)
+	}
+	if !cb.HasWitnessCommitment() || cb.WitnessCommitmentIndex != 2 || !bytes.Equal(cb.WitnessCommitment, bytes.Repeat([]byte{0xcc}, 32)) {
+		t.Errorf("Expected the witness commitment in output 2, but got %x in %d", cb.WitnessCommitment, cb.WitnessCommitmentIndex)
+	}
+
+	expected := []MergeMiningCommitment{
+		{Type: MergeMiningAuxPoW, Hash: bytes.Repeat([]byte{0xaa}, 32), OutputIndex: -1, MerkleSize: 1, MerkleNonce: 7},
+		{Type: MergeMiningRSK, Hash: bytes.Repeat([]byte{0xbb}, 32), OutputIndex: 1},
+	}
+	if !reflect.DeepEqual(cb.MergeMining, expected) {
+		t.Errorf("Expected the merge-mining commitments %+v, but got %+v", expected, cb.MergeMining)
+	}
+	if MergeMiningAuxPoW.String() != "AuxPoW" || MergeMiningRSK.String() != "RSK" {
+		t.Errorf("Expected the merge-mining types AuxPoW and RSK, but got %s and %s", MergeMiningAuxPoW, MergeMiningRSK)
+	}
+
+	rawTx, err := hex.DecodeString(GetTestTransactions()[0].RawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	nonCoinbase, err := DeserializeTx(rawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := nonCoinbase.DecodeCoinbase(); ok {
+		t.Error("Expected a non-coinbase transaction not to be decoded")
+	}
+}
+
+func TestBIP34Height(t *testing.T) {
+	heights := []int64{0, 1, 16, 17, 127, 128, 255, 256, 227931, 8388607, 8388608, 1 << 31}
+	for _, height := range heights {
+		scriptSig := appendScriptNum(nil, height)
+		if got, n, ok := bip34Height(append(scriptSig, 0xff)); !ok || got != height || n != len(scriptSig) {
+			t.Errorf("Expected the height %d, but got %d with %d bytes (%t)", height, got, n, ok)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"empty":            {},
+		"negative":         {byte(Op1NEGATE)},
+		"non-minimal":      {0x02, 0x01, 0x00},
+		"push of 1":        {0x01, 0x01},
+		"truncated":        {0x03, 0x01},
+		"too long":         {0x06, 1, 2, 3, 4, 5, 6},
+		"non-push opcode":  {byte(OpRETURN)},
+		"pushdata1 number": {byte(OpPUSHDATA1), 0x01, 0x11},
+	}
+	for name, scriptSig := range invalid {
+		if height, _, ok := bip34Height(scriptSig); ok {
+			t.Errorf("Expected no height for a %s scriptSig, but got %d", name, height)
+		}
+	}
+}
+
+func TestDecodeCoinbaseGenesis(t *testing.T) {
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+	block, err := DeserializeBlock(genesis.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the genesis scriptSig starts with the difficulty bits, which are only
+	// interpreted as height by the transaction view
+	txView, _ := block.Transactions[0].DecodeCoinbase()
+	if !txView.HasHeight || txView.Height != 0x1d00ffff {
+		t.Errorf("Expected the bits 0x1d00ffff as height of the transaction, but got %x", txView.Height)
+	}
+	cb, ok := block.DecodeCoinbase()
+	if !ok {
+		t.Fatal("Expected the genesis coinbase to be decoded")
+	}
+	if cb.HasHeight || !bytes.Equal(cb.Extranonce, block.Transactions[0].Inputs[0].ScriptSig) {
+		t.Errorf("Expected no height for a version 1 block, but got %d", cb.Height)
+	}
+	expectedTags := []string{"The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"}
+	if !reflect.DeepEqual(cb.Tags, expectedTags) {
+		t.Errorf("Expected the tags %q, but got %q", expectedTags, cb.Tags)
+	}
+	if cb.HasWitnessCommitment() || cb.WitnessReservedValue != nil || len(cb.MergeMining) != 0 {
+		t.Errorf("Expected no commitments in the genesis coinbase, but got %+v", cb)
+	}
+}
+
+func TestWitnessCommitmentIndex(t *testing.T) {
+	tx := testCoinbase(t, 1)
+	// a second commitment in a later output takes precedence
+	second := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, bytes.Repeat([]byte{0xdd}, 32)...)
+	tx.Outputs = append(tx.Outputs, *NewOutput(0, append(second, 0x01)), *NewOutput(0, second[:37]))
+	cb, _ := tx.DecodeCoinbase()
+	if cb.WitnessCommitmentIndex != 3 || cb.WitnessCommitment[0] != 0xdd {
+		t.Errorf("Expected the commitment in output 3, but got %d", cb.WitnessCommitmentIndex)
+	}
+}
+
+func TestAsciiTags(t *testing.T) {
+	scriptSig := []byte{0x03, 0x01, 0x02, 0x03}
+	scriptSig = append(scriptSig, "  Mined by someone  "...)
+	scriptSig = append(scriptSig, 0x00, 'a', 'b', 'c', 0x00, 0x25)
+	scriptSig = append(scriptSig, bytes.Repeat([]byte{'x'}, 0x24)...)
+	tags := asciiTags(scriptSig)
+	if !reflect.DeepEqual(tags, []string{"Mined by someone", "%" + string(bytes.Repeat([]byte{'x'}, 0x24))}) {
+		t.Errorf("Expected two tags, but got %q", tags)
+	}
+}
@@ -0,0 +1,314 @@
+// Package corerpc is a minimal Bitcoin Core JSON-RPC client returning rawtx
+// transactions and blocks.
+package corerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/0xb10c/rawtx"
+)
+
+// Bitcoin Core RPC error codes used by this package.
+const (
+	ErrCodeMethodNotFound = -32601
+	// ErrCodeInvalidAddressOrKey is returned for unknown transactions and
+	// blocks.
+	ErrCodeInvalidAddressOrKey = -5
+)
+
+// ErrUnauthorized is returned if the node rejected the RPC credentials.
+var ErrUnauthorized = errors.New("RPC authentication failed")
+
+// RPCError is an error returned by the node.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Client is a Bitcoin Core JSON-RPC client. It's safe for concurrent use.
+type Client struct {
+	// URL of the RPC server, e.g. http://127.0.0.1:8332.
+	URL      string
+	User     string
+	Password string
+	// HTTPClient is used for the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	nextID uint64
+}
+
+// NewClient returns a client for the RPC server at url authenticating with
+// the user and password.
+func NewClient(url, user, password string) *Client {
+	return &Client{URL: url, User: user, Password: password}
+}
+
+// NewCookieClient returns a client for the RPC server at url authenticating
+// with the .cookie file written by the node.
+func NewCookieClient(url, cookieFile string) (*Client, error) {
+	cookie, err := os.ReadFile(cookieFile)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(cookie)), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cookie file %s", cookieFile)
+	}
+	return NewClient(url, parts[0], parts[1]), nil
+}
+
+type request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+	ID     uint64          `json:"id"`
+}
+
+// Call calls the RPC method with the params and unmarshals the result into
+// result, which can be nil if the result isn't needed.
+func (c *Client) Call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+
+	body, err := json.Marshal(request{JSONRPC: "1.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.User, c.Password)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpResp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	// Bitcoin Core responds to failed calls with a HTTP error status and the
+	// RPC error in the body
+	var resp response
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("%s: unexpected HTTP response %s", method, httpResp.Status)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.ID != id {
+		return fmt.Errorf("%s: expected the response id %d, but got %d", method, id, resp.ID)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// callHex calls a method returning hex encoded data.
+func (c *Client) callHex(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
+	var s string
+	if err := c.Call(ctx, method, params, &s); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(s)
+}
+
+// GetRawTransactionBytes returns the serialized transaction with the txid.
+// Transactions that aren't in the mempool require the node to run with
+// -txindex.
+func (c *Client) GetRawTransactionBytes(ctx context.Context, txid rawtx.Hash) ([]byte, error) {
+	return c.callHex(ctx, "getrawtransaction", txid.String(), false)
+}
+
+// GetRawTransaction returns the transaction with the txid. Transactions that
+// aren't in the mempool require the node to run with -txindex.
+func (c *Client) GetRawTransaction(ctx context.Context, txid rawtx.Hash) (*rawtx.Tx, error) {
+	raw, err := c.GetRawTransactionBytes(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := rawtx.DeserializeTx(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// GetBlockBytes returns the serialized block with the hash.
+func (c *Client) GetBlockBytes(ctx context.Context, hash rawtx.Hash) ([]byte, error) {
+	return c.callHex(ctx, "getblock", hash.String(), 0)
+}
+
+// GetBlock returns the block with the hash.
+func (c *Client) GetBlock(ctx context.Context, hash rawtx.Hash) (*rawtx.Block, error) {
+	raw, err := c.GetBlockBytes(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	block, err := rawtx.DeserializeBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// GetRawMempool returns the txids of the transactions in the mempool.
+func (c *Client) GetRawMempool(ctx context.Context) ([]rawtx.Hash, error) {
+	var txids []rawtx.Hash
+	if err := c.Call(ctx, "getrawmempool", []interface{}{false}, &txids); err != nil {
+		return nil, err
+	}
+	return txids, nil
+}
+
+// TxOut is an unspent transaction output as returned by gettxout.
+type TxOut struct {
+	BestBlock     rawtx.Hash
+	Confirmations int64
+	Coinbase      bool
+	Output        *rawtx.Output
+}
+
+type txOutResult struct {
+	BestBlock     rawtx.Hash                `json:"bestblock"`
+	Confirmations int64                     `json:"confirmations"`
+	Value         rawtx.BTCAmount           `json:"value"`
+	ScriptPubKey  rawtx.DecodedScriptPubKey `json:"scriptPubKey"`
+	Coinbase      bool                      `json:"coinbase"`
+}
+
+// GetTxOut returns the unspent output at the outpoint. Outputs spent in the
+// mempool are considered as spent if includeMempool is set.
+// rawtx.ErrPrevoutNotFound is returned if the output is spent or unknown.
+func (c *Client) GetTxOut(ctx context.Context, outpoint rawtx.Outpoint, includeMempool bool) (*TxOut, error) {
+	var result *txOutResult
+	params := []interface{}{outpoint.PrevTxHash.String(), outpoint.OutputIndex, includeMempool}
+	if err := c.Call(ctx, "gettxout", params, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, rawtx.ErrPrevoutNotFound
+	}
+	scriptPubKey, err := hex.DecodeString(result.ScriptPubKey.Hex)
+	if err != nil {
+		return nil, err
+	}
+	return &TxOut{
+		BestBlock:     result.BestBlock,
+		Confirmations: result.Confirmations,
+		Coinbase:      result.Coinbase,
+		Output:        rawtx.NewOutput(int64(result.Value), scriptPubKey),
+	}, nil
+}
+
+// FetchPrevout implements rawtx.PrevoutFetcher. Unspent outputs are looked up
+// with gettxout, spent outputs from the transaction creating them, which
+// requires the node to run with -txindex for confirmed transactions.
+func (c *Client) FetchPrevout(ctx context.Context, outpoint rawtx.Outpoint) (*rawtx.Output, error) {
+	txOut, err := c.GetTxOut(ctx, outpoint, true)
+	if err == nil {
+		return txOut.Output, nil
+	} else if err != rawtx.ErrPrevoutNotFound {
+		return nil, err
+	}
+
+	tx, err := c.GetRawTransaction(ctx, outpoint.PrevTxHash)
+	if rpcErr, ok := err.(*RPCError); ok && rpcErr.Code == ErrCodeInvalidAddressOrKey {
+		return nil, rawtx.ErrPrevoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if int(outpoint.OutputIndex) >= len(tx.Outputs) {
+		return nil, rawtx.ErrPrevoutNotFound
+	}
+	return &tx.Outputs[outpoint.OutputIndex], nil
+}
+
+// TxSource returns a rawtx.Source of the transactions with the txids, e.g.
+// the txids returned by GetRawMempool. Transactions that were removed from
+// the mempool in the meantime are skipped.
+func (c *Client) TxSource(txids []rawtx.Hash) rawtx.Source {
+	return &txSource{client: c, txids: txids}
+}
+
+type txSource struct {
+	client *Client
+	txids  []rawtx.Hash
+}
+
+func (s *txSource) Next(ctx context.Context) (rawtx.Item, error) {
+	for len(s.txids) > 0 {
+		txid := s.txids[0]
+		s.txids = s.txids[1:]
+		raw, err := s.client.GetRawTransactionBytes(ctx, txid)
+		if rpcErr, ok := err.(*RPCError); ok && rpcErr.Code == ErrCodeInvalidAddressOrKey {
+			continue
+		} else if err != nil {
+			return rawtx.Item{}, err
+		}
+		return rawtx.Item{Raw: raw}, nil
+	}
+	return rawtx.Item{}, io.EOF
+}
+
+// BlockSource returns a rawtx.Source of the blocks with the hashes.
+func (c *Client) BlockSource(hashes []rawtx.Hash) rawtx.Source {
+	return &blockSource{client: c, hashes: hashes}
+}
+
+type blockSource struct {
+	client *Client
+	hashes []rawtx.Hash
+}
+
+func (s *blockSource) Next(ctx context.Context) (rawtx.Item, error) {
+	if len(s.hashes) == 0 {
+		return rawtx.Item{}, io.EOF
+	}
+	hash := s.hashes[0]
+	s.hashes = s.hashes[1:]
+	raw, err := s.client.GetBlockBytes(ctx, hash)
+	if err != nil {
+		return rawtx.Item{}, err
+	}
+	return rawtx.Item{Raw: raw, IsBlock: true}, nil
+}
@@ -0,0 +1,206 @@
+package corerpc_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/corerpc"
+	"github.com/0xb10c/rawtx/corerpc/corerpctest"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	coinbaseValue = 50 * 100000000
+	spendFee      = 10000
+)
+
+var p2wpkhScript = append([]byte{0x00, 0x14}, bytes.Repeat([]byte{0xab}, 20)...)
+
+// testChain returns a raw block with a coinbase transaction and a raw
+// transaction spending the coinbase output.
+func testChain(t *testing.T) (rawBlock, rawSpend []byte) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), []byte{0x01, 0x01}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(coinbaseValue, p2wpkhScript))
+
+	coinbaseHash := coinbase.TxHash()
+	spend := wire.NewMsgTx(2)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&coinbaseHash, 0), nil, wire.TxWitness{bytes.Repeat([]byte{0x30}, 71), bytes.Repeat([]byte{0x02}, 33)}))
+	spend.AddTxOut(wire.NewTxOut(coinbaseValue-spendFee, p2wpkhScript))
+
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0x207fffff, 0))
+	block.AddTransaction(coinbase)
+
+	var blockBuf, spendBuf bytes.Buffer
+	if err := block.Serialize(&blockBuf); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := spend.Serialize(&spendBuf); err != nil {
+		t.Fatal(err.Error())
+	}
+	return blockBuf.Bytes(), spendBuf.Bytes()
+}
+
+func newTestNode(t *testing.T) (node *corerpctest.Node, block rawtx.Block, spend rawtx.Tx) {
+	rawBlock, rawSpend := testChain(t)
+	node = corerpctest.NewNode("user", "password")
+	node.TxIndex = true
+	if err := node.AddBlock(rawBlock); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := node.AddTx(rawSpend); err != nil {
+		t.Fatal(err.Error())
+	}
+	block, _ = rawtx.DeserializeBlock(rawBlock)
+	spend, _ = rawtx.DeserializeTx(rawSpend)
+	return node, block, spend
+}
+
+func TestClient(t *testing.T) {
+	node, block, spend := newTestNode(t)
+	defer node.Close()
+	client := node.Client()
+	ctx := context.Background()
+	coinbaseOutpoint := rawtx.Outpoint{PrevTxHash: block.Transactions[0].Hash}
+
+	gotBlock, err := client.GetBlock(ctx, block.Hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if gotBlock.Hash != block.Hash || len(gotBlock.Transactions) != 1 || gotBlock.Transactions[0].TxID() != coinbaseOutpoint.PrevTxHash {
+		t.Errorf("Expected the block %s, but got %+v", block.Hash, gotBlock)
+	}
+
+	mempool, err := client.GetRawMempool(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(mempool, []rawtx.Hash{spend.Hash}) {
+		t.Errorf("Expected the mempool to contain %s, but got %v", spend.Hash, mempool)
+	}
+
+	gotSpend, err := client.GetRawTransaction(ctx, spend.Hash)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if gotSpend.TxID() != spend.TxID() || gotSpend.WTxID() != spend.WTxID() {
+		t.Errorf("Expected the transaction %s, but got %s", spend.TxID(), gotSpend.TxID())
+	}
+
+	txOut, err := client.GetTxOut(ctx, coinbaseOutpoint, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if txOut.Output.Value != coinbaseValue || txOut.Output.GetType() != rawtx.OutP2WPKH || !bytes.Equal(txOut.Output.ScriptPubKey, p2wpkhScript) {
+		t.Errorf("Expected the coinbase output, but got %+v", txOut.Output)
+	}
+	if txOut.Confirmations != 1 || !txOut.Coinbase || txOut.BestBlock != block.Hash {
+		t.Errorf("Expected a confirmed coinbase output, but got %+v", txOut)
+	}
+	if _, err := client.GetTxOut(ctx, coinbaseOutpoint, true); err != rawtx.ErrPrevoutNotFound {
+		t.Errorf("Expected the output spent in the mempool to be not found, but got %v", err)
+	}
+
+	if err := gotSpend.FetchPrevouts(ctx, client); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fee, ok := gotSpend.GetFee(); !ok || fee != spendFee {
+		t.Errorf("Expected the fee %d, but got %d (%t)", spendFee, fee, ok)
+	}
+
+	// without -txindex, the spent coinbase output can't be found
+	node.TxIndex = false
+	if _, err := client.FetchPrevout(ctx, coinbaseOutpoint); err != rawtx.ErrPrevoutNotFound {
+		t.Errorf("Expected ErrPrevoutNotFound without txindex, but got %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	node, _, spend := newTestNode(t)
+	defer node.Close()
+	client := node.Client()
+	ctx := context.Background()
+
+	_, err := client.GetBlock(ctx, spend.Hash)
+	if rpcErr, ok := err.(*corerpc.RPCError); !ok || rpcErr.Code != corerpc.ErrCodeInvalidAddressOrKey {
+		t.Errorf("Expected a RPC error for an unknown block, but got %v", err)
+	}
+	err = client.Call(ctx, "getblockchaininfo", nil, nil)
+	if rpcErr, ok := err.(*corerpc.RPCError); !ok || rpcErr.Code != corerpc.ErrCodeMethodNotFound {
+		t.Errorf("Expected a RPC error for an unknown method, but got %v", err)
+	}
+	if _, err := corerpc.NewClient(node.URL(), "user", "wrong").GetRawMempool(ctx); err != corerpc.ErrUnauthorized {
+		t.Errorf("Expected corerpc.ErrUnauthorized, but got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.GetRawMempool(canceled); err == nil {
+		t.Error("Expected an error for a canceled context")
+	}
+}
+
+func TestClientSources(t *testing.T) {
+	node, block, spend := newTestNode(t)
+	defer node.Close()
+	client := node.Client()
+	ctx := context.Background()
+
+	var txids []rawtx.Hash
+	collect := rawtx.SinkFunc(func(r *rawtx.Result) error {
+		txids = append(txids, r.Tx.Hash)
+		return nil
+	})
+	config := rawtx.PipelineConfig{Ordered: true}
+
+	// transactions that left the mempool are skipped
+	source := client.TxSource([]rawtx.Hash{spend.Hash, block.Hash})
+	if err := rawtx.RunPipeline(ctx, source, config, collect); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := rawtx.RunPipeline(ctx, client.BlockSource([]rawtx.Hash{block.Hash}), config, collect); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []rawtx.Hash{spend.Hash, block.Transactions[0].Hash}
+	if !reflect.DeepEqual(txids, expected) {
+		t.Errorf("Expected the transactions %v, but got %v", expected, txids)
+	}
+
+	if err := rawtx.RunPipeline(ctx, client.BlockSource([]rawtx.Hash{spend.Hash}), config); err == nil {
+		t.Error("Expected an error for an unknown block")
+	}
+}
+
+func TestNewCookieClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corerpc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	cookieFile := filepath.Join(dir, ".cookie")
+	if err := ioutil.WriteFile(cookieFile, []byte("__cookie__:secret:with:colons\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	client, err := corerpc.NewCookieClient("http://127.0.0.1:8332", cookieFile)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if client.User != "__cookie__" || client.Password != "secret:with:colons" {
+		t.Errorf("Expected the cookie credentials, but got %s:%s", client.User, client.Password)
+	}
+
+	if err := ioutil.WriteFile(cookieFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := corerpc.NewCookieClient("http://127.0.0.1:8332", cookieFile); err == nil {
+		t.Error("Expected an error for an invalid cookie file")
+	}
+}
@@ -0,0 +1,282 @@
+// Package corerpctest provides a fake Bitcoin Core node for testing code using
+// a corerpc.Client offline.
+package corerpctest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/corerpc"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Node is an in-process HTTP server answering getrawtransaction, getblock,
+// getrawmempool and gettxout like Bitcoin Core for the transactions and blocks
+// added to it.
+type Node struct {
+	User     string
+	Password string
+	// TxIndex allows getrawtransaction to return confirmed transactions, as
+	// if the node was running with -txindex.
+	TxIndex bool
+
+	server *httptest.Server
+
+	mu        sync.Mutex
+	txns      map[rawtx.Hash]*rawtx.Tx
+	rawTxns   map[rawtx.Hash][]byte
+	txHeights map[rawtx.Hash]int // only confirmed transactions
+	mempool   []rawtx.Hash
+	blocks    map[rawtx.Hash][]byte
+	bestBlock rawtx.Hash
+	height    int
+	// spent outpoints by confirmed and by mempool transactions
+	spentInChain   map[rawtx.Outpoint]bool
+	spentInMempool map[rawtx.Outpoint]bool
+}
+
+// NewNode starts a Node accepting the user and password. It must be closed
+// after use.
+func NewNode(user, password string) *Node {
+	n := &Node{
+		User:           user,
+		Password:       password,
+		txns:           make(map[rawtx.Hash]*rawtx.Tx),
+		rawTxns:        make(map[rawtx.Hash][]byte),
+		txHeights:      make(map[rawtx.Hash]int),
+		blocks:         make(map[rawtx.Hash][]byte),
+		height:         -1,
+		spentInChain:   make(map[rawtx.Outpoint]bool),
+		spentInMempool: make(map[rawtx.Outpoint]bool),
+	}
+	n.server = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	return n
+}
+
+// URL returns the URL of the RPC server.
+func (n *Node) URL() string {
+	return n.server.URL
+}
+
+// Client returns a Client connected to the node.
+func (n *Node) Client() *corerpc.Client {
+	return corerpc.NewClient(n.URL(), n.User, n.Password)
+}
+
+// Close shuts the server down.
+func (n *Node) Close() {
+	n.server.Close()
+}
+
+// AddTx adds the raw transaction to the mempool.
+func (n *Node) AddTx(raw []byte) error {
+	tx, err := rawtx.DeserializeTx(raw)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.txns[tx.Hash] = &tx
+	n.rawTxns[tx.Hash] = raw
+	n.mempool = append(n.mempool, tx.Hash)
+	for _, in := range tx.Inputs {
+		n.spentInMempool[in.Outpoint] = true
+	}
+	return nil
+}
+
+// AddBlock connects the raw block on top of the previously added blocks. Its
+// transactions are removed from the mempool.
+func (n *Node) AddBlock(raw []byte) error {
+	block, err := rawtx.DeserializeBlock(raw)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.height++
+	n.blocks[block.Hash] = raw
+	n.bestBlock = block.Hash
+
+	confirmed := make(map[rawtx.Hash]bool)
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		confirmed[tx.Hash] = true
+		n.txns[tx.Hash] = tx
+		n.rawTxns[tx.Hash] = tx.Serialize(true)
+		n.txHeights[tx.Hash] = n.height
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			n.spentInChain[in.Outpoint] = true
+		}
+	}
+
+	mempool := n.mempool[:0]
+	for _, txid := range n.mempool {
+		if !confirmed[txid] {
+			mempool = append(mempool, txid)
+		}
+	}
+	n.mempool = mempool
+	return nil
+}
+
+// errCodeInvalidParameter is returned by Bitcoin Core for invalid parameters.
+const errCodeInvalidParameter = -8
+
+// txOutResult is the result of gettxout.
+type txOutResult struct {
+	BestBlock     rawtx.Hash                `json:"bestblock"`
+	Confirmations int64                     `json:"confirmations"`
+	Value         rawtx.BTCAmount           `json:"value"`
+	ScriptPubKey  rawtx.DecodedScriptPubKey `json:"scriptPubKey"`
+	Coinbase      bool                      `json:"coinbase"`
+}
+
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Result interface{}       `json:"result"`
+	Error  *corerpc.RPCError `json:"error"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+func (n *Node) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != n.User || password != n.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, rpcErr := n.handle(req.Method, req.Params)
+	status := http.StatusOK
+	if rpcErr != nil {
+		status = http.StatusInternalServerError
+		if rpcErr.Code == corerpc.ErrCodeMethodNotFound {
+			status = http.StatusNotFound
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response{Result: result, Error: rpcErr, ID: req.ID})
+}
+
+func (n *Node) handle(method string, params []json.RawMessage) (interface{}, *corerpc.RPCError) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch method {
+	case "getrawtransaction":
+		var txid rawtx.Hash
+		var verbose bool
+		if err := parseParams(params, &txid, &verbose); err != nil {
+			return nil, err
+		}
+		if verbose {
+			return nil, invalidParameter("verbose is not supported by the test node")
+		}
+		raw, ok := n.rawTxns[txid]
+		if _, confirmed := n.txHeights[txid]; !ok || (confirmed && !n.TxIndex) {
+			return nil, &corerpc.RPCError{Code: corerpc.ErrCodeInvalidAddressOrKey, Message: "No such mempool or blockchain transaction. Use gettransaction for wallet transactions."}
+		}
+		return hex.EncodeToString(raw), nil
+	case "getblock":
+		var hash rawtx.Hash
+		verbosity := 1
+		if err := parseParams(params, &hash, &verbosity); err != nil {
+			return nil, err
+		}
+		if verbosity != 0 {
+			return nil, invalidParameter("only verbosity 0 is supported by the test node")
+		}
+		raw, ok := n.blocks[hash]
+		if !ok {
+			return nil, &corerpc.RPCError{Code: corerpc.ErrCodeInvalidAddressOrKey, Message: "Block not found"}
+		}
+		return hex.EncodeToString(raw), nil
+	case "getrawmempool":
+		var verbose bool
+		if err := parseParams(params, &verbose); err != nil {
+			return nil, err
+		}
+		if verbose {
+			return nil, invalidParameter("verbose is not supported by the test node")
+		}
+		return append([]rawtx.Hash{}, n.mempool...), nil
+	case "gettxout":
+		var outpoint rawtx.Outpoint
+		includeMempool := true
+		if err := parseParams(params, &outpoint.PrevTxHash, &outpoint.OutputIndex, &includeMempool); err != nil {
+			return nil, err
+		}
+		return n.txOut(outpoint, includeMempool), nil
+	}
+	return nil, &corerpc.RPCError{Code: corerpc.ErrCodeMethodNotFound, Message: "Method not found"}
+}
+
+// txOut returns the gettxout result for the outpoint or nil if the output is
+// spent or unknown.
+func (n *Node) txOut(outpoint rawtx.Outpoint, includeMempool bool) interface{} {
+	tx, ok := n.txns[outpoint.PrevTxHash]
+	if !ok || int(outpoint.OutputIndex) >= len(tx.Outputs) || n.spentInChain[outpoint] {
+		return nil
+	}
+	height, confirmed := n.txHeights[outpoint.PrevTxHash]
+	if includeMempool && n.spentInMempool[outpoint] || !includeMempool && !confirmed {
+		return nil
+	}
+
+	var confirmations int64
+	if confirmed {
+		confirmations = int64(n.height - height + 1)
+	}
+	out := tx.Outputs[outpoint.OutputIndex]
+	return txOutResult{
+		BestBlock:     n.bestBlock,
+		Confirmations: confirmations,
+		Value:         rawtx.BTCAmount(out.Value),
+		ScriptPubKey:  out.ScriptPubKey.DecodeScriptPubKey(&chaincfg.MainNetParams),
+		Coinbase:      tx.IsCoinbase(),
+	}
+}
+
+// parseParams unmarshals the positional params into the values. Missing
+// params keep their default value.
+func parseParams(params []json.RawMessage, values ...interface{}) *corerpc.RPCError {
+	if len(params) > len(values) {
+		return invalidParameter(fmt.Sprintf("expected at most %d parameters, but got %d", len(values), len(params)))
+	}
+	for i, param := range params {
+		// Bitcoin Core accepts verbosity and verbose flags as bool or number
+		if b, ok := values[i].(*bool); ok {
+			var number int
+			if err := json.Unmarshal(param, &number); err == nil {
+				*b = number != 0
+				continue
+			}
+		}
+		if err := json.Unmarshal(param, values[i]); err != nil {
+			return invalidParameter(fmt.Sprintf("parameter %d: %s", i+1, err))
+		}
+	}
+	return nil
+}
+
+func invalidParameter(message string) *corerpc.RPCError {
+	return &corerpc.RPCError{Code: errCodeInvalidParameter, Message: message}
+}
@@ -0,0 +1,475 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Script types as named by Bitcoin Core in the "type" field of a scriptPubKey.
+const (
+	CoreTypeNonStandard         = "nonstandard"
+	CoreTypeAnchor              = "anchor"
+	CoreTypePubKey              = "pubkey"
+	CoreTypePubKeyHash          = "pubkeyhash"
+	CoreTypeScriptHash          = "scripthash"
+	CoreTypeMultisig            = "multisig"
+	CoreTypeNullData            = "nulldata"
+	CoreTypeWitnessV0KeyHash    = "witness_v0_keyhash"
+	CoreTypeWitnessV0ScriptHash = "witness_v0_scripthash"
+	CoreTypeWitnessV1Taproot    = "witness_v1_taproot"
+	CoreTypeWitnessUnknown      = "witness_unknown"
+)
+
+// DecodedRawTx is a view of a transaction matching the JSON schema of Bitcoin
+// Core's decoderawtransaction RPC.
+type DecodedRawTx struct {
+	TxID     Hash            `json:"txid"`
+	Hash     Hash            `json:"hash"`
+	Version  uint32          `json:"version"`
+	Size     int             `json:"size"`
+	VSize    int             `json:"vsize"`
+	Weight   int             `json:"weight"`
+	Locktime uint32          `json:"locktime"`
+	Vin      []DecodedInput  `json:"vin"`
+	Vout     []DecodedOutput `json:"vout"`
+}
+
+// DecodedInput is a transaction input as shown by decoderawtransaction. For
+// coinbase inputs only Coinbase, TxInWitness and Sequence are set.
+type DecodedInput struct {
+	Coinbase    *string           `json:"coinbase,omitempty"`
+	TxID        *Hash             `json:"txid,omitempty"`
+	Vout        *uint32           `json:"vout,omitempty"`
+	ScriptSig   *DecodedScriptSig `json:"scriptSig,omitempty"`
+	TxInWitness []string          `json:"txinwitness,omitempty"`
+	Sequence    uint32            `json:"sequence"`
+}
+
+// DecodedScriptSig is a scriptSig as shown by decoderawtransaction.
+type DecodedScriptSig struct {
+	ASM string `json:"asm"`
+	Hex string `json:"hex"`
+}
+
+// DecodedOutput is a transaction output as shown by decoderawtransaction.
+type DecodedOutput struct {
+	Value        BTCAmount           `json:"value"`
+	N            int                 `json:"n"`
+	ScriptPubKey DecodedScriptPubKey `json:"scriptPubKey"`
+}
+
+// DecodedScriptPubKey is a scriptPubKey as shown by decoderawtransaction. The
+// address is empty for scripts without address.
+type DecodedScriptPubKey struct {
+	ASM     string `json:"asm"`
+	Desc    string `json:"desc"`
+	Hex     string `json:"hex"`
+	Address string `json:"address,omitempty"`
+	Type    string `json:"type"`
+}
+
+// BTCAmount is an amount in satoshi that is marshalled to JSON as number in
+// BTC with eight decimal places like Bitcoin Core does.
+type BTCAmount int64
+
+// MarshalJSON marshals the amount as JSON number in BTC.
+func (a BTCAmount) MarshalJSON() ([]byte, error) {
+	sign := ""
+	abs := int64(a)
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	return []byte(fmt.Sprintf("%s%d.%08d", sign, abs/btcutil.SatoshiPerBitcoin, abs%btcutil.SatoshiPerBitcoin)), nil
+}
+
+// UnmarshalJSON unmarshals an amount from a JSON number in BTC. Amounts with
+// more than eight decimal places are rejected.
+func (a *BTCAmount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if len(fraction) > 8 {
+		return fmt.Errorf("amount %s has more than eight decimal places", b)
+	}
+	fraction += strings.Repeat("0", 8-len(fraction))
+
+	btc, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %s", b, err)
+	}
+	sats, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %s", b, err)
+	}
+	if btc > (math.MaxInt64-sats)/btcutil.SatoshiPerBitcoin {
+		return fmt.Errorf("amount %s is out of range", b)
+	}
+	*a = BTCAmount(btc*btcutil.SatoshiPerBitcoin + sats)
+	if negative {
+		*a = -*a
+	}
+	return nil
+}
+
+// DecodeRaw returns a view of the transaction matching the output of Bitcoin
+// Core's decoderawtransaction RPC. The addresses are encoded for the passed
+// network.
+func (tx *Tx) DecodeRaw(params *chaincfg.Params) *DecodedRawTx {
+	decoded := &DecodedRawTx{
+		TxID:     tx.TxID(),
+		Hash:     tx.WTxID(),
+		Version:  uint32(tx.Version),
+		Size:     tx.GetSizeWithWitness(),
+		VSize:    tx.GetSizeWithoutWitness(),
+		Weight:   tx.GetWeight(),
+		Locktime: tx.Locktime,
+		Vin:      make([]DecodedInput, 0, len(tx.Inputs)),
+		Vout:     make([]DecodedOutput, 0, len(tx.Outputs)),
+	}
+
+	for i := range tx.Inputs {
+		decoded.Vin = append(decoded.Vin, tx.Inputs[i].decodeRaw())
+	}
+	for i := range tx.Outputs {
+		decoded.Vout = append(decoded.Vout, DecodedOutput{
+			Value:        BTCAmount(tx.Outputs[i].Value),
+			N:            i,
+			ScriptPubKey: tx.Outputs[i].ScriptPubKey.DecodeScriptPubKey(params),
+		})
+	}
+	return decoded
+}
+
+// MarshalJSON marshals the transaction as JSON in the format of Bitcoin Core's
+// decoderawtransaction RPC with mainnet addresses. Use DecodeRaw for other
+// networks.
+func (tx Tx) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tx.DecodeRaw(&chaincfg.MainNetParams))
+}
+
+func (in *Input) decodeRaw() DecodedInput {
+	decoded := DecodedInput{Sequence: in.Sequence}
+	if in.IsCoinbase() {
+		coinbase := hex.EncodeToString(in.ScriptSig)
+		decoded.Coinbase = &coinbase
+	} else {
+		txid := in.Outpoint.PrevTxHash
+		vout := in.Outpoint.OutputIndex
+		decoded.TxID = &txid
+		decoded.Vout = &vout
+		decoded.ScriptSig = &DecodedScriptSig{
+			ASM: in.ScriptSig.ASM(true),
+			Hex: hex.EncodeToString(in.ScriptSig),
+		}
+	}
+	for _, element := range in.Witness {
+		decoded.TxInWitness = append(decoded.TxInWitness, hex.EncodeToString(element.PushedData))
+	}
+	return decoded
+}
+
+// DecodeScriptPubKey returns the scriptPubKey as shown by Bitcoin Core's
+// decoderawtransaction RPC with the address encoded for the passed network.
+func (s BitcoinScript) DecodeScriptPubKey(params *chaincfg.Params) DecodedScriptPubKey {
+	scriptType, solutions := s.coreSolver()
+	address, _ := s.coreAddress(scriptType, solutions, params)
+
+	decoded := DecodedScriptPubKey{
+		ASM:  s.ASM(false),
+		Desc: descriptorWithChecksum(s.inferDescriptor(scriptType, solutions, address)),
+		Hex:  hex.EncodeToString(s),
+		Type: scriptType,
+	}
+	// Bitcoin Core doesn't show an address for P2PK outputs
+	if scriptType != CoreTypePubKey {
+		decoded.Address = address
+	}
+	return decoded
+}
+
+// coreSolver classifies the script like Solver() in Bitcoin Core and returns
+// the script type and the solutions: the pubkey, hash or witness program, the
+// witness version for witness programs and the pubkeys for multisig scripts
+// with the required number of signatures first.
+func (s BitcoinScript) coreSolver() (scriptType string, solutions [][]byte) {
+	if len(s) == 4 && s[0] == byte(Op1) && s[1] == byte(OpDATA2) && s[2] == 0x4e && s[3] == 0x73 {
+		return CoreTypeAnchor, [][]byte{{1}, s[2:]}
+	}
+	if len(s) == 23 && s[0] == byte(OpHASH160) && s[1] == byte(OpDATA20) && s[22] == byte(OpEQUAL) {
+		return CoreTypeScriptHash, [][]byte{s[2:22]}
+	}
+	if isWitnessProgram, version, program := s.IsWitnessProgram(); isWitnessProgram {
+		switch {
+		case version == 0 && len(program) == 20:
+			return CoreTypeWitnessV0KeyHash, [][]byte{program}
+		case version == 0 && len(program) == 32:
+			return CoreTypeWitnessV0ScriptHash, [][]byte{program}
+		case version == 1 && len(program) == 32:
+			return CoreTypeWitnessV1Taproot, [][]byte{program}
+		case version != 0:
+			return CoreTypeWitnessUnknown, [][]byte{{byte(version)}, program}
+		}
+		return CoreTypeNonStandard, nil
+	}
+	if len(s) >= 1 && s[0] == byte(OpRETURN) && s[1:].IsPushOnly() {
+		return CoreTypeNullData, nil
+	}
+	if len(s) == 35 && s[0] == byte(OpDATA33) && s[34] == byte(OpCHECKSIG) && isValidPubKeySize(s[1:34]) {
+		return CoreTypePubKey, [][]byte{s[1:34]}
+	}
+	if len(s) == 67 && s[0] == byte(OpDATA65) && s[66] == byte(OpCHECKSIG) && isValidPubKeySize(s[1:66]) {
+		return CoreTypePubKey, [][]byte{s[1:66]}
+	}
+	if len(s) == 25 && s[0] == byte(OpDUP) && s[1] == byte(OpHASH160) && s[2] == byte(OpDATA20) && s[23] == byte(OpEQUALVERIFY) && s[24] == byte(OpCHECKSIG) {
+		return CoreTypePubKeyHash, [][]byte{s[3:23]}
+	}
+	if required, pubKeys, ok := s.matchMultisig(); ok {
+		return CoreTypeMultisig, append([][]byte{{byte(required)}}, pubKeys...)
+	}
+	return CoreTypeNonStandard, nil
+}
+
+// isValidPubKeySize checks the size of a pubkey matches its prefix like
+// CPubKey::ValidSize() in Bitcoin Core.
+func isValidPubKeySize(pubKey []byte) bool {
+	if len(pubKey) == 0 {
+		return false
+	}
+	switch pubKey[0] {
+	case 0x02, 0x03:
+		return len(pubKey) == 33
+	case 0x04, 0x06, 0x07:
+		return len(pubKey) == 65
+	}
+	return false
+}
+
+// matchMultisig matches a bare multisig script with up to 20 pubkeys like
+// MatchMultisig() in Bitcoin Core.
+func (s BitcoinScript) matchMultisig() (required int, pubKeys [][]byte, ok bool) {
+	if len(s) < 1 || OpCode(s[len(s)-1]) != OpCHECKMULTISIG {
+		return 0, nil, false
+	}
+	remainder := s[:len(s)-1]
+
+	opCode, data, remainder, ok := nextScriptOp(remainder)
+	if !ok {
+		return 0, nil, false
+	}
+	required, ok = multisigNumber(opCode, data, 1, MaxPubKeysPerMultisig)
+	if !ok {
+		return 0, nil, false
+	}
+
+	for len(remainder) > 0 {
+		opCode, data, remainder, ok = nextScriptOp(remainder)
+		if !ok {
+			return 0, nil, false
+		}
+		if !isValidPubKeySize(data) {
+			break
+		}
+		pubKeys = append(pubKeys, data)
+	}
+
+	numKeys, ok := multisigNumber(opCode, data, required, MaxPubKeysPerMultisig)
+	if !ok || numKeys != len(pubKeys) || len(remainder) != 0 {
+		return 0, nil, false
+	}
+	return required, pubKeys, true
+}
+
+// multisigNumber decodes a minimally pushed number between min and max.
+func multisigNumber(opCode OpCode, data []byte, min, max int) (int, bool) {
+	var n int64
+	switch {
+	case opCode >= Op1 && opCode <= Op16:
+		n = int64(opCode-Op1) + 1
+	case opCode <= OpPUSHDATA4:
+		if !isMinimalPush(opCode, data) || len(data) > 4 || (len(data) > 0 && data[len(data)-1]&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0)) {
+			return 0, false
+		}
+		n = decodeScriptNum(data)
+	default:
+		return 0, false
+	}
+	if n < int64(min) || n > int64(max) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// isMinimalPush checks if the data is pushed with the smallest possible push
+// opcode like CheckMinimalPush() in Bitcoin Core.
+func isMinimalPush(opCode OpCode, data []byte) bool {
+	switch {
+	case len(data) == 0:
+		return opCode == Op0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return false
+	case len(data) == 1 && data[0] == 0x81:
+		return false
+	case len(data) <= 75:
+		return int(opCode) == len(data)
+	case len(data) <= 255:
+		return opCode == OpPUSHDATA1
+	case len(data) <= 65535:
+		return opCode == OpPUSHDATA2
+	}
+	return true
+}
+
+// coreAddress returns the address of the script for the passed network. False
+// is returned if the script has no address.
+func (s BitcoinScript) coreAddress(scriptType string, solutions [][]byte, params *chaincfg.Params) (string, bool) {
+	switch scriptType {
+	case CoreTypePubKeyHash:
+		return base58.CheckEncode(solutions[0], params.PubKeyHashAddrID), true
+	case CoreTypeScriptHash:
+		return base58.CheckEncode(solutions[0], params.ScriptHashAddrID), true
+	case CoreTypeWitnessV0KeyHash, CoreTypeWitnessV0ScriptHash:
+		return encodeSegWitAddress(params.Bech32HRPSegwit, 0, solutions[0])
+	case CoreTypeWitnessV1Taproot:
+		return encodeSegWitAddress(params.Bech32HRPSegwit, 1, solutions[0])
+	case CoreTypeWitnessUnknown, CoreTypeAnchor:
+		return encodeSegWitAddress(params.Bech32HRPSegwit, solutions[0][0], solutions[1])
+	}
+	return "", false
+}
+
+// encodeSegWitAddress encodes a witness program as bech32 (version 0) or
+// bech32m (version 1 and higher) address.
+func encodeSegWitAddress(hrp string, version byte, program []byte) (string, bool) {
+	converted, err := bech32.ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", false
+	}
+	data := append([]byte{version}, converted...)
+	var address string
+	if version == 0 {
+		address, err = bech32.Encode(hrp, data)
+	} else {
+		address, err = bech32.EncodeM(hrp, data)
+	}
+	if err != nil {
+		return "", false
+	}
+	return address, true
+}
+
+// inferDescriptor returns the output descriptor without checksum Bitcoin Core
+// infers for a script without any key information: pk() for P2PK, multi() for
+// bare multisig, rawtr() for P2TR, addr() for other scripts with an address
+// and raw() for all other scripts.
+func (s BitcoinScript) inferDescriptor(scriptType string, solutions [][]byte, address string) string {
+	switch scriptType {
+	case CoreTypePubKey:
+		if isValidNonHybridPubKey(solutions[0]) {
+			return "pk(" + hex.EncodeToString(solutions[0]) + ")"
+		}
+	case CoreTypeMultisig:
+		keys := make([]string, 0, len(solutions)-1)
+		for _, pubKey := range solutions[1:] {
+			if !isValidNonHybridPubKey(pubKey) {
+				return "raw(" + hex.EncodeToString(s) + ")"
+			}
+			keys = append(keys, hex.EncodeToString(pubKey))
+		}
+		return "multi(" + strconv.Itoa(int(solutions[0][0])) + "," + strings.Join(keys, ",") + ")"
+	case CoreTypeWitnessV1Taproot:
+		if _, err := schnorr.ParsePubKey(solutions[0]); err == nil {
+			return "rawtr(" + hex.EncodeToString(solutions[0]) + ")"
+		}
+	}
+	if address != "" {
+		return "addr(" + address + ")"
+	}
+	return "raw(" + hex.EncodeToString(s) + ")"
+}
+
+func isValidNonHybridPubKey(pubKey []byte) bool {
+	return isValidPubKeySize(pubKey) && pubKey[0] != 0x06 && pubKey[0] != 0x07
+}
+
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// ErrInvalidDescriptorCharacter is returned if a descriptor contains a
+// character that is not allowed in descriptors.
+var ErrInvalidDescriptorCharacter = errors.New("invalid character in descriptor")
+
+// DescriptorChecksum returns the BIP380 checksum of an output descriptor.
+func DescriptorChecksum(descriptor string) (string, error) {
+	generator := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	c := uint64(1)
+	polymod := func(value uint64) {
+		top := c >> 35
+		c = (c&0x7ffffffff)<<5 ^ value
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				c ^= generator[i]
+			}
+		}
+	}
+
+	groups, numGroups := uint64(0), 0
+	for _, ch := range descriptor {
+		pos := strings.IndexRune(descriptorInputCharset, ch)
+		if pos < 0 {
+			return "", ErrInvalidDescriptorCharacter
+		}
+		polymod(uint64(pos) & 31)
+		groups = groups*3 + uint64(pos)>>5
+		numGroups++
+		if numGroups == 3 {
+			polymod(groups)
+			groups, numGroups = 0, 0
+		}
+	}
+	if numGroups > 0 {
+		polymod(groups)
+	}
+	for i := 0; i < 8; i++ {
+		polymod(0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		checksum[i] = descriptorChecksumCharset[(c>>(5*uint(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+func descriptorWithChecksum(descriptor string) string {
+	checksum, err := DescriptorChecksum(descriptor)
+	if err != nil {
+		return descriptor
+	}
+	return descriptor + "#" + checksum
+}
@@ -0,0 +1,144 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestDecodeScriptPubKey(t *testing.T) {
+	testCases := []struct {
+		script  string
+		asm     string
+		desc    string
+		address string
+		typ     string
+	}{
+		{"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", "OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG", "addr(1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH)", "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", CoreTypePubKeyHash},
+		{"a914751e76e8199196d454941c45d1b3a323f1433bd687", "OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUAL", "addr(3CNHUhP3uyB9EUtRLsmvFUmvGdjGdkTxJw)", "3CNHUhP3uyB9EUtRLsmvFUmvGdjGdkTxJw", CoreTypeScriptHash},
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", "0 751e76e8199196d454941c45d1b3a323f1433bd6", "addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4)", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", CoreTypeWitnessV0KeyHash},
+		{"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", "0 1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", "addr(bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3)", "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", CoreTypeWitnessV0ScriptHash},
+		{"512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "1 79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "rawtr(79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798)", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", CoreTypeWitnessV1Taproot},
+		{"5120" + strings.Repeat("00", 32), "1 " + strings.Repeat("00", 32), "addr(bc1pqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqpqqenm)", "bc1pqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqpqqenm", CoreTypeWitnessV1Taproot},
+		{"51024e73", "1 29518", "addr(bc1pfeessrawgf)", "bc1pfeessrawgf", CoreTypeAnchor},
+		{"5210751e76e8199196d454941c45d1b3a323", "2 751e76e8199196d454941c45d1b3a323", "addr(bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs)", "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", CoreTypeWitnessUnknown},
+		{"210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac", "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798 OP_CHECKSIG", "pk(0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798)", "", CoreTypePubKey},
+		{"51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f817982102c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee552ae", "1 0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798 02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5 2 OP_CHECKMULTISIG", "multi(1,0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798,02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)", "", CoreTypeMultisig},
+		{"6a0401020304", "OP_RETURN 67305985", "raw(6a0401020304)", "", CoreTypeNullData},
+		{"6a", "OP_RETURN", "raw(6a)", "", CoreTypeNullData},
+		{"6a76", "OP_RETURN OP_DUP", "raw(6a76)", "", CoreTypeNonStandard},
+		{"51", "1", "raw(51)", "", CoreTypeNonStandard},
+		{"0015751e76e8199196d454941c45d1b3a323f1433bd6aa", "0 751e76e8199196d454941c45d1b3a323f1433bd6aa", "raw(0015751e76e8199196d454941c45d1b3a323f1433bd6aa)", "", CoreTypeNonStandard},
+		{"4c", "[error]", "raw(4c)", "", CoreTypeNonStandard},
+		{"ba4f00", "OP_CHECKSIGADD -1 0", "raw(ba4f00)", "", CoreTypeNonStandard},
+	}
+
+	for _, tc := range testCases {
+		s, _ := hex.DecodeString(tc.script)
+		decoded := BitcoinScript(s).DecodeScriptPubKey(&chaincfg.MainNetParams)
+		checksum, _ := DescriptorChecksum(tc.desc)
+		expected := DecodedScriptPubKey{ASM: tc.asm, Desc: tc.desc + "#" + checksum, Hex: tc.script, Address: tc.address, Type: tc.typ}
+		if decoded != expected {
+			t.Errorf("Expected DecodeScriptPubKey() to be %+v, but got %+v", expected, decoded)
+		}
+	}
+
+	s, _ := hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+	if address := BitcoinScript(s).DecodeScriptPubKey(&chaincfg.TestNet3Params).Address; address != "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx" {
+		t.Errorf("Expected the testnet address tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx, but got %s", address)
+	}
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	// test vectors from BIP380
+	checksum, err := DescriptorChecksum("raw(deadbeef)")
+	if err != nil || checksum != "89f8spxm" {
+		t.Errorf("Expected the checksum 89f8spxm, but got %s (%v)", checksum, err)
+	}
+	if _, err := DescriptorChecksum("raw(deadbeef)ä"); err != ErrInvalidDescriptorCharacter {
+		t.Errorf("Expected ErrInvalidDescriptorCharacter, but got %v", err)
+	}
+}
+
+func TestBTCAmount(t *testing.T) {
+	testCases := map[int64]string{
+		0:                "0.00000000",
+		1:                "0.00000001",
+		546:              "0.00000546",
+		100000000:        "1.00000000",
+		2100000000000000: "21000000.00000000",
+		-150000000:       "-1.50000000",
+	}
+
+	for sats, expected := range testCases {
+		b, err := json.Marshal(BTCAmount(sats))
+		if err != nil || string(b) != expected {
+			t.Errorf("Expected %d sat to be marshalled as %s, but got %s (%v)", sats, expected, b, err)
+		}
+		var a BTCAmount
+		if err := json.Unmarshal(b, &a); err != nil || int64(a) != sats {
+			t.Errorf("Expected %s to be unmarshalled as %d sat, but got %d (%v)", b, sats, a, err)
+		}
+	}
+
+	var a BTCAmount
+	if err := json.Unmarshal([]byte("0.1"), &a); err != nil || a != 10000000 {
+		t.Errorf("Expected 0.1 to be unmarshalled as 10000000 sat, but got %d (%v)", a, err)
+	}
+	if err := json.Unmarshal([]byte("1e-8"), &a); err != nil || a != 1 {
+		t.Errorf("Expected 1e-8 to be unmarshalled as 1 sat, but got %d (%v)", a, err)
+	}
+	if err := json.Unmarshal([]byte("0.000000001"), &a); err == nil {
+		t.Errorf("Expected an error for an amount with nine decimal places")
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		b, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var decoded DecodedRawTx
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if decoded.TxID != tx.TxID() || decoded.Hash != tx.WTxID() {
+			t.Errorf("Expected txid %s and hash %s, but got %s and %s for testTx: %+v", tx.TxID(), tx.WTxID(), decoded.TxID, decoded.Hash, testTx)
+		}
+		if decoded.Size != testTx.Size || decoded.VSize != testTx.VSize || decoded.Weight != tx.GetWeight() {
+			t.Errorf("Expected size %d and vsize %d, but got %d and %d for testTx: %+v", testTx.Size, testTx.VSize, decoded.Size, decoded.VSize, testTx)
+		}
+		if len(decoded.Vin) != len(tx.Inputs) || len(decoded.Vout) != len(tx.Outputs) {
+			t.Fatalf("Expected %d vin and %d vout, but got %d and %d for testTx: %+v", len(tx.Inputs), len(tx.Outputs), len(decoded.Vin), len(decoded.Vout), testTx)
+		}
+
+		for i, in := range tx.Inputs {
+			vin := decoded.Vin[i]
+			if in.IsCoinbase() != (vin.Coinbase != nil) || in.IsCoinbase() == (vin.ScriptSig != nil) {
+				t.Errorf("Expected either coinbase or scriptSig to be set for input %d of testTx: %+v", i, testTx)
+			}
+			if len(vin.TxInWitness) != len(in.Witness) {
+				t.Errorf("Expected %d witness elements, but got %d for input %d of testTx: %+v", len(in.Witness), len(vin.TxInWitness), i, testTx)
+			}
+		}
+
+		var sum int64
+		for _, vout := range decoded.Vout {
+			sum += int64(vout.Value)
+		}
+		if sum != testTx.OutputSum {
+			t.Errorf("Expected the vout values to sum up to %d, but got %d for testTx: %+v", testTx.OutputSum, sum, testTx)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package rawtx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The smallest possible serialized input (outpoint, empty scriptSig and
+// sequence) and output (value and empty scriptPubKey) in bytes. Used to reject
+// input and output counts that can't fit into the remaining data before
+// allocating.
+const (
+	minInputSize  = 32 + 4 + 1 + 4
+	minOutputSize = 8 + 1
+)
+
+// ErrTrailingData is returned by DeserializeTx if there are bytes left after
+// the transaction.
+var ErrTrailingData = errors.New("trailing data after the transaction")
+
+// DeserializeTx deserializes a raw transaction without going through a
+// wire.MsgTx. The scripts and witness elements of the returned Tx reference
+// the passed byte slice instead of copying it. The byte slice must not be
+// modified afterwards. The txid, wtxid and the sizes are computed while
+// parsing.
+func DeserializeTx(rawTx []byte) (tx Tx, err error) {
+	n, err := tx.deserialize(rawTx)
+	if err != nil {
+		return Tx{}, err
+	}
+	if n != len(rawTx) {
+		return Tx{}, ErrTrailingData
+	}
+	return tx, nil
+}
+
+// txReader reads the fields of a serialized transaction from a byte slice.
+type txReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *txReader) read(n int, field string) ([]byte, error) {
+	if n < 0 || len(r.b)-r.pos < n {
+		return nil, fmt.Errorf("unexpected end of data reading the %s", field)
+	}
+	b := r.b[r.pos : r.pos+n : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *txReader) readUint32(field string) (uint32, error) {
+	b, err := r.read(4, field)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *txReader) readCompactSize(field string) (uint64, error) {
+	value, n, err := readCompactSize(r.b[r.pos:])
+	if err != nil {
+		return 0, fmt.Errorf("could not read the %s: %s", field, err)
+	}
+	r.pos += n
+	return value, nil
+}
+
+// readCount reads a CompactSize count of items with at least minItemSize bytes
+// each and rejects counts that can't fit into the remaining data.
+func (r *txReader) readCount(minItemSize int, field string) (int, error) {
+	count, err := r.readCompactSize(field)
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64((len(r.b)-r.pos)/minItemSize) {
+		return 0, fmt.Errorf("%s of %d exceeds the remaining data", field, count)
+	}
+	return int(count), nil
+}
+
+func (r *txReader) readVarBytes(field string) ([]byte, error) {
+	length, err := r.readCount(1, field+" length")
+	if err != nil {
+		return nil, err
+	}
+	return r.read(length, field)
+}
+
+// deserialize deserializes a transaction from the start of b into tx and
+// returns the number of bytes read.
+func (tx *Tx) deserialize(b []byte) (int, error) {
+	r := &txReader{b: b}
+
+	version, err := r.readUint32("version")
+	if err != nil {
+		return 0, err
+	}
+	tx.Version = int32(version)
+
+	// BIP144: a zero input count followed by a flag of 0x01 marks a
+	// transaction with witness.
+	hasWitness := false
+	if len(b) >= r.pos+2 && b[r.pos] == 0x00 {
+		if b[r.pos+1] != 0x01 {
+			return 0, fmt.Errorf("invalid witness flag %#02x", b[r.pos+1])
+		}
+		hasWitness = true
+		r.pos += 2
+	}
+	inputsStart := r.pos
+
+	numInputs, err := r.readCount(minInputSize, "input count")
+	if err != nil {
+		return 0, err
+	}
+	tx.Inputs = make([]Input, numInputs)
+	for i := range tx.Inputs {
+		in := &tx.Inputs[i]
+		prevTxHash, err := r.read(HashSize, "outpoint hash")
+		if err != nil {
+			return 0, err
+		}
+		copy(in.Outpoint.PrevTxHash[:], prevTxHash)
+		if in.Outpoint.OutputIndex, err = r.readUint32("outpoint index"); err != nil {
+			return 0, err
+		}
+		if in.ScriptSig, err = r.readVarBytes("scriptSig"); err != nil {
+			return 0, err
+		}
+		in.parsedScriptSig = newParsedScriptCache(in.ScriptSig)
+		if in.Sequence, err = r.readUint32("sequence"); err != nil {
+			return 0, err
+		}
+	}
+
+	numOutputs, err := r.readCount(minOutputSize, "output count")
+	if err != nil {
+		return 0, err
+	}
+	tx.Outputs = make([]Output, numOutputs)
+	for i := range tx.Outputs {
+		out := &tx.Outputs[i]
+		value, err := r.read(8, "output value")
+		if err != nil {
+			return 0, err
+		}
+		out.Value = int64(binary.LittleEndian.Uint64(value))
+		if out.ScriptPubKey, err = r.readVarBytes("scriptPubKey"); err != nil {
+			return 0, err
+		}
+		out.parsedScriptPubKey = newParsedScriptCache(out.ScriptPubKey)
+	}
+	outputsEnd := r.pos
+
+	if hasWitness {
+		hasNonEmptyWitness := false
+		for i := range tx.Inputs {
+			numElements, err := r.readCount(1, "witness element count")
+			if err != nil {
+				return 0, err
+			}
+			if numElements == 0 {
+				continue
+			}
+			hasNonEmptyWitness = true
+			witness := make(ParsedBitcoinScript, numElements)
+			for j := range witness {
+				element, err := r.readVarBytes("witness element")
+				if err != nil {
+					return 0, err
+				}
+				witness[j] = witnessElementToParsedOpCode(element)
+			}
+			tx.Inputs[i].Witness = witness
+		}
+		// BIP144: the witness flag must not be set if all witnesses are empty
+		if !hasNonEmptyWitness {
+			return 0, errors.New("witness flag set but all witnesses are empty")
+		}
+	}
+
+	if tx.Locktime, err = r.readUint32("locktime"); err != nil {
+		return 0, err
+	}
+
+	// The txid commits to the transaction serialized without marker, flag and
+	// witness. Without witness this is the whole serialized transaction.
+	tx.serializeSize = r.pos
+	if hasWitness {
+		tx.serializeSizeStripped = 4 + (outputsEnd - inputsStart) + 4
+		h := sha256.New()
+		h.Write(b[:4])
+		h.Write(b[inputsStart:outputsEnd])
+		h.Write(b[r.pos-4 : r.pos])
+		var first [sha256.Size]byte
+		tx.Hash = Hash(sha256.Sum256(h.Sum(first[:0])))
+		tx.wtxid = DoubleSHA256(b[:r.pos])
+	} else {
+		tx.serializeSizeStripped = r.pos
+		tx.Hash = DoubleSHA256(b[:r.pos])
+		tx.wtxid = tx.Hash
+	}
+	tx.HashString = tx.Hash.String()
+
+	for i := range tx.Inputs {
+		tx.Inputs[i].inputType = tx.Inputs[i].GetType()
+	}
+	for i := range tx.Outputs {
+		tx.Outputs[i].outputType = tx.Outputs[i].GetType()
+	}
+	tx.bip69sorted = isBIP69Sorted(tx.Inputs, tx.Outputs)
+
+	return r.pos, nil
+}
+
+// witnessElementToParsedOpCode returns a witness element as ParsedOpCode. An
+// empty element is represented by a OP_0.
+func witnessElementToParsedOpCode(element []byte) ParsedOpCode {
+	if len(element) == 0 {
+		return ParsedOpCode{OpCode: Op0}
+	}
+	return ParsedOpCode{OpCode: GetDataPushOpCodeForLength(len(element)), PushedData: element}
+}
+
+// isBIP69Sorted returns true if the inputs and outputs are sorted as defined
+// in BIP69. Inputs are sorted by the previous transaction hash in display
+// byte order and the output index. Outputs are sorted by value and
+// scriptPubKey.
+func isBIP69Sorted(inputs []Input, outputs []Output) bool {
+	for i := 1; i < len(inputs); i++ {
+		if compareInputsBIP69(&inputs[i-1], &inputs[i]) > 0 {
+			return false
+		}
+	}
+	for i := 1; i < len(outputs); i++ {
+		a, b := &outputs[i-1], &outputs[i]
+		if a.Value > b.Value || (a.Value == b.Value && bytes.Compare(a.ScriptPubKey, b.ScriptPubKey) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInputsBIP69(a, b *Input) int {
+	for i := HashSize - 1; i >= 0; i-- {
+		if a.Outpoint.PrevTxHash[i] != b.Outpoint.PrevTxHash[i] {
+			if a.Outpoint.PrevTxHash[i] < b.Outpoint.PrevTxHash[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a.Outpoint.OutputIndex < b.Outpoint.OutputIndex:
+		return -1
+	case a.Outpoint.OutputIndex > b.Outpoint.OutputIndex:
+		return 1
+	}
+	return 0
+}
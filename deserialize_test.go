@@ -0,0 +1,106 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDeserializeTx(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		raw, _ := hex.DecodeString(testTx.RawTx)
+
+		tx, err := DeserializeTx(raw)
+		if err != nil {
+			t.Errorf("Expected DeserializeTx() to succeed, but got %s for testTx: %+v", err, testTx)
+			continue
+		}
+
+		wireTx, err := DeserializeRawTxBytes(raw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if !reflect.DeepEqual(tx, wireTx) {
+			t.Errorf("Expected DeserializeTx() to equal DeserializeRawTxBytes(), but got %+v and %+v for testTx: %+v", tx, wireTx, testTx)
+		}
+
+		if tx.GetSizeWithWitness() != testTx.Size || tx.GetSizeWithoutWitness() != testTx.VSize {
+			t.Errorf("Expected size %d and vsize %d, but got %d and %d for testTx: %+v", testTx.Size, testTx.VSize, tx.GetSizeWithWitness(), tx.GetSizeWithoutWitness(), testTx)
+		}
+
+		// the scripts reference the passed byte slice
+		if len(tx.Outputs[0].ScriptPubKey) > 0 {
+			tx.Outputs[0].ScriptPubKey[0] ^= 0xff
+			if reflect.DeepEqual(tx.Outputs[0].ScriptPubKey, wireTx.Outputs[0].ScriptPubKey) {
+				t.Errorf("Expected the scriptPubKey to reference the raw transaction for testTx: %+v", testTx)
+			}
+		}
+	}
+}
+
+func TestDeserializeTxInvalid(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		raw, _ := hex.DecodeString(testTx.RawTx)
+		for i := 0; i < len(raw); i++ {
+			if _, err := DeserializeTx(raw[:i]); err == nil {
+				t.Errorf("Expected an error for a transaction truncated to %d bytes for testTx: %+v", i, testTx)
+				break
+			}
+		}
+		if _, err := DeserializeTx(append(raw, 0x00)); err != ErrTrailingData {
+			t.Errorf("Expected ErrTrailingData, but got %v for testTx: %+v", err, testTx)
+		}
+	}
+
+	invalid := map[string]string{
+		"invalid witness flag":   "010000000002",
+		"superfluous witness":    "0100000000010100000000000000000000000000000000000000000000000000000000000000000000000000ffffffff010000000000000000000000000000",
+		"too many inputs":        "01000000fe00000001",
+		"too many outputs":       "010000000100000000000000000000000000000000000000000000000000000000000000000000000000fe00000001",
+		"non-canonical count":    "01000000fd0100",
+		"scriptSig past the end": "010000000100000000000000000000000000000000000000000000000000000000000000000000000002ffffffff",
+	}
+	for name, rawTx := range invalid {
+		raw, _ := hex.DecodeString(rawTx)
+		if _, err := DeserializeTx(raw); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func BenchmarkDeserializeTx(b *testing.B) {
+	raws := benchmarkRawTxns()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, raw := range raws {
+			if _, err := DeserializeTx(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDeserializeRawTxBytes(b *testing.B) {
+	raws := benchmarkRawTxns()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, raw := range raws {
+			if _, err := DeserializeRawTxBytes(raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkRawTxns() (raws [][]byte) {
+	for _, testTx := range GetTestTransactions() {
+		raw, _ := hex.DecodeString(testTx.RawTx)
+		raws = append(raws, raw)
+	}
+	return raws
+}
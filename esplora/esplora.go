@@ -0,0 +1,218 @@
+// Package esplora imports transactions in the JSON format of the Esplora and
+// mempool.space REST APIs, for example the responses of /api/tx/:txid and
+// /api/block/:hash/txs or datasets exported from them.
+//
+// Unlike a raw transaction, the JSON includes the prevouts of the inputs. They
+// are attached to the imported rawtx.Tx, so fee and prevout dependent
+// information is available without a node.
+package esplora
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Tx is a transaction in the Esplora JSON format.
+type Tx struct {
+	TxID     rawtx.Hash `json:"txid"`
+	Version  int32      `json:"version"`
+	Locktime uint32     `json:"locktime"`
+	Vin      []Vin      `json:"vin"`
+	Vout     []Vout     `json:"vout"`
+	// Size, Weight and Fee are checked against the imported transaction if
+	// present.
+	Size   int    `json:"size,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+	Fee    *int64 `json:"fee,omitempty"`
+	Status Status `json:"status"`
+}
+
+// Vin is a transaction input in the Esplora JSON format. The prevout is nil
+// for coinbase inputs.
+type Vin struct {
+	TxID       rawtx.Hash `json:"txid"`
+	Vout       uint32     `json:"vout"`
+	Prevout    *Vout      `json:"prevout"`
+	ScriptSig  string     `json:"scriptsig"`
+	Witness    []string   `json:"witness,omitempty"`
+	IsCoinbase bool       `json:"is_coinbase"`
+	Sequence   uint32     `json:"sequence"`
+}
+
+// Vout is a transaction output in the Esplora JSON format. The ASM fields of
+// the API aren't needed and are ignored.
+type Vout struct {
+	ScriptPubKey        string `json:"scriptpubkey"`
+	ScriptPubKeyType    string `json:"scriptpubkey_type,omitempty"`
+	ScriptPubKeyAddress string `json:"scriptpubkey_address,omitempty"`
+	Value               int64  `json:"value"`
+}
+
+// Status is the confirmation status of a transaction in the Esplora JSON
+// format. The block fields are only set for confirmed transactions.
+type Status struct {
+	Confirmed   bool        `json:"confirmed"`
+	BlockHeight int64       `json:"block_height,omitempty"`
+	BlockHash   *rawtx.Hash `json:"block_hash,omitempty"`
+	BlockTime   int64       `json:"block_time,omitempty"`
+}
+
+// ErrMismatch is wrapped by the errors returned if the imported transaction
+// doesn't match the txid, size, weight or fee in the JSON.
+var ErrMismatch = errors.New("transaction doesn't match the JSON")
+
+// ToTx builds the transaction with the prevouts of the inputs attached. An
+// error wrapping ErrMismatch is returned if the built transaction doesn't
+// match the txid or, if present, the size, weight and fee in the JSON.
+func (t *Tx) ToTx() (*rawtx.Tx, error) {
+	wireTx := wire.NewMsgTx(t.Version)
+	wireTx.LockTime = t.Locktime
+	prevouts := make([]*rawtx.Output, len(t.Vin))
+	for i, vin := range t.Vin {
+		scriptSig, err := hex.DecodeString(vin.ScriptSig)
+		if err != nil {
+			return nil, fmt.Errorf("vin %d: scriptsig: %s", i, err)
+		}
+		witness := make(wire.TxWitness, len(vin.Witness))
+		for j, element := range vin.Witness {
+			if witness[j], err = hex.DecodeString(element); err != nil {
+				return nil, fmt.Errorf("vin %d: witness element %d: %s", i, j, err)
+			}
+		}
+		outpoint := wire.NewOutPoint((*chainhash.Hash)(&vin.TxID), vin.Vout)
+		txIn := wire.NewTxIn(outpoint, scriptSig, witness)
+		txIn.Sequence = vin.Sequence
+		wireTx.AddTxIn(txIn)
+
+		if vin.Prevout != nil {
+			if prevouts[i], err = vin.Prevout.toOutput(); err != nil {
+				return nil, fmt.Errorf("vin %d: prevout: %s", i, err)
+			}
+		}
+	}
+	for i, vout := range t.Vout {
+		scriptPubKey, err := hex.DecodeString(vout.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("vout %d: scriptpubkey: %s", i, err)
+		}
+		wireTx.AddTxOut(wire.NewTxOut(vout.Value, scriptPubKey))
+	}
+
+	var raw bytes.Buffer
+	if err := wireTx.Serialize(&raw); err != nil {
+		return nil, err
+	}
+	tx, err := rawtx.DeserializeTx(raw.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for i := range tx.Inputs {
+		tx.Inputs[i].Prevout = prevouts[i]
+	}
+
+	if err := t.check(&tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func (v *Vout) toOutput() (*rawtx.Output, error) {
+	scriptPubKey, err := hex.DecodeString(v.ScriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+	return rawtx.NewOutput(v.Value, scriptPubKey), nil
+}
+
+// check compares the built transaction with the txid, size, weight and fee in
+// the JSON.
+func (t *Tx) check(tx *rawtx.Tx) error {
+	if tx.TxID() != t.TxID {
+		return fmt.Errorf("%w: txid %s, but the transaction hashes to %s", ErrMismatch, t.TxID, tx.TxID())
+	}
+	if t.Size != 0 && t.Size != tx.GetSizeWithWitness() {
+		return fmt.Errorf("%w: size %d of %s, but the transaction is %d bytes", ErrMismatch, t.Size, t.TxID, tx.GetSizeWithWitness())
+	}
+	if t.Weight != 0 && t.Weight != tx.GetWeight() {
+		return fmt.Errorf("%w: weight %d of %s, but the transaction weighs %d WU", ErrMismatch, t.Weight, t.TxID, tx.GetWeight())
+	}
+	// Esplora reports a fee of zero for coinbase transactions
+	if fee, ok := tx.GetFee(); ok && t.Fee != nil && *t.Fee != fee {
+		return fmt.Errorf("%w: fee %d of %s, but the prevouts result in a fee of %d", ErrMismatch, *t.Fee, t.TxID, fee)
+	}
+	return nil
+}
+
+// ParseTx imports a transaction from a JSON object as returned by
+// /api/tx/:txid.
+func ParseTx(b []byte) (*rawtx.Tx, error) {
+	var t Tx
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return t.ToTx()
+}
+
+// Decoder reads transactions in the Esplora JSON format from a stream. The
+// stream can contain a JSON array of objects as returned by
+// /api/block/:hash/txs, or one or more objects, for example newline-delimited.
+type Decoder struct {
+	r       *bufio.Reader
+	dec     *json.Decoder
+	isArray bool
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next transaction in the stream, or io.EOF after the last
+// transaction. The transaction is returned as in the JSON, use ToTx to build
+// a rawtx.Tx from it.
+func (d *Decoder) Next() (*Tx, error) {
+	if d.dec == nil {
+		if err := d.start(); err != nil {
+			return nil, err
+		}
+	}
+	if d.isArray && !d.dec.More() {
+		return nil, io.EOF
+	}
+	var t Tx
+	if err := d.dec.Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// start checks if the stream starts with an array and consumes its opening
+// bracket.
+func (d *Decoder) start() error {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		d.r.UnreadByte()
+		d.dec = json.NewDecoder(d.r)
+		if c == '[' {
+			d.isArray = true
+			_, err := d.dec.Token()
+			return err
+		}
+		return nil
+	}
+}
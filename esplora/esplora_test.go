@@ -0,0 +1,164 @@
+package esplora
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+)
+
+var fixtures = []string{"genesis_coinbase.json", "block_170.json", "bip143_p2wpkh.json", "bip143_p2sh_p2wpkh.json"}
+
+func readFixture(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return b
+}
+
+func TestParseTx(t *testing.T) {
+	for _, fixture := range fixtures {
+		b := readFixture(t, fixture)
+		var expected Tx
+		if err := json.Unmarshal(b, &expected); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		tx, err := ParseTx(b)
+		if err != nil {
+			t.Fatalf("Expected %s to be imported, but got %s", fixture, err)
+		}
+		if tx.TxID() != expected.TxID || len(tx.Inputs) != len(expected.Vin) || len(tx.Outputs) != len(expected.Vout) {
+			t.Errorf("Expected the transaction %s, but got %+v", expected.TxID, tx)
+		}
+
+		if tx.IsCoinbase() {
+			if tx.HasAllPrevouts() || tx.Stats().HasFee {
+				t.Errorf("Expected no prevouts and fee for the coinbase in %s", fixture)
+			}
+			continue
+		}
+		for i, in := range tx.Inputs {
+			if in.Prevout == nil || in.Prevout.Value != expected.Vin[i].Prevout.Value {
+				t.Errorf("Expected the prevout of input %d in %s to be attached, but got %+v", i, fixture, in.Prevout)
+			}
+		}
+		stats := tx.Stats()
+		if !stats.HasFee || stats.Fee != *expected.Fee {
+			t.Errorf("Expected the fee %d for %s, but got %d (%t)", *expected.Fee, fixture, stats.Fee, stats.HasFee)
+		}
+	}
+}
+
+func TestParseTxPrevouts(t *testing.T) {
+	tx, err := ParseTx(readFixture(t, "bip143_p2wpkh.json"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if tx.Inputs[0].Prevout.GetType() != rawtx.OutP2PK || tx.Inputs[1].Prevout.GetType() != rawtx.OutP2WPKH {
+		t.Errorf("Expected a P2PK and a P2WPKH prevout, but got %s and %s", tx.Inputs[0].Prevout.GetType(), tx.Inputs[1].Prevout.GetType())
+	}
+
+	aggregator := rawtx.NewStatsAggregator()
+	aggregator.Add(tx.Stats())
+	expectedFeeRate := float64(889210000) / float64(tx.GetSizeWithoutWitness())
+	if aggregator.TxnsWithFee != 1 || aggregator.FeeRate.Max != expectedFeeRate {
+		t.Errorf("Expected a feerate of %f, but got %+v", expectedFeeRate, aggregator.FeeRate)
+	}
+
+	var block170 Tx
+	if err := json.Unmarshal(readFixture(t, "block_170.json"), &block170); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !block170.Status.Confirmed || block170.Status.BlockHeight != 170 || block170.Status.BlockHash.String() != "00000000d1145790a8694403d4063f323d499e655c83426834d4ce2f8dd4a2ee" {
+		t.Errorf("Expected the transaction to be confirmed in block 170, but got %+v", block170.Status)
+	}
+}
+
+func TestToTxMismatch(t *testing.T) {
+	modifications := map[string]func(*Tx){
+		"txid":          func(tx *Tx) { tx.TxID[0] ^= 1 },
+		"size":          func(tx *Tx) { tx.Size++ },
+		"weight":        func(tx *Tx) { tx.Weight++ },
+		"fee":           func(tx *Tx) { *tx.Fee++ },
+		"prevout value": func(tx *Tx) { tx.Vin[0].Prevout.Value++ },
+		"output value":  func(tx *Tx) { tx.Vout[0].Value++ },
+	}
+	for name, modify := range modifications {
+		var tx Tx
+		if err := json.Unmarshal(readFixture(t, "bip143_p2wpkh.json"), &tx); err != nil {
+			t.Fatal(err.Error())
+		}
+		modify(&tx)
+		if _, err := tx.ToTx(); !errors.Is(err, ErrMismatch) {
+			t.Errorf("Expected ErrMismatch for a modified %s, but got %v", name, err)
+		}
+	}
+
+	var tx Tx
+	if err := json.Unmarshal(readFixture(t, "bip143_p2wpkh.json"), &tx); err != nil {
+		t.Fatal(err.Error())
+	}
+	tx.Vin[1].Witness[0] = "zz"
+	if _, err := tx.ToTx(); err == nil || errors.Is(err, ErrMismatch) {
+		t.Errorf("Expected an error for an invalid witness, but got %v", err)
+	}
+
+	// without fee and prevouts, only the txid is checked
+	tx = Tx{}
+	if err := json.Unmarshal(readFixture(t, "block_170.json"), &tx); err != nil {
+		t.Fatal(err.Error())
+	}
+	tx.Fee, tx.Size, tx.Weight, tx.Vin[0].Prevout = nil, 0, 0, nil
+	if imported, err := tx.ToTx(); err != nil || imported.HasAllPrevouts() {
+		t.Errorf("Expected the transaction to be imported without prevouts, but got %v", err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	var ndjson bytes.Buffer
+	for _, fixture := range fixtures {
+		if err := json.Compact(&ndjson, readFixture(t, fixture)); err != nil {
+			t.Fatal(err.Error())
+		}
+		ndjson.WriteByte('\n')
+	}
+
+	inputs := map[string]string{
+		"array":  string(readFixture(t, "txs.json")),
+		"ndjson": ndjson.String(),
+	}
+	for name, input := range inputs {
+		dec := NewDecoder(strings.NewReader(input))
+		for i := 0; ; i++ {
+			tx, err := dec.Next()
+			if err == io.EOF {
+				if i != len(fixtures) {
+					t.Errorf("Expected %d transactions in the %s, but got %d", len(fixtures), name, i)
+				}
+				break
+			} else if err != nil {
+				t.Fatalf("Expected the %s to be decoded, but got %s", name, err)
+			}
+			if _, err := tx.ToTx(); err != nil {
+				t.Errorf("Expected transaction %d of the %s to be imported, but got %s", i, name, err)
+			}
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader(" \n"))
+	if _, err := dec.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF for an empty stream, but got %v", err)
+	}
+	dec = NewDecoder(strings.NewReader(`[{"txid": 1}]`))
+	if _, err := dec.Next(); err == nil || err == io.EOF {
+		t.Errorf("Expected an error for invalid JSON, but got %v", err)
+	}
+}
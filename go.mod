@@ -4,5 +4,7 @@ go 1.16
 
 require (
 	github.com/btcsuite/btcd v0.23.2
+	github.com/btcsuite/btcd/btcec/v2 v2.1.3
 	github.com/btcsuite/btcd/btcutil v1.1.0
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1
 )
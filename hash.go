@@ -0,0 +1,77 @@
+package rawtx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// HashSize is the size of a transaction or block hash in bytes.
+const HashSize = 32
+
+// Hash is a double SHA256 hash used as transaction and block identifier. The
+// bytes are stored in internal byte order. The string representation is in
+// the reversed display byte order as used by block explorers and Bitcoin Core.
+type Hash [HashSize]byte
+
+// DoubleSHA256 returns the double SHA256 hash of b.
+func DoubleSHA256(b []byte) Hash {
+	first := sha256.Sum256(b)
+	return Hash(sha256.Sum256(first[:]))
+}
+
+// String returns the hash as hex string in display byte order.
+func (h Hash) String() string {
+	var reversed [HashSize]byte
+	for i := 0; i < HashSize; i++ {
+		reversed[i] = h[HashSize-1-i]
+	}
+	return hex.EncodeToString(reversed[:])
+}
+
+// IsZero returns true if all bytes of the hash are zero.
+func (h Hash) IsZero() bool {
+	return h == Hash{}
+}
+
+// CloneBytes returns a copy of the hash bytes in internal byte order.
+func (h Hash) CloneBytes() []byte {
+	b := make([]byte, HashSize)
+	copy(b, h[:])
+	return b
+}
+
+// ParseHash parses a hash from a hex string in display byte order.
+func ParseHash(s string) (h Hash, err error) {
+	if len(s) != HashSize*2 {
+		return h, fmt.Errorf("invalid hash length of %d, expected %d hex characters", len(s), HashSize*2)
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	for i := 0; i < HashSize; i++ {
+		h[i] = decoded[HashSize-1-i]
+	}
+	return h, nil
+}
+
+// MarshalJSON marshals the hash as JSON string in display byte order.
+func (h Hash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+// UnmarshalJSON unmarshals a hash from a JSON string in display byte order.
+func (h *Hash) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseHash(s)
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
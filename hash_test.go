@@ -0,0 +1,83 @@
+package rawtx
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseHash(t *testing.T) {
+	genesis := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	h, err := ParseHash(genesis)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if h[0] != 0x6f || h[31] != 0x00 {
+		t.Errorf("Expected the hash to be stored in internal byte order, but got %x", h[:])
+	}
+	if h.String() != genesis {
+		t.Errorf("Expected String() to be %s, but got %s", genesis, h.String())
+	}
+
+	invalid := []string{"", "00", genesis + "00", "zz" + genesis[2:]}
+	for _, s := range invalid {
+		if _, err := ParseHash(s); err == nil {
+			t.Errorf("Expected an error when parsing %q", s)
+		}
+	}
+}
+
+func TestHashJSON(t *testing.T) {
+	h, _ := ParseHash("f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16")
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(b) != `"f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"` {
+		t.Errorf("Expected the hash to be marshalled as display string, but got %s", b)
+	}
+
+	var unmarshalled Hash
+	if err := json.Unmarshal(b, &unmarshalled); err != nil {
+		t.Fatal(err.Error())
+	}
+	if unmarshalled != h {
+		t.Errorf("Expected the unmarshalled hash to be %s, but got %s", h, unmarshalled)
+	}
+
+	if err := json.Unmarshal([]byte(`"f418"`), &unmarshalled); err == nil {
+		t.Errorf("Expected an error when unmarshalling a short hash")
+	}
+}
+
+func TestWTxID(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		if tx.TxID() != tx.Hash || tx.TxID().String() != tx.HashString {
+			t.Errorf("Expected TxID() to be %s, but got %s for testTx: %+v", tx.HashString, tx.TxID(), testTx)
+		}
+
+		if tx.GetSizeWithWitness() == tx.GetSizeWithoutWitness() {
+			if tx.WTxID() != tx.TxID() {
+				t.Errorf("Expected WTxID() to equal the txid for a non-witness transaction, but got %s for testTx: %+v", tx.WTxID(), testTx)
+			}
+		} else if tx.WTxID() == tx.TxID() {
+			t.Errorf("Expected WTxID() to differ from the txid for a witness transaction for testTx: %+v", testTx)
+		}
+
+		stats := tx.Stats()
+		if stats.TxID != tx.TxID() || stats.WTxID != tx.WTxID() {
+			t.Errorf("Expected the TxStats to contain the txid and wtxid for testTx: %+v", testTx)
+		}
+	}
+
+	tx, _ := StringToTx(testTxns[0].RawTx)
+	expected := "c36c38370907df2324d9ce9d149d191192f338b37665a82e78e76a12c909b762"
+	if tx.WTxID().String() != expected {
+		t.Errorf("Expected WTxID() to be %s, but got %s", expected, tx.WTxID())
+	}
+}
@@ -0,0 +1,275 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Version bits as defined in BIP9. A block signals for deployments with the
+// bits 0 to 28 of the version if the top three bits are 001.
+const (
+	VersionBitsTopMask uint32 = 0xe0000000
+	VersionBitsTopBits uint32 = 0x20000000
+	VersionBitsNumBits        = 29
+)
+
+// MaxFutureBlockTime is the maximum time a block timestamp can be ahead of
+// the current time to be accepted by Bitcoin Core.
+const MaxFutureBlockTime = 2 * time.Hour
+
+// medianTimeSpan is the number of previous blocks the median time past is
+// calculated from.
+const medianTimeSpan = 11
+
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToTarget decodes a target in the compact nBits format. False is
+// returned if the target is negative, zero or overflows 256 bits, which
+// Bitcoin Core treats as invalid.
+func CompactToTarget(bits uint32) (*big.Int, bool) {
+	exponent := uint(bits >> 24)
+	mantissa := int64(bits & 0x007fffff)
+	negative := bits&0x00800000 != 0
+
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+	overflow := mantissa != 0 && (exponent > 34 || (mantissa > 0xff && exponent > 33) || (mantissa > 0xffff && exponent > 32))
+	if target.Sign() == 0 || (negative && mantissa != 0) || overflow {
+		return target, false
+	}
+	return target, true
+}
+
+// Target returns the proof-of-work target the block hash must not exceed.
+// False is returned for an invalid compact target.
+func (h *BlockHeader) Target() (*big.Int, bool) {
+	return CompactToTarget(h.Bits)
+}
+
+// Difficulty returns the difficulty as in Bitcoin Core's getblockheader RPC:
+// the multiple of the mainnet minimum difficulty target 0x1d00ffff.
+func (h *BlockHeader) Difficulty() float64 {
+	shift := (h.Bits >> 24) & 0xff
+	difficulty := float64(0x0000ffff) / float64(h.Bits&0x00ffffff)
+	for ; shift < 29; shift++ {
+		difficulty *= 256
+	}
+	for ; shift > 29; shift-- {
+		difficulty /= 256
+	}
+	return difficulty
+}
+
+// Work returns the expected number of hashes needed to find a block with the
+// target, 2^256 / (target + 1). It's zero for an invalid target. The sum of
+// the work of all blocks is the chainwork.
+func (h *BlockHeader) Work() *big.Int {
+	target, ok := h.Target()
+	if !ok {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(oneLsh256, target.Add(target, big.NewInt(1)))
+}
+
+// CheckProofOfWork returns true if the block hash doesn't exceed the valid
+// target of the header and the target doesn't exceed the proof-of-work limit
+// of the network.
+func (h *BlockHeader) CheckProofOfWork(params *chaincfg.Params) bool {
+	target, ok := h.Target()
+	if !ok || target.Cmp(params.PowLimit) > 0 {
+		return false
+	}
+	return hashToBig(h.Hash()).Cmp(target) <= 0
+}
+
+// hashToBig interprets the hash as little-endian 256 bit number.
+func hashToBig(hash Hash) *big.Int {
+	var reversed [HashSize]byte
+	for i := 0; i < HashSize; i++ {
+		reversed[i] = hash[HashSize-1-i]
+	}
+	return new(big.Int).SetBytes(reversed[:])
+}
+
+// HasVersionBitsTopBits returns true if the top three bits of the version are
+// 001, which is required for version bits signaling as defined in BIP9.
+func (h *BlockHeader) HasVersionBitsTopBits() bool {
+	return uint32(h.Version)&VersionBitsTopMask == VersionBitsTopBits
+}
+
+// SignalsBit returns true if the header signals for the BIP9 deployment with
+// the bit.
+func (h *BlockHeader) SignalsBit(bit int) bool {
+	if bit < 0 || bit >= VersionBitsNumBits || !h.HasVersionBitsTopBits() {
+		return false
+	}
+	return uint32(h.Version)&(1<<uint(bit)) != 0
+}
+
+// SignaledBits returns the BIP9 version bits the header signals for. It's
+// empty if the version doesn't have the version bits top bits.
+func (h *BlockHeader) SignaledBits() (bits []int) {
+	for bit := 0; bit < VersionBitsNumBits; bit++ {
+		if h.SignalsBit(bit) {
+			bits = append(bits, bit)
+		}
+	}
+	return bits
+}
+
+// Time returns the timestamp of the header.
+func (h *BlockHeader) Time() time.Time {
+	return time.Unix(int64(h.Timestamp), 0).UTC()
+}
+
+// IsTimeTooNew returns true if the timestamp is more than MaxFutureBlockTime
+// ahead of now.
+func (h *BlockHeader) IsTimeTooNew(now time.Time) bool {
+	return h.Time().After(now.Add(MaxFutureBlockTime))
+}
+
+// MedianTimePast returns the median timestamp of the last 11 headers, or of
+// all headers if there are fewer. The timestamp of a block must be greater
+// than the median time past of its previous blocks.
+func MedianTimePast(headers []BlockHeader) uint32 {
+	if len(headers) == 0 {
+		return 0
+	}
+	if len(headers) > medianTimeSpan {
+		headers = headers[len(headers)-medianTimeSpan:]
+	}
+	timestamps := make([]uint32, len(headers))
+	for i := range headers {
+		timestamps[i] = headers[i].Timestamp
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// HeaderError describes why a header in a header chain is invalid. Index is
+// the position of the header in the chain.
+type HeaderError struct {
+	Type    BlockErrorType
+	Index   int
+	Hash    Hash
+	Details string
+}
+
+func (he *HeaderError) Error() string {
+	return fmt.Sprintf("%s (header %d, %s): %s", he.Type.RejectReason(), he.Index, he.Hash, he.Details)
+}
+
+// ValidateHeaderChain checks that each header references the hash of the
+// previous header, has a valid target not exceeding the proof-of-work limit
+// of the network and a hash meeting it, and has a timestamp greater than the
+// median time past of the previous headers. The previous block of the first
+// header isn't checked. The chainwork of the headers is returned. Difficulty
+// adjustments aren't checked.
+func ValidateHeaderChain(headers []BlockHeader, params *chaincfg.Params) (*big.Int, error) {
+	chainwork := new(big.Int)
+	var prevHash Hash
+	for i := range headers {
+		h := &headers[i]
+		hash := h.Hash()
+		if i > 0 && h.PrevBlock != prevHash {
+			return chainwork, &HeaderError{Type: BlockErrPrevBlockMismatch, Index: i, Hash: hash,
+				Details: fmt.Sprintf("previous block is %s, but the previous header hashes to %s", h.PrevBlock, prevHash)}
+		}
+		if target, ok := h.Target(); !ok || target.Cmp(params.PowLimit) > 0 {
+			return chainwork, &HeaderError{Type: BlockErrBadDiffBits, Index: i, Hash: hash,
+				Details: fmt.Sprintf("bits 0x%08x are an invalid target or exceed the proof-of-work limit", h.Bits)}
+		}
+		if !h.CheckProofOfWork(params) {
+			return chainwork, &HeaderError{Type: BlockErrHighHash, Index: i, Hash: hash,
+				Details: fmt.Sprintf("hash exceeds the target of bits 0x%08x", h.Bits)}
+		}
+		if i > 0 {
+			if mtp := MedianTimePast(headers[:i]); h.Timestamp <= mtp {
+				return chainwork, &HeaderError{Type: BlockErrTimeTooOld, Index: i, Hash: hash,
+					Details: fmt.Sprintf("timestamp %d isn't greater than the median time past %d", h.Timestamp, mtp)}
+			}
+		}
+		chainwork.Add(chainwork, h.Work())
+		prevHash = hash
+	}
+	return chainwork, nil
+}
+
+// ReadHeaders reads concatenated 80 byte serialized headers until io.EOF.
+func ReadHeaders(r io.Reader) (headers []BlockHeader, err error) {
+	b := make([]byte, BlockHeaderSize)
+	for {
+		n, err := io.ReadFull(r, b)
+		if err == io.EOF {
+			return headers, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("header %d: %d of %d bytes: %s", len(headers), n, BlockHeaderSize, err)
+		}
+		header, _ := DeserializeBlockHeader(b)
+		headers = append(headers, header)
+	}
+}
+
+// ReadHeadersHex reads headers in hex, one per line, as returned by Bitcoin
+// Core's getblockheader RPC with verbose set to false. Empty lines are
+// skipped.
+func ReadHeadersHex(r io.Reader) (headers []BlockHeader, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range bytes.Split(b, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		raw, err := hex.DecodeString(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if len(raw) != BlockHeaderSize {
+			return nil, fmt.Errorf("line %d: header is %d bytes long, expected %d bytes", i+1, len(raw), BlockHeaderSize)
+		}
+		header, _ := DeserializeBlockHeader(raw)
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// ReadHeadersFile reads the headers from a file with either concatenated
+// serialized headers or hex encoded headers, one per line. A file containing
+// only hex characters and whitespace is read as hex.
+func ReadHeadersFile(name string) ([]BlockHeader, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if isHexText(b) {
+		return ReadHeadersHex(bytes.NewReader(b))
+	}
+	return ReadHeaders(bytes.NewReader(b))
+}
+
+func isHexText(b []byte) bool {
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		case c == ' ', c == '\t', c == '\r', c == '\n':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// mainnetHeaders returns the headers of the mainnet blocks 0 to 2.
+func mainnetHeaders(t *testing.T) []BlockHeader {
+	rawHeaders := []string{
+		"0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c",
+		"010000006fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e61bc6649ffff001d01e36299",
+		"010000004860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a8300000000d5fdcc541e25de1c7a5addedf24858b8bb665c9f36ef744ee42c316022c90f9bb0bc6649ffff001d08d2bd61",
+	}
+	headers, err := ReadHeadersHex(strings.NewReader(strings.Join(rawHeaders, "\n")))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return headers
+}
+
+// mineRegtestHeaders returns a chain of n regtest headers with increasing
+// timestamps.
+func mineRegtestHeaders(n int) []BlockHeader {
+	headers := make([]BlockHeader, n)
+	var prevHash Hash
+	for i := range headers {
+		headers[i] = BlockHeader{Version: 0x20000000, PrevBlock: prevHash, Timestamp: 1296688602 + uint32(i)*600, Bits: 0x207fffff}
+		mine(&headers[i])
+		prevHash = headers[i].Hash()
+	}
+	return headers
+}
+
+func mine(h *BlockHeader) {
+	for !h.CheckProofOfWork(&chaincfg.RegressionNetParams) {
+		h.Nonce++
+	}
+}
+
+func TestMainnetHeaders(t *testing.T) {
+	headers := mainnetHeaders(t)
+	expectedHashes := []string{
+		"000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		"00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
+		"000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
+	}
+	for i, expected := range expectedHashes {
+		if hash := headers[i].Hash(); hash.String() != expected {
+			t.Errorf("Expected the hash %s for header %d, but got %s", expected, i, hash)
+		}
+	}
+
+	chainwork, err := ValidateHeaderChain(headers, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Expected the mainnet headers to be valid, but got %s", err)
+	}
+	// Bitcoin Core reports a chainwork of 0x300030003 at height 2
+	if chainwork.Cmp(big.NewInt(0x300030003)) != 0 {
+		t.Errorf("Expected a chainwork of 0x300030003, but got 0x%x", chainwork)
+	}
+
+	genesis := headers[0]
+	if genesis.Difficulty() != 1 {
+		t.Errorf("Expected a difficulty of 1, but got %f", genesis.Difficulty())
+	}
+	target, ok := genesis.Target()
+	// the proof-of-work limit is 2^224-1, the compact target is rounded to 0xffff * 2^208
+	if !ok || target.Cmp(chaincfg.MainNetParams.PowLimit) > 0 || target.Cmp(new(big.Int).Lsh(big.NewInt(0xffff), 208)) != 0 {
+		t.Errorf("Expected 0xffff * 2^208 as target, but got %x", target)
+	}
+	if !genesis.Time().Equal(time.Date(2009, 1, 3, 18, 15, 5, 0, time.UTC)) {
+		t.Errorf("Expected the genesis timestamp, but got %s", genesis.Time())
+	}
+	if genesis.HasVersionBitsTopBits() || len(genesis.SignaledBits()) != 0 {
+		t.Errorf("Expected version 1 not to signal, but got %v", genesis.SignaledBits())
+	}
+}
+
+func TestCompactToTarget(t *testing.T) {
+	tests := []struct {
+		bits     uint32
+		expected string
+		ok       bool
+	}{
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000", true},
+		{0x17053894, "53894" + strings.Repeat("0", 40), true},
+		{0x207fffff, "7fffff0000000000000000000000000000000000000000000000000000000000", true},
+		{0x03123456, "123456", true},
+		{0x02123456, "1234", true},
+		{0x01003456, "0", false},
+		{0x04923456, "", false},
+		{0x00000000, "0", false},
+		{0xff123456, "", false},
+	}
+	for _, test := range tests {
+		target, ok := CompactToTarget(test.bits)
+		if ok != test.ok || (test.expected != "" && target.Text(16) != test.expected) {
+			t.Errorf("Expected 0x%08x to decode to %s (%t), but got %s (%t)", test.bits, test.expected, test.ok, target.Text(16), ok)
+		}
+	}
+
+	difficulties := map[uint32]float64{
+		0x1d00ffff: 1,
+		0x1b0404cb: 16307.420938523983,
+		0x17053894: 53911173001054.59,
+	}
+	for bits, expected := range difficulties {
+		header := BlockHeader{Bits: bits}
+		if difficulty := header.Difficulty(); math.Abs(difficulty-expected) > expected*1e-12 {
+			t.Errorf("Expected the difficulty %f for 0x%08x, but got %f", expected, bits, difficulty)
+		}
+	}
+	if work := (&BlockHeader{Bits: 0x01003456}).Work(); work.Sign() != 0 {
+		t.Errorf("Expected no work for an invalid target, but got %s", work)
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	tests := []struct {
+		version int32
+		topBits bool
+		bits    []int
+	}{
+		{0x20000000, true, nil},
+		{0x20000002, true, []int{1}},
+		{0x30000012, true, []int{1, 4, 28}},
+		{0x3fffffff - 0x0ffffff0, true, []int{0, 1, 2, 3, 28}},
+		{0x60000002, false, nil},
+		{-0x20000000 + 2, false, nil},
+		{4, false, nil},
+	}
+	for _, test := range tests {
+		header := BlockHeader{Version: test.version}
+		if header.HasVersionBitsTopBits() != test.topBits || !reflect.DeepEqual(header.SignaledBits(), test.bits) {
+			t.Errorf("Expected version 0x%08x to signal %v (%t), but got %v", uint32(test.version), test.bits, test.topBits, header.SignaledBits())
+		}
+	}
+	header := BlockHeader{Version: 0x20000004}
+	if !header.SignalsBit(2) || header.SignalsBit(3) || header.SignalsBit(-1) || header.SignalsBit(29) {
+		t.Error("Expected the header to only signal bit 2")
+	}
+}
+
+func TestMedianTimePast(t *testing.T) {
+	var headers []BlockHeader
+	for _, timestamp := range []uint32{10, 5, 20, 1, 1, 1, 1, 1, 1, 1, 1, 1, 30, 40} {
+		headers = append(headers, BlockHeader{Timestamp: timestamp})
+	}
+	if mtp := MedianTimePast(headers[:3]); mtp != 10 {
+		t.Errorf("Expected a median time past of 10, but got %d", mtp)
+	}
+	// only the last 11 headers are used
+	if mtp := MedianTimePast(headers); mtp != 1 {
+		t.Errorf("Expected a median time past of 1, but got %d", mtp)
+	}
+	if mtp := MedianTimePast(nil); mtp != 0 {
+		t.Errorf("Expected a median time past of 0 without headers, but got %d", mtp)
+	}
+
+	now := time.Unix(1600000000, 0)
+	if (&BlockHeader{Timestamp: 1600000000 + 7200}).IsTimeTooNew(now) || !(&BlockHeader{Timestamp: 1600000000 + 7201}).IsTimeTooNew(now) {
+		t.Error("Expected timestamps more than two hours in the future to be too new")
+	}
+}
+
+func TestValidateHeaderChain(t *testing.T) {
+	headers := mineRegtestHeaders(15)
+	chainwork, err := ValidateHeaderChain(headers, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Expected the regtest headers to be valid, but got %s", err)
+	}
+	if chainwork.Cmp(big.NewInt(30)) != 0 {
+		t.Errorf("Expected a chainwork of 30, but got %s", chainwork)
+	}
+
+	mutations := map[string]struct {
+		mutate   func(headers []BlockHeader)
+		expected BlockErrorType
+		index    int
+	}{
+		"previous block": {func(headers []BlockHeader) {
+			headers[5].PrevBlock[0] ^= 1
+			mine(&headers[5])
+		}, BlockErrPrevBlockMismatch, 5},
+		"bits above the limit": {func(headers []BlockHeader) {
+			headers[0].Bits = 0x2100ffff
+		}, BlockErrBadDiffBits, 0},
+		"negative bits": {func(headers []BlockHeader) {
+			headers[0].Bits = 0x20800001
+		}, BlockErrBadDiffBits, 0},
+		"hash above target": {func(headers []BlockHeader) {
+			for headers[3].CheckProofOfWork(&chaincfg.RegressionNetParams) {
+				headers[3].Nonce++
+			}
+		}, BlockErrHighHash, 3},
+		"timestamp": {func(headers []BlockHeader) {
+			headers[12].Timestamp = MedianTimePast(headers[:12])
+			mine(&headers[12])
+		}, BlockErrTimeTooOld, 12},
+	}
+	for name, mutation := range mutations {
+		headers := mineRegtestHeaders(15)
+		mutation.mutate(headers)
+		_, err := ValidateHeaderChain(headers, &chaincfg.RegressionNetParams)
+		headerErr, ok := err.(*HeaderError)
+		if !ok {
+			t.Errorf("Expected a HeaderError for a mutated %s, but got %v", name, err)
+			continue
+		}
+		if headerErr.Type != mutation.expected || headerErr.Index != mutation.index || headerErr.Hash != headers[mutation.index].Hash() {
+			t.Errorf("Expected %s at header %d for a mutated %s, but got %s", mutation.expected, mutation.index, name, headerErr)
+		}
+	}
+
+	// the mainnet proof-of-work limit is lower than the regtest target
+	if _, err := ValidateHeaderChain(headers, &chaincfg.MainNetParams); err == nil || err.(*HeaderError).Type != BlockErrBadDiffBits {
+		t.Errorf("Expected regtest headers to be invalid on mainnet, but got %v", err)
+	}
+}
+
+func TestReadHeadersFile(t *testing.T) {
+	headers := mainnetHeaders(t)
+	var raw bytes.Buffer
+	var hexLines strings.Builder
+	for i := range headers {
+		raw.Write(headers[i].Serialize())
+		hexLines.WriteString(hex.EncodeToString(headers[i].Serialize()) + "\r\n\n")
+	}
+
+	dir, err := ioutil.TempDir("", "rawtx")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{"headers.dat": raw.Bytes(), "headers.txt": []byte(hexLines.String())}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		read, err := ReadHeadersFile(path)
+		if err != nil {
+			t.Fatalf("Expected %s to be read, but got %s", name, err)
+		}
+		if !reflect.DeepEqual(read, headers) {
+			t.Errorf("Expected the mainnet headers from %s, but got %+v", name, read)
+		}
+	}
+
+	if _, err := ReadHeaders(bytes.NewReader(raw.Bytes()[:100])); err == nil {
+		t.Error("Expected an error for a truncated header")
+	}
+	if _, err := ReadHeadersHex(strings.NewReader("0100\n")); err == nil {
+		t.Error("Expected an error for a short hex header")
+	}
+	if _, err := ReadHeadersHex(strings.NewReader("zz\n")); err == nil {
+		t.Error("Expected an error for invalid hex")
+	}
+	if _, err := ReadHeadersFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
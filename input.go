@@ -2,6 +2,7 @@ package rawtx
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/btcsuite/btcd/wire"
 )
@@ -50,42 +51,67 @@ func (it InputType) String() string {
 	return inputTypeStringMap[it]
 }
 
+// ParseInputType returns the InputType with the name s as returned by String().
+func ParseInputType(s string) (InputType, error) {
+	for it, name := range inputTypeStringMap {
+		if name == s {
+			return it, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown input type %q", s)
+}
+
+// MarshalText marshals the input type as its name. The zero value and
+// unknown values are marshalled as an empty string.
+func (it InputType) MarshalText() ([]byte, error) {
+	return []byte(inputTypeStringMap[it]), nil
+}
+
+// UnmarshalText unmarshals the input type from its name. An empty string is
+// unmarshalled as the zero value.
+func (it *InputType) UnmarshalText(text []byte) (err error) {
+	if len(text) == 0 {
+		*it = 0
+		return nil
+	}
+	*it, err = ParseInputType(string(text))
+	return err
+}
+
 // Outpoint represents a bitcoin transaction input's previous outpoint as a struct.
 type Outpoint struct {
-	PrevTxHash  [32]byte
+	PrevTxHash  Hash
 	OutputIndex uint32
 }
 
 // FromWireOutpoint populates an Outpoint struct with values from a wire.OutPoint.
 func (outpoint *Outpoint) FromWireOutpoint(wireOutpoint *wire.OutPoint) {
-	copy(outpoint.PrevTxHash[:], wireOutpoint.Hash.CloneBytes())
+	outpoint.PrevTxHash = Hash(wireOutpoint.Hash)
 	outpoint.OutputIndex = wireOutpoint.Index
 }
 
 // Input represents a bitcoin transaction input as a struct.
+// Prevout is the output spent by the input. It's nil if unknown, as the
+// prevout is not part of the raw transaction.
 type Input struct {
 	Outpoint  Outpoint
 	ScriptSig BitcoinScript
 	Sequence  uint32
 	Witness   ParsedBitcoinScript
+	Prevout   *Output
 	inputType InputType
+	// parsedScriptSig caches the parsed ScriptSig
+	parsedScriptSig *parsedScriptCache
 }
 
 // FromWireTxIn populates an Input struct with values from a wire.TxIn.
 func (in *Input) FromWireTxIn(txIn *wire.TxIn) {
 	in.Sequence = txIn.Sequence
 	in.ScriptSig = txIn.SignatureScript
+	in.parsedScriptSig = newParsedScriptCache(in.ScriptSig)
 	in.Outpoint.FromWireOutpoint(&txIn.PreviousOutPoint)
 	for _, witnessElement := range txIn.Witness {
-		elementLength := len(witnessElement)
-		// if the element is empty then add a OP_0 opcode
-		if elementLength == 0 {
-			in.Witness = append(in.Witness, ParsedOpCode{OpCode: Op0})
-		} else {
-			opcode := GetDataPushOpCodeForLength(elementLength)
-			parsedOpCode := ParsedOpCode{OpCode: opcode, PushedData: witnessElement}
-			in.Witness = append(in.Witness, parsedOpCode)
-		}
+		in.Witness = append(in.Witness, witnessElementToParsedOpCode(witnessElement))
 	}
 	in.inputType = in.GetType()
 }
@@ -125,6 +151,13 @@ func (in *Input) GetType() InputType {
 	return InUNKNOWN
 }
 
+// ParsedScriptSig returns the parsed scriptSig of the input. The scriptSig is
+// parsed only once for inputs constructed with FromWireTxIn or DeserializeTx.
+// The returned ParsedBitcoinScript is shared and must not be modified.
+func (in *Input) ParsedScriptSig() ParsedBitcoinScript {
+	return in.parsedScriptSig.get(in.ScriptSig)
+}
+
 // HasWitness returns a boolean indicating if an input has a witness
 func (in *Input) HasWitness() bool {
 	return len(in.Witness) > 0
@@ -133,7 +166,7 @@ func (in *Input) HasWitness() bool {
 // SpendsNativeSegWit checks if the input spend is a native SegWit input.
 // A native SegWit input has a witness but an empty scriptSig.
 func (in *Input) SpendsNativeSegWit() bool {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if len(pbs) == 0 && in.HasWitness() {
 		return in.SpendsP2WPKH() || in.SpendsP2TR() || in.SpendsP2WSH()
 	}
@@ -270,7 +303,7 @@ func (in *Input) SpendsP2TRKeyPath() bool {
 // OP_0 <signature> [<signature>] [<signature>] (where [] means optional)
 func (in *Input) SpendsP2MS() bool {
 	if !in.HasWitness() && len(in.ScriptSig) > 0 {
-		pbs := in.ScriptSig.Parse()
+		pbs := in.ParsedScriptSig()
 		if len(pbs) >= 2 && pbs[0].OpCode == Op0 {
 			switch len(pbs) - 1 {
 			case 1: // has one signature for a 1-of-(1/2/3) multisig
@@ -306,7 +339,7 @@ func (in *Input) SpendsNestedSegWit() bool {
 // A nested P2WPKH input has a witness and the scriptSig looks like
 // OP_DATA_22(OP_0 OP_DATA_20(20 byte hash))
 func (in *Input) SpendsNestedP2WPKH() bool {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if in.HasWitness() && len(pbs) == 1 && pbs[0].OpCode == OpDATA22 {
 		var inner BitcoinScript = pbs[0].PushedData
 		innerPbs := inner.Parse()
@@ -323,7 +356,7 @@ func (in *Input) SpendsNestedP2WPKH() bool {
 // A nested P2WSH input has a witness and the scriptSig looks like
 // OP_DATA_34(OP_0 OP_DATA_32(32 byte hash))
 func (in *Input) SpendsNestedP2WSH() bool {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if in.HasWitness() && len(pbs) == 1 && pbs[0].OpCode == OpDATA34 {
 		var inner BitcoinScript = pbs[0].PushedData
 		innerPbs := inner.Parse()
@@ -339,7 +372,7 @@ func (in *Input) SpendsNestedP2WSH() bool {
 // SpendsP2PKH checks if the input spend is a P2PKH input.
 // <signature> <pubkey>
 func (in *Input) SpendsP2PKH() (spendsP2PKH bool) {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if !in.HasWitness() && len(pbs) == 2 {
 		return pbs[0].IsECDSASignature(false) && pbs[1].IsECDSAPubKey()
 	}
@@ -350,7 +383,7 @@ func (in *Input) SpendsP2PKH() (spendsP2PKH bool) {
 // Additionally it returns a boolean indicating if the revealed pubkey is compressed.
 // <signature> <pubkey>
 func (in *Input) SpendsP2PKHWithIsCompressed() (spendsP2PKH bool, isCompressedPubKey bool) {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if !in.HasWitness() && len(pbs) == 2 {
 		isPubKey, isCompressedPubKey := pbs[1].IsECDSAPubKeyWithIsCompressed()
 		return pbs[0].IsECDSASignature(false) && isPubKey, isCompressedPubKey
@@ -362,7 +395,7 @@ func (in *Input) SpendsP2PKHWithIsCompressed() (spendsP2PKH bool, isCompressedPu
 // A P2PK input only contains the signature in the scriptSig.
 // <signature>
 func (in *Input) SpendsP2PK() bool {
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if !in.HasWitness() && len(pbs) == 1 {
 		return pbs[0].IsECDSASignature(false)
 	}
@@ -377,7 +410,7 @@ func (in *Input) SpendsP2SH() (spendsP2SH bool) {
 		return false
 	}
 
-	pbs := in.ScriptSig.Parse()
+	pbs := in.ParsedScriptSig()
 	if !in.HasWitness() && len(pbs) > 0 {
 		redeemScript := pbs[len(pbs)-1]
 		return !redeemScript.IsECDSASignature(false) && !redeemScript.IsECDSAPubKey() // is not a signature and is not a pubkey
@@ -389,7 +422,7 @@ func (in *Input) SpendsP2SH() (spendsP2SH bool) {
 // The returned redeemScript is empty if the input does not spend a P2SH input.
 func (in *Input) GetP2SHRedeemScript() (redeemScript BitcoinScript) {
 	if in.SpendsP2SH() {
-		pbs := in.ScriptSig.Parse()
+		pbs := in.ParsedScriptSig()
 		if !in.HasWitness() && len(pbs) > 0 {
 			return pbs[len(pbs)-1].PushedData
 		}
@@ -1,6 +1,8 @@
 package rawtx
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -275,3 +277,43 @@ func TestInputTypeString(t *testing.T) {
 		t.Error("Expected UNKNOWN")
 	}
 }
+
+func TestInputTypeMarshalText(t *testing.T) {
+	for it, name := range inputTypeStringMap {
+		text, err := it.MarshalText()
+		if err != nil || string(text) != name {
+			t.Errorf("Expected MarshalText() to be %s, but got %s (%v)", name, text, err)
+		}
+
+		var parsed InputType
+		if err := parsed.UnmarshalText(text); err != nil || parsed != it {
+			t.Errorf("Expected UnmarshalText(%s) to be %d, but got %d (%v)", text, it, parsed, err)
+		}
+	}
+
+	for _, unknown := range []InputType{0, InputType(1000)} {
+		if text, err := unknown.MarshalText(); err != nil || len(text) != 0 {
+			t.Errorf("Expected an empty name for the unknown input type %d, but got %s (%v)", unknown, text, err)
+		}
+	}
+	var parsed InputType = 1
+	if err := parsed.UnmarshalText(nil); err != nil || parsed != 0 {
+		t.Errorf("Expected an empty name to be unmarshalled as 0, but got %d (%v)", parsed, err)
+	}
+	if b, err := json.Marshal(InputStats{}); err != nil || !strings.Contains(string(b), `"Type":""`) {
+		t.Errorf("Expected the zero InputStats to be marshalled, but got %s (%v)", b, err)
+	}
+	if _, err := ParseInputType("P2TR"); err == nil {
+		t.Error("Expected an error parsing an unknown input type")
+	}
+
+	stats := InputStats{Type: InP2TRKP}
+	b, _ := json.Marshal(stats)
+	if !strings.Contains(string(b), `"Type":"P2TR KeyPath"`) {
+		t.Errorf("Expected the input type to be marshalled by name, but got %s", b)
+	}
+	var unmarshalled InputStats
+	if err := json.Unmarshal(b, &unmarshalled); err != nil || unmarshalled.Type != InP2TRKP {
+		t.Errorf("Expected the input type to be unmarshalled by name, but got %v (%v)", unmarshalled.Type, err)
+	}
+}
@@ -0,0 +1,261 @@
+package rawtx
+
+// SequenceFinal is the sequence number of an input that disables the
+// nLockTime of the transaction if all inputs have it set.
+const SequenceFinal = 0xffffffff
+
+// LocktimeThreshold is the value from which on a nLockTime or a
+// OP_CHECKLOCKTIMEVERIFY argument is interpreted as an UNIX timestamp instead
+// of a block height.
+const LocktimeThreshold = 500000000
+
+// BIP68 sequence number flags and masks.
+const (
+	// SequenceLocktimeDisableFlag disables the relative locktime of the
+	// input if set.
+	SequenceLocktimeDisableFlag = 1 << 31
+	// SequenceLocktimeTypeFlag makes the relative locktime a time in units
+	// of 512 seconds if set. Otherwise, it's a number of blocks.
+	SequenceLocktimeTypeFlag = 1 << 22
+	// SequenceLocktimeMask masks the relative locktime value.
+	SequenceLocktimeMask = 0x0000ffff
+	// SequenceLocktimeGranularity is the number of bits the relative
+	// locktime value is shifted by to get seconds (512 seconds).
+	SequenceLocktimeGranularity = 9
+)
+
+// RelativeLocktime represents a BIP68 relative locktime encoded in a sequence
+// number.
+type RelativeLocktime struct {
+	IsDisabled bool
+	IsTime     bool   // the value is in units of 512 seconds, otherwise in blocks
+	Value      uint16 // number of blocks or 512 second units
+}
+
+// DecodeRelativeLocktime decodes a BIP68 relative locktime from a sequence
+// number.
+func DecodeRelativeLocktime(sequence uint32) RelativeLocktime {
+	return RelativeLocktime{
+		IsDisabled: sequence&SequenceLocktimeDisableFlag != 0,
+		IsTime:     sequence&SequenceLocktimeTypeFlag != 0,
+		Value:      uint16(sequence & SequenceLocktimeMask),
+	}
+}
+
+// Blocks returns the relative locktime in blocks. Zero is returned for
+// disabled or time based relative locktimes.
+func (rl RelativeLocktime) Blocks() uint32 {
+	if rl.IsDisabled || rl.IsTime {
+		return 0
+	}
+	return uint32(rl.Value)
+}
+
+// Seconds returns the relative locktime in seconds. Zero is returned for
+// disabled or block based relative locktimes.
+func (rl RelativeLocktime) Seconds() uint32 {
+	if rl.IsDisabled || !rl.IsTime {
+		return 0
+	}
+	return uint32(rl.Value) << SequenceLocktimeGranularity
+}
+
+// GetRelativeLocktime returns the BIP68 relative locktime of the input. Note
+// that relative locktimes are only enforced for transactions with a version of
+// two or higher.
+func (in *Input) GetRelativeLocktime() RelativeLocktime {
+	return DecodeRelativeLocktime(in.Sequence)
+}
+
+// HasRelativeLocktime returns true if the transaction version is two or higher
+// and at least one input has a BIP68 relative locktime enabled. Coinbase
+// inputs are ignored.
+func (tx *Tx) HasRelativeLocktime() bool {
+	if uint32(tx.Version) < 2 {
+		return false
+	}
+	for _, in := range tx.Inputs {
+		if !in.IsCoinbase() && !in.GetRelativeLocktime().IsDisabled {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocktimeEnforced returns true if the nLockTime of the transaction is
+// enforced. This is the case if the nLockTime is not zero and at least one
+// input has a non-final sequence number.
+func (tx *Tx) IsLocktimeEnforced() bool {
+	if tx.Locktime == 0 {
+		return false
+	}
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return true
+		}
+	}
+	return false
+}
+
+// ScriptTimelock represents a OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY
+// used in a script. The argument is the number pushed right before the opcode.
+// HasArgument is false if the opcode is not preceded by a number push.
+type ScriptTimelock struct {
+	OpCode      OpCode
+	Argument    int64
+	HasArgument bool
+}
+
+// IsCLTV returns true if the timelock is a OP_CHECKLOCKTIMEVERIFY.
+func (stl ScriptTimelock) IsCLTV() bool {
+	return stl.OpCode == OpCHECKLOCKTIMEVERIFY
+}
+
+// IsCSV returns true if the timelock is a OP_CHECKSEQUENCEVERIFY.
+func (stl ScriptTimelock) IsCSV() bool {
+	return stl.OpCode == OpCHECKSEQUENCEVERIFY
+}
+
+// IsTime returns true if the argument of the timelock is a time. For
+// OP_CHECKLOCKTIMEVERIFY this is an UNIX timestamp and for
+// OP_CHECKSEQUENCEVERIFY a time in units of 512 seconds.
+func (stl ScriptTimelock) IsTime() bool {
+	if !stl.HasArgument {
+		return false
+	}
+	if stl.IsCSV() {
+		return stl.RelativeLocktime().IsTime
+	}
+	return stl.Argument >= LocktimeThreshold
+}
+
+// RelativeLocktime returns the argument of a OP_CHECKSEQUENCEVERIFY decoded as
+// BIP68 relative locktime.
+func (stl ScriptTimelock) RelativeLocktime() RelativeLocktime {
+	return DecodeRelativeLocktime(uint32(stl.Argument))
+}
+
+// GetTimelocks returns the OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY
+// opcodes used in the script together with their arguments.
+func (s BitcoinScript) GetTimelocks() (timelocks []ScriptTimelock) {
+	pbs := s.Parse()
+	for i, poc := range pbs {
+		if poc.OpCode != OpCHECKLOCKTIMEVERIFY && poc.OpCode != OpCHECKSEQUENCEVERIFY {
+			continue
+		}
+		timelock := ScriptTimelock{OpCode: poc.OpCode}
+		if i > 0 {
+			timelock.Argument, timelock.HasArgument = pbs[i-1].scriptNum(5)
+		}
+		timelocks = append(timelocks, timelock)
+	}
+	return timelocks
+}
+
+// scriptNum returns the number pushed by the opcode. Numbers larger than
+// maxLength bytes and non-push opcodes return false.
+func (poc *ParsedOpCode) scriptNum(maxLength int) (int64, bool) {
+	switch {
+	case poc.OpCode == Op0:
+		return 0, true
+	case poc.OpCode == Op1NEGATE:
+		return -1, true
+	case poc.OpCode >= Op1 && poc.OpCode <= Op16:
+		return int64(poc.OpCode-Op1) + 1, true
+	case poc.OpCode.IsDataPushOpCode() && len(poc.PushedData) <= maxLength:
+		return decodeScriptNum(poc.PushedData), true
+	}
+	return 0, false
+}
+
+// decodeScriptNum decodes a little-endian script number where the most
+// significant bit of the last byte is the sign bit.
+func decodeScriptNum(b []byte) (n int64) {
+	if len(b) == 0 {
+		return 0
+	}
+	for i, v := range b {
+		n |= int64(v) << uint(8*i)
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		n &= ^(int64(0x80) << uint(8*(len(b)-1)))
+		return -n
+	}
+	return n
+}
+
+// GetRevealedScript returns the script revealed when spending the input: the
+// redeem script of P2SH inputs, the witness script of P2WSH and P2SH-P2WSH
+// inputs or the tapscript of P2TR script path inputs. The returned script is
+// empty for other inputs.
+func (in *Input) GetRevealedScript() BitcoinScript {
+	switch in.GetType() {
+	case InP2SH:
+		return in.GetP2SHRedeemScript()
+	case InP2WSH:
+		return in.GetP2WSHRedeemScript()
+	case InP2SH_P2WSH:
+		return in.GetNestedP2WSHRedeemScript()
+	case InP2TRSP:
+		return in.GetTapscript()
+	}
+	return nil
+}
+
+// GetTapscript returns the tapscript of a P2TR script path input. The returned
+// script is empty if the input does not spend a P2TR output via the script
+// path.
+func (in *Input) GetTapscript() BitcoinScript {
+	if !in.SpendsP2TRScriptPath() {
+		return nil
+	}
+	controlBlockIndex := len(in.Witness) - 1
+	if last := in.Witness[controlBlockIndex].PushedData; controlBlockIndex > 0 && len(last) > 0 && last[0] == TAPROOT_ANNEX_INDICATOR {
+		controlBlockIndex--
+	}
+	if controlBlockIndex < 1 {
+		return nil
+	}
+	return in.Witness[controlBlockIndex-1].PushedData
+}
+
+// GetScriptTimelocks returns the OP_CHECKLOCKTIMEVERIFY and
+// OP_CHECKSEQUENCEVERIFY opcodes used in the revealed script of the input.
+func (in *Input) GetScriptTimelocks() []ScriptTimelock {
+	return in.GetRevealedScript().GetTimelocks()
+}
+
+// AntiFeeSnipingMaxOffset is the maximum number of blocks the Bitcoin Core
+// wallet randomly sets the nLockTime of a transaction back from the current
+// height for anti-fee-sniping.
+const AntiFeeSnipingMaxOffset = 100
+
+// IsFinal returns true if the transaction can be included in a block at the
+// passed height. As defined by BIP113, the blockTime is the median time past
+// of the previous block. This mirrors IsFinalTx() in Bitcoin Core.
+func (tx *Tx) IsFinal(height uint32, blockTime uint32) bool {
+	if tx.Locktime == 0 {
+		return true
+	}
+	if tx.Locktime < LocktimeThreshold {
+		if tx.Locktime < height {
+			return true
+		}
+	} else if tx.Locktime < blockTime {
+		return true
+	}
+	return !tx.IsLocktimeEnforced()
+}
+
+// IsAntiFeeSniping returns true if the nLockTime of the transaction looks like
+// it was set to discourage fee sniping when the transaction was included at
+// the passed height. Wallets like Bitcoin Core set the nLockTime to the height
+// of the current tip and sometimes randomly up to AntiFeeSnipingMaxOffset
+// blocks further back. Transactions that waited longer than that before being
+// included aren't detected.
+func (tx *Tx) IsAntiFeeSniping(height uint32) bool {
+	if !tx.IsLocktimeEnforced() || tx.Locktime >= LocktimeThreshold || tx.Locktime >= height {
+		return false
+	}
+	return height-tx.Locktime <= AntiFeeSnipingMaxOffset
+}
@@ -0,0 +1,195 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeRelativeLocktime(t *testing.T) {
+	testCases := []struct {
+		sequence uint32
+		expected RelativeLocktime
+		blocks   uint32
+		seconds  uint32
+	}{
+		{0xffffffff, RelativeLocktime{IsDisabled: true, IsTime: true, Value: 0xffff}, 0, 0},
+		{0xfffffffd, RelativeLocktime{IsDisabled: true, IsTime: true, Value: 0xfffd}, 0, 0},
+		{0x00000090, RelativeLocktime{Value: 144}, 144, 0},
+		{0x00400090, RelativeLocktime{IsTime: true, Value: 144}, 0, 73728},
+		{0x003f0001, RelativeLocktime{Value: 1}, 1, 0}, // bits outside of the flags and the mask are ignored
+		{0x80000090, RelativeLocktime{IsDisabled: true, Value: 144}, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		rl := DecodeRelativeLocktime(tc.sequence)
+		if rl != tc.expected {
+			t.Errorf("Expected DecodeRelativeLocktime(%#08x) to be %+v, but got %+v", tc.sequence, tc.expected, rl)
+		}
+		if rl.Blocks() != tc.blocks {
+			t.Errorf("Expected Blocks() to be %d, but got %d for sequence %#08x", tc.blocks, rl.Blocks(), tc.sequence)
+		}
+		if rl.Seconds() != tc.seconds {
+			t.Errorf("Expected Seconds() to be %d, but got %d for sequence %#08x", tc.seconds, rl.Seconds(), tc.sequence)
+		}
+	}
+}
+
+func TestGetTimelocks(t *testing.T) {
+	testCases := []struct {
+		script   string
+		expected []ScriptTimelock
+	}{
+		{"", nil},
+		{"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", nil},
+		{"029000b275", []ScriptTimelock{{OpCHECKSEQUENCEVERIFY, 144, true}}},
+		{"03a08601b175", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 100000, true}}},
+		{"0400e1f505b175", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 100000000, true}}},
+		{"0480f0fa02b175", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 50000000, true}}},
+		{"60b2", []ScriptTimelock{{OpCHECKSEQUENCEVERIFY, 16, true}}},
+		{"b2", []ScriptTimelock{{OpCHECKSEQUENCEVERIFY, 0, false}}},
+		{"0101930400000000b1", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 0, true}}},
+		{"76b1", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 0, false}}},
+		{"060000000000ffb1", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, 0, false}}}, // arguments larger than 5 bytes
+		{"0181b1", []ScriptTimelock{{OpCHECKLOCKTIMEVERIFY, -1, true}}},
+		{"029000b2756303a08601b168", []ScriptTimelock{{OpCHECKSEQUENCEVERIFY, 144, true}, {OpCHECKLOCKTIMEVERIFY, 100000, true}}},
+	}
+
+	for _, tc := range testCases {
+		s, _ := hex.DecodeString(tc.script)
+		timelocks := BitcoinScript(s).GetTimelocks()
+		if len(timelocks) != len(tc.expected) {
+			t.Errorf("Expected %d timelocks, but got %v for script %s", len(tc.expected), timelocks, tc.script)
+			continue
+		}
+		for i := range timelocks {
+			if timelocks[i] != tc.expected[i] {
+				t.Errorf("Expected timelock %+v, but got %+v for script %s", tc.expected[i], timelocks[i], tc.script)
+			}
+		}
+	}
+}
+
+func TestScriptTimelockIsTime(t *testing.T) {
+	testCases := []struct {
+		timelock ScriptTimelock
+		expected bool
+	}{
+		{ScriptTimelock{OpCHECKLOCKTIMEVERIFY, 100000, true}, false},
+		{ScriptTimelock{OpCHECKLOCKTIMEVERIFY, LocktimeThreshold, true}, true},
+		{ScriptTimelock{OpCHECKSEQUENCEVERIFY, 144, true}, false},
+		{ScriptTimelock{OpCHECKSEQUENCEVERIFY, SequenceLocktimeTypeFlag | 144, true}, true},
+		{ScriptTimelock{OpCHECKSEQUENCEVERIFY, 0, false}, false},
+	}
+
+	for _, tc := range testCases {
+		if tc.timelock.IsTime() != tc.expected {
+			t.Errorf("Expected IsTime() to be %t for %+v", tc.expected, tc.timelock)
+		}
+	}
+}
+
+func TestInputStatsTimelocks(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		stats := tx.Stats()
+		if !testTx.IsLNUniliteralClosing {
+			continue
+		}
+
+		// The to_local output of a LN commitment transaction is spent after
+		// a CSV delay of 144 blocks.
+		inStats := stats.InStats[0]
+		if inStats.RelativeLocktime.IsDisabled || inStats.RelativeLocktime.Blocks() != 144 {
+			t.Errorf("Expected a relative locktime of 144 blocks, but got %+v for testTx: %+v", inStats.RelativeLocktime, testTx)
+		}
+		if len(inStats.ScriptTimelocks) != 1 || inStats.ScriptTimelocks[0] != (ScriptTimelock{OpCHECKSEQUENCEVERIFY, 144, true}) {
+			t.Errorf("Expected a OP_CHECKSEQUENCEVERIFY with argument 144, but got %+v for testTx: %+v", inStats.ScriptTimelocks, testTx)
+		}
+		if !stats.Locktime.HasRelativeLocktime {
+			t.Errorf("Expected HasRelativeLocktime to be true for testTx: %+v", testTx)
+		}
+	}
+}
+
+func TestIsLocktimeEnforced(t *testing.T) {
+	testCases := []struct {
+		locktime uint32
+		sequence uint32
+		expected bool
+	}{
+		{0, 0xfffffffe, false},
+		{100, 0xffffffff, false},
+		{100, 0xfffffffe, true},
+		{LocktimeThreshold, 0, true},
+	}
+
+	for _, tc := range testCases {
+		tx := Tx{Locktime: tc.locktime, Inputs: []Input{{Sequence: tc.sequence}}}
+		if tx.IsLocktimeEnforced() != tc.expected {
+			t.Errorf("Expected IsLocktimeEnforced() to be %t for locktime %d and sequence %#08x", tc.expected, tc.locktime, tc.sequence)
+		}
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	testCases := []struct {
+		locktime  uint32
+		sequence  uint32
+		height    uint32
+		blockTime uint32
+		expected  bool
+	}{
+		{0, 0, 1, 0, true},
+		{100, 0xfffffffe, 100, 0, false},
+		{100, 0xfffffffe, 101, 0, true},
+		{100, 0xffffffff, 100, 0, true},
+		{1600000000, 0xfffffffe, 700000, 1600000000, false},
+		{1600000000, 0xfffffffe, 700000, 1600000001, true},
+	}
+
+	for _, tc := range testCases {
+		tx := Tx{Locktime: tc.locktime, Inputs: []Input{{Sequence: tc.sequence}}}
+		if tx.IsFinal(tc.height, tc.blockTime) != tc.expected {
+			t.Errorf("Expected IsFinal(%d, %d) to be %t for locktime %d", tc.height, tc.blockTime, tc.expected, tc.locktime)
+		}
+	}
+}
+
+func TestLocktimeContextStats(t *testing.T) {
+	testCases := []struct {
+		locktime         uint32
+		sequence         uint32
+		height           uint32
+		isAntiFeeSniping bool
+		isFinal          bool
+		delta            int64
+	}{
+		{0, 0xfffffffd, 700000, false, true, 0},
+		{699999, 0xfffffffd, 700000, true, true, 1},          // current tip
+		{699950, 0xfffffffe, 700000, true, true, 50},         // randomised offset
+		{699999, 0xffffffff, 700000, false, true, 1},         // locktime not enforced
+		{690000, 0xfffffffd, 700000, false, true, 10000},     // too far in the past
+		{700000, 0xfffffffd, 700000, false, false, 0},        // not final
+		{700010, 0xfffffffd, 700000, false, false, -10},      // in the future
+		{1600000000, 0xfffffffd, 700000, false, true, 86400}, // timestamp
+	}
+
+	for _, tc := range testCases {
+		tx := Tx{Locktime: tc.locktime, Inputs: []Input{{Sequence: tc.sequence}}}
+		stats := tx.LocktimeContextStats(tc.height, 1600086400)
+		if stats.IsAntiFeeSniping != tc.isAntiFeeSniping {
+			t.Errorf("Expected IsAntiFeeSniping to be %t, but got %+v", tc.isAntiFeeSniping, stats)
+		}
+		if stats.IsFinal != tc.isFinal {
+			t.Errorf("Expected IsFinal to be %t, but got %+v", tc.isFinal, stats)
+		}
+		if stats.Delta != tc.delta {
+			t.Errorf("Expected Delta to be %d, but got %+v", tc.delta, stats)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package rawtx
+
+import (
+	"fmt"
+)
+
+// BlockErrorType defines the type of a block or header integrity error
+type BlockErrorType int
+
+// Possible types of block integrity errors
+const (
+	BlockErrNoTransactions BlockErrorType = iota + 1
+	BlockErrNoCoinbase
+	BlockErrBadMerkleRoot
+	BlockErrDuplicateTx
+	BlockErrWitnessNonceSize
+	BlockErrWitnessMerkleMatch
+	BlockErrUnexpectedWitness
+	BlockErrPrevBlockMismatch
+	BlockErrBadDiffBits
+	BlockErrHighHash
+	BlockErrTimeTooOld
+	BlockErrMissingInputs
+	BlockErrBIP30
+)
+
+var blockErrorTypeStringMap = map[BlockErrorType]string{
+	BlockErrNoTransactions:     "NO_TRANSACTIONS",
+	BlockErrNoCoinbase:         "NO_COINBASE",
+	BlockErrBadMerkleRoot:      "BAD_MERKLE_ROOT",
+	BlockErrDuplicateTx:        "DUPLICATE_TX",
+	BlockErrWitnessNonceSize:   "WITNESS_NONCE_SIZE",
+	BlockErrWitnessMerkleMatch: "WITNESS_MERKLE_MATCH",
+	BlockErrUnexpectedWitness:  "UNEXPECTED_WITNESS",
+	BlockErrPrevBlockMismatch:  "PREV_BLOCK_MISMATCH",
+	BlockErrBadDiffBits:        "BAD_DIFF_BITS",
+	BlockErrHighHash:           "HIGH_HASH",
+	BlockErrTimeTooOld:         "TIME_TOO_OLD",
+	BlockErrMissingInputs:      "MISSING_INPUTS",
+	BlockErrBIP30:              "BIP30",
+}
+
+// blockErrorRejectReasonMap maps the block errors to the reject reasons used
+// by Bitcoin Core.
+var blockErrorRejectReasonMap = map[BlockErrorType]string{
+	BlockErrNoTransactions:     "bad-blk-length",
+	BlockErrNoCoinbase:         "bad-cb-missing",
+	BlockErrBadMerkleRoot:      "bad-txnmrklroot",
+	BlockErrDuplicateTx:        "bad-txns-duplicate",
+	BlockErrWitnessNonceSize:   "bad-witness-nonce-size",
+	BlockErrWitnessMerkleMatch: "bad-witness-merkle-match",
+	BlockErrUnexpectedWitness:  "unexpected-witness",
+	BlockErrPrevBlockMismatch:  "prev-blk-not-found",
+	BlockErrBadDiffBits:        "bad-diffbits",
+	BlockErrHighHash:           "high-hash",
+	BlockErrTimeTooOld:         "time-too-old",
+	BlockErrMissingInputs:      "bad-txns-inputs-missingorspent",
+	BlockErrBIP30:              "bad-txns-BIP30",
+}
+
+func (bet BlockErrorType) String() string {
+	return blockErrorTypeStringMap[bet]
+}
+
+// RejectReason returns the reject reason Bitcoin Core uses for the error.
+func (bet BlockErrorType) RejectReason() string {
+	return blockErrorRejectReasonMap[bet]
+}
+
+// BlockError describes why a block failed an integrity check. TxIndex is the
+// index of the transaction causing the error or -1 if the error applies to
+// the whole block. Expected and Got are set for hash mismatches.
+type BlockError struct {
+	Type     BlockErrorType
+	TxIndex  int
+	Expected Hash
+	Got      Hash
+	Details  string
+}
+
+func (be *BlockError) Error() string {
+	if be.TxIndex >= 0 {
+		return fmt.Sprintf("%s (tx %d): %s", be.Type.RejectReason(), be.TxIndex, be.Details)
+	}
+	return fmt.Sprintf("%s: %s", be.Type.RejectReason(), be.Details)
+}
+
+// MerkleRoot returns the merkle root of the hashes as computed by Bitcoin.
+// The last hash of a level with an odd number of hashes is paired with
+// itself. Because of this, a list ending with duplicated hashes has the same
+// root as the list without them (CVE-2012-2459). mutated is true if two
+// paired hashes on any level are equal, which is the case for such a list.
+// The root of an empty list is the zero hash.
+func MerkleRoot(hashes []Hash) (root Hash, mutated bool) {
+	if len(hashes) == 0 {
+		return Hash{}, false
+	}
+	level := make([]Hash, len(hashes))
+	copy(level, hashes)
+	var pair [2 * HashSize]byte
+	for len(level) > 1 {
+		for i := 0; i+1 < len(level); i += 2 {
+			if level[i] == level[i+1] {
+				mutated = true
+			}
+		}
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		for i := 0; i < len(level); i += 2 {
+			copy(pair[:HashSize], level[i][:])
+			copy(pair[HashSize:], level[i+1][:])
+			level[i/2] = DoubleSHA256(pair[:])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0], mutated
+}
+
+// MerkleRoot returns the merkle root of the txids of the block and if the
+// transaction list is mutated as described for MerkleRoot.
+func (b *Block) MerkleRoot() (root Hash, mutated bool) {
+	txids := make([]Hash, len(b.Transactions))
+	for i := range b.Transactions {
+		txids[i] = b.Transactions[i].TxID()
+	}
+	return MerkleRoot(txids)
+}
+
+// WitnessMerkleRoot returns the merkle root of the wtxids of the block as
+// defined in BIP141. The wtxid of the coinbase is replaced by the zero hash.
+func (b *Block) WitnessMerkleRoot() Hash {
+	wtxids := make([]Hash, len(b.Transactions))
+	for i := 1; i < len(b.Transactions); i++ {
+		wtxids[i] = b.Transactions[i].WTxID()
+	}
+	root, _ := MerkleRoot(wtxids)
+	return root
+}
+
+// CheckMerkleRoot returns a BlockError if the merkle root of the txids
+// doesn't match the header or if the transaction list is mutated by
+// duplicating transactions (CVE-2012-2459). A mutated block has a valid
+// merkle root, but is invalid, while the block without the duplicates might
+// be valid.
+func (b *Block) CheckMerkleRoot() error {
+	if len(b.Transactions) == 0 {
+		return &BlockError{Type: BlockErrNoTransactions, TxIndex: -1, Details: "block has no transactions"}
+	}
+	root, mutated := b.MerkleRoot()
+	if root != b.Header.MerkleRoot {
+		return &BlockError{Type: BlockErrBadMerkleRoot, TxIndex: -1, Expected: b.Header.MerkleRoot, Got: root,
+			Details: fmt.Sprintf("header has merkle root %s, but the transactions hash to %s", b.Header.MerkleRoot, root)}
+	}
+	if mutated {
+		index := b.duplicateTxIndex()
+		if index >= 0 {
+			return &BlockError{Type: BlockErrDuplicateTx, TxIndex: index,
+				Details: fmt.Sprintf("transaction %s is duplicated in the merkle tree", b.Transactions[index].TxID())}
+		}
+		return &BlockError{Type: BlockErrDuplicateTx, TxIndex: -1, Details: "subtrees are duplicated in the merkle tree"}
+	}
+	return nil
+}
+
+// duplicateTxIndex returns the index of the first transaction with the same
+// txid as its merkle tree sibling or -1 if there is none.
+func (b *Block) duplicateTxIndex() int {
+	for i := 1; i < len(b.Transactions); i += 2 {
+		if b.Transactions[i].TxID() == b.Transactions[i-1].TxID() {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckWitnessCommitment returns a BlockError if the witness commitment in
+// the coinbase doesn't commit to the wtxids of the block, if the coinbase
+// witness isn't a single 32 byte witness reserved value, or if the block has
+// no commitment but transactions with witnesses. It checks the rules of
+// BIP141 and should only be used for blocks after SegWit activation.
+func (b *Block) CheckWitnessCommitment() error {
+	coinbase, ok := b.Coinbase()
+	if !ok {
+		return &BlockError{Type: BlockErrNoCoinbase, TxIndex: 0, Details: "first transaction is not a coinbase"}
+	}
+	cb, _ := coinbase.DecodeCoinbase()
+	if !cb.HasWitnessCommitment() {
+		for i := range b.Transactions {
+			if b.Transactions[i].hasWitness() {
+				return &BlockError{Type: BlockErrUnexpectedWitness, TxIndex: i,
+					Details: "transaction has a witness, but the block has no witness commitment"}
+			}
+		}
+		return nil
+	}
+
+	if cb.WitnessReservedValue == nil {
+		return &BlockError{Type: BlockErrWitnessNonceSize, TxIndex: 0,
+			Details: fmt.Sprintf("coinbase witness must be a single 32 byte witness reserved value, got %d elements", len(coinbase.Inputs[0].Witness))}
+	}
+	root := b.WitnessMerkleRoot()
+	commitment := DoubleSHA256(append(root.CloneBytes(), cb.WitnessReservedValue...))
+	var expected Hash
+	copy(expected[:], cb.WitnessCommitment)
+	if commitment != expected {
+		return &BlockError{Type: BlockErrWitnessMerkleMatch, TxIndex: 0, Expected: expected, Got: commitment,
+			Details: fmt.Sprintf("output %d of the coinbase commits to %x, but the witness merkle root %s and the reserved value commit to %x",
+				cb.WitnessCommitmentIndex, expected[:], root, commitment[:])}
+	}
+	return nil
+}
+
+// CheckIntegrity returns a BlockError if the merkle root or the witness
+// commitment of the block are invalid.
+func (b *Block) CheckIntegrity() error {
+	if err := b.CheckMerkleRoot(); err != nil {
+		return err
+	}
+	return b.CheckWitnessCommitment()
+}
+
+// hasWitness returns true if any input of the transaction has a witness.
+func (tx *Tx) hasWitness() bool {
+	for _, in := range tx.Inputs {
+		if len(in.Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
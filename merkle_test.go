@@ -0,0 +1,205 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testSegWitBlock returns a serialized block with a coinbase and two
+// transactions with witnesses from the testdata. The merkle root and the
+// witness commitment are valid unless modified by mutate.
+func testSegWitBlock(t *testing.T, mutate func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte)) []byte {
+	var txns [][]byte
+	wtxids := []Hash{{}}
+	for _, testTx := range GetTestTransactions() {
+		rawTx, err := hex.DecodeString(testTx.RawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		tx, err := DeserializeTx(rawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if tx.hasWitness() {
+			txns = append(txns, rawTx)
+			wtxids = append(wtxids, tx.WTxID())
+		}
+		if len(txns) == 2 {
+			break
+		}
+	}
+	witnessRoot, _ := MerkleRoot(wtxids)
+	reserved := make([]byte, 32)
+	commitment := DoubleSHA256(append(witnessRoot.CloneBytes(), reserved...))
+
+	coinbase := wire.NewMsgTx(2)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), appendScriptNum(nil, 700000), wire.TxWitness{reserved}))
+	coinbase.AddTxOut(wire.NewTxOut(625000000, append([]byte{0x00, 0x14}, make([]byte, 20)...)))
+	coinbase.AddTxOut(wire.NewTxOut(0, append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, commitment[:]...)))
+
+	header := BlockHeader{Version: 0x20000000, Timestamp: 1231006505, Bits: 0x1d00ffff}
+	if mutate != nil {
+		mutate(&header, coinbase, &txns)
+	}
+	var rawCoinbase bytes.Buffer
+	if err := coinbase.Serialize(&rawCoinbase); err != nil {
+		t.Fatal(err.Error())
+	}
+	txns = append([][]byte{rawCoinbase.Bytes()}, txns...)
+
+	if header.MerkleRoot.IsZero() {
+		txids := make([]Hash, len(txns))
+		for i, rawTx := range txns {
+			tx, err := DeserializeTx(rawTx)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			txids[i] = tx.TxID()
+		}
+		header.MerkleRoot, _ = MerkleRoot(txids)
+	}
+
+	raw := header.Serialize()
+	raw = appendCompactSize(raw, uint64(len(txns)))
+	for _, rawTx := range txns {
+		raw = append(raw, rawTx...)
+	}
+	return raw
+}
+
+func TestMerkleRoot(t *testing.T) {
+	var a, b, c Hash
+	a[0], b[0], c[0] = 1, 2, 3
+	pair := func(l, r Hash) Hash {
+		return DoubleSHA256(append(l.CloneBytes(), r[:]...))
+	}
+
+	expected := pair(pair(a, b), pair(c, c))
+	if root, mutated := MerkleRoot([]Hash{a, b, c}); root != expected || mutated {
+		t.Errorf("Expected the root %s, but got %s (mutated %t)", expected, root, mutated)
+	}
+	// CVE-2012-2459: duplicating the last hash results in the same root
+	if root, mutated := MerkleRoot([]Hash{a, b, c, c}); root != expected || !mutated {
+		t.Errorf("Expected the root %s of the mutated list, but got %s (mutated %t)", expected, root, mutated)
+	}
+	if root, mutated := MerkleRoot([]Hash{a}); root != a || mutated {
+		t.Errorf("Expected the hash as root of a single hash, but got %s", root)
+	}
+	if root, _ := MerkleRoot(nil); !root.IsZero() {
+		t.Errorf("Expected the zero hash as root of an empty list, but got %s", root)
+	}
+
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+	block, err := DeserializeBlock(genesis.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if root, _ := block.MerkleRoot(); root.String() != chaincfg.MainNetParams.GenesisBlock.Header.MerkleRoot.String() {
+		t.Errorf("Expected the genesis merkle root, but got %s", root)
+	}
+	if err := block.CheckIntegrity(); err != nil {
+		t.Errorf("Expected the genesis block to be valid, but got %s", err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	block, err := DeserializeBlock(testSegWitBlock(t, nil))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := block.CheckIntegrity(); err != nil {
+		t.Fatalf("Expected the block to be valid, but got %s", err)
+	}
+
+	mutations := map[string]struct {
+		mutate   func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte)
+		expected BlockErrorType
+		txIndex  int
+	}{
+		"merkle root": {func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+			header.MerkleRoot[0] = 1
+		}, BlockErrBadMerkleRoot, -1},
+		"duplicated transaction": {func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+			*txns = append(*txns, (*txns)[1])
+			// the witness commitment has to match the wtxids including the duplicate
+			wtxids := []Hash{{}}
+			for _, rawTx := range *txns {
+				tx, _ := DeserializeTx(rawTx)
+				wtxids = append(wtxids, tx.WTxID())
+			}
+			root, _ := MerkleRoot(wtxids)
+			commitment := DoubleSHA256(append(root.CloneBytes(), make([]byte, 32)...))
+			copy(coinbase.TxOut[1].PkScript[6:], commitment[:])
+		}, BlockErrDuplicateTx, 3},
+		"witness commitment": {func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+			coinbase.TxOut[1].PkScript[6] ^= 1
+		}, BlockErrWitnessMerkleMatch, 0},
+		"witness reserved value": {func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+			coinbase.TxIn[0].Witness = append(coinbase.TxIn[0].Witness, []byte{0x01})
+		}, BlockErrWitnessNonceSize, 0},
+		"missing commitment": {func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+			coinbase.TxOut = coinbase.TxOut[:1]
+		}, BlockErrUnexpectedWitness, 0},
+	}
+	for name, mutation := range mutations {
+		block, err := DeserializeBlock(testSegWitBlock(t, mutation.mutate))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		err = block.CheckIntegrity()
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) {
+			t.Errorf("Expected a BlockError for a mutated %s, but got %v", name, err)
+			continue
+		}
+		if blockErr.Type != mutation.expected || blockErr.TxIndex != mutation.txIndex {
+			t.Errorf("Expected %s at transaction %d for a mutated %s, but got %s", mutation.expected, mutation.txIndex, name, blockErr)
+		}
+	}
+
+	// without a coinbase witness, the first transaction with a witness is unexpected
+	block, err = DeserializeBlock(testSegWitBlock(t, func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+		coinbase.TxOut = coinbase.TxOut[:1]
+		coinbase.TxIn[0].Witness = nil
+	}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := block.CheckWitnessCommitment(); err == nil || err.(*BlockError).Type != BlockErrUnexpectedWitness || err.(*BlockError).TxIndex != 1 {
+		t.Errorf("Expected an unexpected witness of transaction 1, but got %v", err)
+	}
+}
+
+func TestBlockErrorMerkleRoot(t *testing.T) {
+	block, err := DeserializeBlock(testSegWitBlock(t, func(header *BlockHeader, coinbase *wire.MsgTx, txns *[][]byte) {
+		header.MerkleRoot[0] = 1
+	}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = block.CheckMerkleRoot()
+	blockErr, ok := err.(*BlockError)
+	if !ok {
+		t.Fatalf("Expected a BlockError, but got %v", err)
+	}
+	root, _ := block.MerkleRoot()
+	if blockErr.Expected != block.Header.MerkleRoot || blockErr.Got != root {
+		t.Errorf("Expected the header and computed merkle roots in the error, but got %s", blockErr)
+	}
+	if blockErr.Type.String() != "BAD_MERKLE_ROOT" || blockErr.Type.RejectReason() != "bad-txnmrklroot" {
+		t.Errorf("Expected BAD_MERKLE_ROOT (bad-txnmrklroot), but got %s (%s)", blockErr.Type, blockErr.Type.RejectReason())
+	}
+
+	if err := (&Block{}).CheckMerkleRoot(); err == nil || err.(*BlockError).Type != BlockErrNoTransactions {
+		t.Errorf("Expected an error for a block without transactions, but got %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package rawtx
 
+import "fmt"
+
 // OpCode represents a Bitcoin operation code
 type OpCode byte
 
@@ -194,6 +196,7 @@ const (
 	OpNOP9                OpCode = 0xb8
 	OpNOP10               OpCode = 0xb9
 	OpUNKNOWN186          OpCode = 0xba
+	OpCHECKSIGADD         OpCode = 0xba // BIP342, only valid in tapscript
 	OpUNKNOWN187          OpCode = 0xbb
 	OpUNKNOWN188          OpCode = 0xbc
 	OpUNKNOWN189          OpCode = 0xbd
@@ -525,6 +528,42 @@ var OpCodeStringMap = map[OpCode]string{
 	OpINVALIDOPCODE:       "OP_INVALIDOPCODE",
 }
 
+func (opCode OpCode) String() string {
+	return OpCodeStringMap[opCode]
+}
+
+// opCodeAliases are opcode names accepted by ParseOpCode besides the names
+// returned by String(). String() keeps returning OP_UNKNOWN186 for
+// OP_CHECKSIGADD for backwards compatibility.
+var opCodeAliases = map[string]OpCode{
+	"OP_CHECKSIGADD": OpCHECKSIGADD,
+}
+
+// ParseOpCode returns the OpCode with the name s as returned by String(), e.g.
+// OP_CHECKSIG. OP_CHECKSIGADD is accepted as alias of OP_UNKNOWN186.
+func ParseOpCode(s string) (OpCode, error) {
+	for opCode, name := range OpCodeStringMap {
+		if name == s {
+			return opCode, nil
+		}
+	}
+	if opCode, ok := opCodeAliases[s]; ok {
+		return opCode, nil
+	}
+	return 0, fmt.Errorf("unknown opcode %q", s)
+}
+
+// MarshalText marshals the opcode as its name.
+func (opCode OpCode) MarshalText() ([]byte, error) {
+	return []byte(OpCodeStringMap[opCode]), nil
+}
+
+// UnmarshalText unmarshals the opcode from its name.
+func (opCode *OpCode) UnmarshalText(text []byte) (err error) {
+	*opCode, err = ParseOpCode(string(text))
+	return err
+}
+
 // IsDataPushOpCode indicates if a opCode pushes data to the stack
 func (opCode OpCode) IsDataPushOpCode() bool {
 	return (opCode >= OpDATA1 && opCode <= OpDATA75) ||
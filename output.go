@@ -1,6 +1,8 @@
 package rawtx
 
 import (
+	"fmt"
+
 	"github.com/btcsuite/btcd/wire"
 )
 
@@ -37,19 +39,59 @@ type Output struct {
 	Value        int64
 	ScriptPubKey BitcoinScript
 	outputType   OutputType
+	// parsedScriptPubKey caches the parsed ScriptPubKey
+	parsedScriptPubKey *parsedScriptCache
 }
 
 // FromWireTxOut populates an Output struct with values from a wire.TxOut.
 func (out *Output) FromWireTxOut(txOut *wire.TxOut) {
 	out.ScriptPubKey = txOut.PkScript
+	out.parsedScriptPubKey = newParsedScriptCache(out.ScriptPubKey)
 	out.Value = txOut.Value
 	out.outputType = out.GetType()
 }
 
+// NewOutput returns an Output with the value in satoshi and the scriptPubKey.
+// It's used for prevouts that aren't deserialized from a transaction.
+func NewOutput(value int64, scriptPubKey BitcoinScript) *Output {
+	out := &Output{Value: value, ScriptPubKey: scriptPubKey}
+	out.parsedScriptPubKey = newParsedScriptCache(out.ScriptPubKey)
+	out.outputType = out.GetType()
+	return out
+}
+
 func (ot OutputType) String() string {
 	return outputTypeStringMap[ot]
 }
 
+// ParseOutputType returns the OutputType with the name s as returned by
+// String().
+func ParseOutputType(s string) (OutputType, error) {
+	for ot, name := range outputTypeStringMap {
+		if name == s {
+			return ot, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown output type %q", s)
+}
+
+// MarshalText marshals the output type as its name. The zero value and
+// unknown values are marshalled as an empty string.
+func (ot OutputType) MarshalText() ([]byte, error) {
+	return []byte(outputTypeStringMap[ot]), nil
+}
+
+// UnmarshalText unmarshals the output type from its name. An empty string is
+// unmarshalled as the zero value.
+func (ot *OutputType) UnmarshalText(text []byte) (err error) {
+	if len(text) == 0 {
+		*ot = 0
+		return nil
+	}
+	*ot, err = ParseOutputType(string(text))
+	return err
+}
+
 // GetType retruns the output type as a OutputType
 func (out *Output) GetType() OutputType {
 	if out.outputType != 0 {
@@ -74,6 +116,14 @@ func (out *Output) GetType() OutputType {
 	return OutUNKNOWN
 }
 
+// ParsedScriptPubKey returns the parsed scriptPubKey of the output. The
+// scriptPubKey is parsed only once for outputs constructed with FromWireTxOut
+// or DeserializeTx. The returned ParsedBitcoinScript is shared and must not be
+// modified.
+func (out *Output) ParsedScriptPubKey() ParsedBitcoinScript {
+	return out.parsedScriptPubKey.get(out.ScriptPubKey)
+}
+
 // IsOPReturnOutput returns if an Output is an OP_RETURN output
 // An OP_RETURN scriptPubKey looks like:
 //  OP_RETURN <SomeDataPush> <OP_RETURN data>
@@ -81,7 +131,7 @@ func (out *Output) IsOPReturnOutput() (is bool) {
 	if len(out.ScriptPubKey) <= 0 {
 		return false
 	}
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 
 	if len(pbs) < 2 {
 		return false
@@ -107,7 +157,7 @@ func (out *Output) GetOPReturnData() (bool, ParsedOpCode) {
 		return false, ParsedOpCode{}
 	}
 
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 
 	// pbs[0] should be OP_RETURN
 	// pbs[1] should be data push
@@ -129,7 +179,7 @@ func (out *Output) GetOPReturnData() (bool, ParsedOpCode) {
 //  OP_DUP OP_HASH160 OP_DATA_20(20 byte pubKeyHash) OP_EQUALVERIFY OP_CHECKSIG
 //  OP_DUP OP_HASH160 OP_DATA_20(                  ) OP_EQUALVERIFY OP_CHECKSIG
 func (out *Output) IsP2PKHOutput() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 5 {
 		if pbs[0].OpCode == OpDUP && // OP_DUP
 			pbs[1].OpCode == OpHASH160 && // OP_HASH160
@@ -146,7 +196,7 @@ func (out *Output) IsP2PKHOutput() bool {
 // A P2SH scriptPubKey looks like:
 //  OP_HASH160 OP_DATA_20(20 byte hash) OP_EQUAL
 func (out *Output) IsP2SHOutput() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 3 {
 		if pbs[0].OpCode == OpHASH160 &&
 			pbs[1].OpCode == OpDATA20 && // FIXME: could also be inefficient with OpPUSHDATA1 / 2 / 4  ?
@@ -161,7 +211,7 @@ func (out *Output) IsP2SHOutput() bool {
 // A P2WPKH V0 output looks like:
 //  OP_0 OP_DATA_20(20 byte hash) (where the leading OP_0 indicates witness program 0)
 func (out *Output) IsP2WPKHV0Output() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 2 {
 		if pbs[0].OpCode == Op0 && // witness program 0
 			pbs[1].OpCode == OpDATA20 { // OP_DATA_20 // FIXME: could also be inefficient with OpPUSHDATA1 / 2 / 4  ?
@@ -175,7 +225,7 @@ func (out *Output) IsP2WPKHV0Output() bool {
 // A P2WSH V0 output looks like:
 //  OP_0 (as witness program 0) OP_DATA_32(32 byte hash)
 func (out *Output) IsP2WSHV0Output() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 2 {
 		if pbs[0].OpCode == Op0 && // witness program 0
 			pbs[1].OpCode == OpDATA32 { // OP_DATA_32
@@ -196,7 +246,7 @@ func (out *Output) IsP2MSOutput() (is bool, m int, n int) {
 // A P2PK output looks like:
 //  PubKey OP_CHECKSIG
 func (out *Output) IsP2PKOutput() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 2 {
 		if pbs[0].IsECDSAPubKey() && pbs[1].OpCode == OpCHECKSIG {
 			return true
@@ -209,7 +259,7 @@ func (out *Output) IsP2PKOutput() bool {
 // A P2TR output looks like:
 //	OP_1 OP_PUSH32 <schnorr_public_key>
 func (out *Output) IsP2TROutput() bool {
-	pbs := out.ScriptPubKey.Parse()
+	pbs := out.ParsedScriptPubKey()
 	if len(pbs) == 2 {
 		if pbs[0].OpCode == Op1 && // witness program 1
 			pbs[1].OpCode == OpDATA32 { // OP_DATA_32 pushing the schnorr public key
@@ -1,6 +1,9 @@
 package rawtx
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -199,3 +202,44 @@ func TestOutputTypeString(t *testing.T) {
 		t.Error("Expected UNKNOWN")
 	}
 }
+
+func TestOutputTypeMarshalText(t *testing.T) {
+	for ot, name := range outputTypeStringMap {
+		text, err := ot.MarshalText()
+		if err != nil || string(text) != name {
+			t.Errorf("Expected MarshalText() to be %s, but got %s (%v)", name, text, err)
+		}
+
+		var parsed OutputType
+		if err := parsed.UnmarshalText(text); err != nil || parsed != ot {
+			t.Errorf("Expected UnmarshalText(%s) to be %d, but got %d (%v)", text, ot, parsed, err)
+		}
+	}
+
+	for _, unknown := range []OutputType{0, OutputType(1000)} {
+		if text, err := unknown.MarshalText(); err != nil || len(text) != 0 {
+			t.Errorf("Expected an empty name for the unknown output type %d, but got %s (%v)", unknown, text, err)
+		}
+	}
+	var parsed OutputType = 1
+	if err := parsed.UnmarshalText(nil); err != nil || parsed != 0 {
+		t.Errorf("Expected an empty name to be unmarshalled as 0, but got %d (%v)", parsed, err)
+	}
+	if b, err := json.Marshal(OutputStats{}); err != nil || !strings.Contains(string(b), `"Type":""`) {
+		t.Errorf("Expected the zero OutputStats to be marshalled, but got %s (%v)", b, err)
+	}
+	if _, err := ParseOutputType("p2tr"); err == nil {
+		t.Error("Expected an error parsing an unknown output type")
+	}
+
+	// maps keyed by output type are marshalled by name too
+	counts := map[OutputType]int{OutP2WPKH: 2, OutOPRETURN: 1}
+	b, _ := json.Marshal(counts)
+	if string(b) != `{"OPRETURN":1,"P2WPKH":2}` {
+		t.Errorf("Expected the output type map keys to be marshalled by name, but got %s", b)
+	}
+	var unmarshalled map[OutputType]int
+	if err := json.Unmarshal(b, &unmarshalled); err != nil || !reflect.DeepEqual(unmarshalled, counts) {
+		t.Errorf("Expected the output type map keys to be unmarshalled by name, but got %v (%v)", unmarshalled, err)
+	}
+}
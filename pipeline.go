@@ -0,0 +1,346 @@
+package rawtx
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Item is a raw transaction or a raw block read from a Source.
+type Item struct {
+	Raw     []byte
+	IsBlock bool
+}
+
+// Source provides the items processed by a pipeline. Next returns io.EOF
+// after the last item. Next is only called from a single goroutine.
+type Source interface {
+	Next(ctx context.Context) (Item, error)
+}
+
+// Result is a processed transaction passed to the sinks of a pipeline.
+type Result struct {
+	// ItemIndex is the position of the item in the source.
+	ItemIndex uint64
+	// Block is the block the transaction is part of. It's nil for
+	// transactions read as raw transactions.
+	Block *Block
+	// TxIndex is the position of the transaction in the block.
+	TxIndex int
+	Tx      *Tx
+	// Stats is nil if PipelineConfig.SkipStats is set.
+	Stats *TxStats
+	// Err is set if the item could not be deserialized. Tx and Stats are
+	// nil then. Results with an error are only passed to sinks if
+	// PipelineConfig.ContinueOnError is set.
+	Err error
+}
+
+// Sink consumes the results of a pipeline. Consume is only called from a
+// single goroutine. Returning an error stops the pipeline.
+type Sink interface {
+	Consume(r *Result) error
+}
+
+// SinkFunc is a function used as Sink.
+type SinkFunc func(r *Result) error
+
+// Consume calls f(r).
+func (f SinkFunc) Consume(r *Result) error {
+	return f(r)
+}
+
+// PipelineConfig configures a pipeline run with RunPipeline.
+type PipelineConfig struct {
+	// Workers is the number of goroutines processing items. Defaults to
+	// runtime.NumCPU().
+	Workers int
+	// MaxInFlight limits the number of items read from the source but not
+	// yet consumed by the sinks to bound the memory usage. Defaults to four
+	// times the number of workers.
+	MaxInFlight int
+	// Ordered passes the results to the sinks in the order of the source.
+	// Otherwise, results are passed as soon as they are ready.
+	Ordered bool
+	// SkipStats only deserializes and classifies the transactions without
+	// calling Stats().
+	SkipStats bool
+	// ContinueOnError passes results of items that could not be deserialized
+	// to the sinks instead of stopping the pipeline.
+	ContinueOnError bool
+}
+
+type pipelineJob struct {
+	index uint64
+	item  Item
+}
+
+type pipelineJobResult struct {
+	index   uint64
+	results []*Result
+}
+
+// RunPipeline reads items from the source, deserializes and classifies the
+// transactions and calls Stats() on multiple workers, and passes the results
+// to the sinks. It returns when the source is exhausted, a sink or
+// deserialization error occurs or the context is canceled.
+func RunPipeline(ctx context.Context, source Source, config PipelineConfig, sinks ...Sink) error {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	maxInFlight := config.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 4 * workers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a token is taken before an item is read and returned after its results
+	// were consumed
+	tokens := make(chan struct{}, maxInFlight)
+	jobs := make(chan pipelineJob)
+	jobResults := make(chan pipelineJobResult, maxInFlight)
+	sourceErr := make(chan error, 1)
+
+	go func() {
+		defer close(jobs)
+		for index := uint64(0); ; index++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			item, err := source.Next(ctx)
+			if err != nil {
+				if err != io.EOF {
+					sourceErr <- err
+				}
+				return
+			}
+			select {
+			case jobs <- pipelineJob{index: index, item: item}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				jobResult := pipelineJobResult{index: job.index, results: processItem(job.index, job.item, config.SkipStats)}
+				select {
+				case jobResults <- jobResult:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(jobResults)
+	}()
+
+	// The goroutines return once the context is canceled on return. Only a
+	// Source ignoring the context can keep the reader blocked in Next.
+	if err := consumeResults(ctx, jobResults, config, tokens, sinks); err != nil {
+		return err
+	}
+	select {
+	case err := <-sourceErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// consumeResults passes the job results to the sinks, in the order of the
+// item index if config.Ordered is set.
+func consumeResults(ctx context.Context, jobResults <-chan pipelineJobResult, config PipelineConfig, tokens <-chan struct{}, sinks []Sink) error {
+	consume := func(jobResult pipelineJobResult) error {
+		defer func() { <-tokens }()
+		for _, result := range jobResult.results {
+			if result.Err != nil && !config.ContinueOnError {
+				return result.Err
+			}
+			for _, sink := range sinks {
+				if err := sink.Consume(result); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	pending := make(map[uint64]pipelineJobResult)
+	var next uint64
+	for {
+		var jobResult pipelineJobResult
+		select {
+		case r, ok := <-jobResults:
+			if !ok {
+				return nil
+			}
+			jobResult = r
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if !config.Ordered {
+			if err := consume(jobResult); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pending[jobResult.index] = jobResult
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := consume(ready); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// processItem deserializes the raw transaction or block of the item and
+// returns a result per transaction.
+func processItem(index uint64, item Item, skipStats bool) []*Result {
+	if !item.IsBlock {
+		tx, err := DeserializeTx(item.Raw)
+		if err != nil {
+			return []*Result{{ItemIndex: index, Err: fmt.Errorf("item %d: %s", index, err)}}
+		}
+		return []*Result{newResult(index, nil, 0, &tx, skipStats)}
+	}
+
+	block, err := DeserializeBlock(item.Raw)
+	if err != nil {
+		return []*Result{{ItemIndex: index, Err: fmt.Errorf("item %d: %s", index, err)}}
+	}
+	results := make([]*Result, len(block.Transactions))
+	for i := range block.Transactions {
+		results[i] = newResult(index, &block, i, &block.Transactions[i], skipStats)
+	}
+	return results
+}
+
+func newResult(index uint64, block *Block, txIndex int, tx *Tx, skipStats bool) *Result {
+	r := &Result{ItemIndex: index, Block: block, TxIndex: txIndex, Tx: tx}
+	if !skipStats {
+		r.Stats = tx.Stats()
+	}
+	return r
+}
+
+// SliceSource is a Source returning the items of a slice.
+type SliceSource struct {
+	Items []Item
+	next  int
+}
+
+// Next returns the next item of the slice.
+func (s *SliceSource) Next(ctx context.Context) (Item, error) {
+	if s.next >= len(s.Items) {
+		return Item{}, io.EOF
+	}
+	s.next++
+	return s.Items[s.next-1], nil
+}
+
+// ChanSource is a Source returning the items received on a channel until the
+// channel is closed.
+type ChanSource <-chan Item
+
+// Next returns the next item received on the channel.
+func (c ChanSource) Next(ctx context.Context) (Item, error) {
+	select {
+	case item, ok := <-c:
+		if !ok {
+			return Item{}, io.EOF
+		}
+		return item, nil
+	case <-ctx.Done():
+		return Item{}, ctx.Err()
+	}
+}
+
+// HexLineSource is a Source reading newline-delimited hex encoded raw
+// transactions or blocks. Empty lines are skipped.
+type HexLineSource struct {
+	scanner *bufio.Scanner
+	isBlock bool
+	line    int
+}
+
+// maxHexLineLength is the maximum length of a line read by a HexLineSource.
+// It fits a hex encoded block of the maximum block weight.
+const maxHexLineLength = 2*4000000 + 2
+
+// NewHexLineSource returns a HexLineSource reading from r. If isBlock is set,
+// the lines are read as blocks, otherwise as transactions.
+func NewHexLineSource(r io.Reader, isBlock bool) *HexLineSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHexLineLength)
+	return &HexLineSource{scanner: scanner, isBlock: isBlock}
+}
+
+// Next returns the item on the next non-empty line.
+func (s *HexLineSource) Next(ctx context.Context) (Item, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := strings.TrimSpace(s.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		raw, err := hex.DecodeString(line)
+		if err != nil {
+			return Item{}, fmt.Errorf("line %d: %s", s.line, err)
+		}
+		return Item{Raw: raw, IsBlock: s.isBlock}, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return Item{}, err
+	}
+	return Item{}, io.EOF
+}
+
+// AggregatorSink returns a Sink adding the stats of the results without an
+// error to the aggregator.
+func AggregatorSink(a *StatsAggregator) Sink {
+	return SinkFunc(func(r *Result) error {
+		if r.Err == nil && r.Stats != nil {
+			a.Add(r.Stats)
+		}
+		return nil
+	})
+}
+
+// JSONLinesSink returns a Sink writing the stats of the results without an
+// error as newline-delimited JSON to w.
+func JSONLinesSink(w io.Writer) Sink {
+	enc := json.NewEncoder(w)
+	return SinkFunc(func(r *Result) error {
+		if r.Err != nil || r.Stats == nil {
+			return nil
+		}
+		return enc.Encode(r.Stats)
+	})
+}
@@ -0,0 +1,196 @@
+package rawtx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testTxItems(t *testing.T) (items []Item) {
+	for _, testTx := range GetTestTransactions() {
+		rawTx, err := hex.DecodeString(testTx.RawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		items = append(items, Item{Raw: rawTx})
+	}
+	return items
+}
+
+func testTxIDs(t *testing.T, items []Item) (txids []Hash) {
+	for _, item := range items {
+		tx, err := DeserializeTx(item.Raw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		txids = append(txids, tx.TxID())
+	}
+	return txids
+}
+
+func TestRunPipelineOrdered(t *testing.T) {
+	items := testTxItems(t)
+	expected := NewStatsAggregator()
+	for _, item := range items {
+		tx, err := DeserializeTx(item.Raw)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		expected.Add(tx.Stats())
+	}
+
+	aggregator := NewStatsAggregator()
+	var txids []Hash
+	collect := SinkFunc(func(r *Result) error {
+		if r.ItemIndex != uint64(len(txids)) {
+			t.Errorf("Expected the item %d, but got %d", len(txids), r.ItemIndex)
+		}
+		txids = append(txids, r.Tx.TxID())
+		return nil
+	})
+
+	config := PipelineConfig{Workers: 4, MaxInFlight: 2, Ordered: true}
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, config, collect, AggregatorSink(aggregator)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !reflect.DeepEqual(txids, testTxIDs(t, items)) {
+		t.Errorf("Expected the results in the order of the source, but got %v", txids)
+	}
+	if !reflect.DeepEqual(aggregator, expected) {
+		t.Errorf("Expected the aggregate %+v, but got %+v", expected, aggregator)
+	}
+}
+
+func TestRunPipelineUnordered(t *testing.T) {
+	items := testTxItems(t)
+	seen := make(map[uint64]bool)
+	var out bytes.Buffer
+	count := SinkFunc(func(r *Result) error {
+		if seen[r.ItemIndex] {
+			t.Errorf("Expected the item %d only once", r.ItemIndex)
+		}
+		seen[r.ItemIndex] = true
+		return nil
+	})
+
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, PipelineConfig{}, count, JSONLinesSink(&out)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(seen) != len(items) {
+		t.Errorf("Expected %d results, but got %d", len(items), len(seen))
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var stats TxStats
+	if len(lines) != len(items) || json.Unmarshal([]byte(lines[0]), &stats) != nil {
+		t.Errorf("Expected %d lines of JSON, but got %d", len(items), len(lines))
+	}
+}
+
+func TestRunPipelineBlocks(t *testing.T) {
+	raw := testBlock(t)
+	items := []Item{{Raw: raw, IsBlock: true}, {Raw: raw, IsBlock: true}}
+	testTxns := GetTestTransactions()
+	expectedTxIDs := testTxIDs(t, testTxItems(t))
+
+	var results []*Result
+	collect := SinkFunc(func(r *Result) error {
+		results = append(results, r)
+		return nil
+	})
+	config := PipelineConfig{Workers: 2, Ordered: true, SkipStats: true}
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, config, collect); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(results) != 2*len(testTxns) {
+		t.Fatalf("Expected %d results, but got %d", 2*len(testTxns), len(results))
+	}
+	for i, r := range results {
+		if r.ItemIndex != uint64(i/len(testTxns)) || r.TxIndex != i%len(testTxns) || r.Block == nil {
+			t.Errorf("Expected the transaction %d of block %d, but got %+v", i%len(testTxns), i/len(testTxns), r)
+		}
+		if r.Stats != nil {
+			t.Error("Expected no stats with SkipStats")
+		}
+		if r.Tx.TxID() != expectedTxIDs[i%len(testTxns)] {
+			t.Errorf("Expected the txid %s, but got %s", expectedTxIDs[i%len(testTxns)], r.Tx.TxID())
+		}
+	}
+}
+
+func TestRunPipelineErrors(t *testing.T) {
+	items := append(testTxItems(t), Item{Raw: []byte{0x01}})
+
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, PipelineConfig{Ordered: true}); err == nil {
+		t.Error("Expected an error for the invalid transaction")
+	}
+
+	var errs int
+	countErrors := SinkFunc(func(r *Result) error {
+		if r.Err != nil {
+			errs++
+		}
+		return nil
+	})
+	config := PipelineConfig{ContinueOnError: true}
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, config, countErrors, AggregatorSink(NewStatsAggregator())); err != nil || errs != 1 {
+		t.Errorf("Expected the invalid transaction to be passed to the sink, but got %d errors (%v)", errs, err)
+	}
+
+	errSink := errors.New("sink error")
+	var consumed int
+	failing := SinkFunc(func(r *Result) error {
+		consumed++
+		return errSink
+	})
+	if err := RunPipeline(context.Background(), &SliceSource{Items: items}, PipelineConfig{Workers: 2}, failing); err != errSink || consumed != 1 {
+		t.Errorf("Expected the pipeline to stop after the sink error, but got %v after %d results", err, consumed)
+	}
+
+	source := NewHexLineSource(strings.NewReader(GetTestTransactions()[0].RawTx+"\nzz\n"), false)
+	if err := RunPipeline(context.Background(), source, PipelineConfig{}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error for line 2, but got %v", err)
+	}
+}
+
+func TestRunPipelineCancel(t *testing.T) {
+	item := testTxItems(t)[0]
+	items := make(chan Item)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelAfterFirst := SinkFunc(func(r *Result) error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		// the channel is never closed
+		items <- item
+	}()
+	if err := RunPipeline(ctx, ChanSource(items), PipelineConfig{Workers: 2}, cancelAfterFirst); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+}
+
+func TestHexLineSource(t *testing.T) {
+	testTxns := GetTestTransactions()
+	expectedTxIDs := testTxIDs(t, testTxItems(t))[:2]
+	source := NewHexLineSource(strings.NewReader(testTxns[0].RawTx+"\n\n  "+testTxns[1].RawTx+"  \n"), false)
+
+	var txids []Hash
+	collect := SinkFunc(func(r *Result) error {
+		txids = append(txids, r.Tx.TxID())
+		return nil
+	})
+	if err := RunPipeline(context.Background(), source, PipelineConfig{Ordered: true}, collect); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(txids, expectedTxIDs) {
+		t.Errorf("Expected the txids %v, but got %v", expectedTxIDs, txids)
+	}
+}
@@ -0,0 +1,403 @@
+package rawtx
+
+import "fmt"
+
+// Policy contains the standardness rules a Bitcoin Core node applies to
+// transactions before accepting them into its mempool and relaying them.
+// Policies of different Bitcoin Core versions can be constructed with e.g.
+// PolicyCoreV24() and customized by changing single fields.
+type Policy struct {
+	// MaxStandardVersion is the highest standard transaction version.
+	MaxStandardVersion int32
+	// MaxStandardTxWeight is the maximum weight of a standard transaction.
+	MaxStandardTxWeight int
+	// MinStandardTxNonWitnessSize is the minimum size of a standard
+	// transaction without the witness.
+	MinStandardTxNonWitnessSize int
+	// MaxScriptSigSize is the maximum size of a standard scriptSig.
+	MaxScriptSigSize int
+	// DustRelayFee is the feerate in sat/kvB used to calculate the dust threshold.
+	DustRelayFee int64
+	// MaxDustOutputs is the number of dust outputs allowed per transaction.
+	MaxDustOutputs int
+	// DataCarrier indicates if OP_RETURN outputs are relayed at all.
+	DataCarrier bool
+	// MaxDataCarrierBytes is the maximum combined size of the OP_RETURN
+	// scriptPubKeys of a transaction including the OP_RETURNs.
+	MaxDataCarrierBytes int
+	// MaxOPReturnOutputs is the number of OP_RETURN outputs allowed per
+	// transaction. Zero means there is no limit.
+	MaxOPReturnOutputs int
+	// PermitBareMultisig indicates if bare multisig (P2MS) outputs are standard.
+	PermitBareMultisig bool
+	// MaxBareMultisigKeys is the maximum number of keys in a standard P2MS output.
+	MaxBareMultisigKeys int
+	// MaxP2WSHScriptSize is the maximum size of a standard P2WSH witness script.
+	MaxP2WSHScriptSize int
+	// MaxP2WSHStackItems is the maximum number of witness stack items
+	// (excluding the witness script) of a standard P2WSH spend.
+	MaxP2WSHStackItems int
+	// MaxP2WSHStackItemSize is the maximum size of a witness stack item
+	// (excluding the witness script) of a standard P2WSH spend.
+	MaxP2WSHStackItemSize int
+	// MaxTapscriptStackItemSize is the maximum size of a witness stack item
+	// (excluding the script and the control block) of a standard tapscript spend.
+	MaxTapscriptStackItemSize int
+	// PermitAnnex indicates if taproot spends with an annex are standard.
+	PermitAnnex bool
+	// MaxStandardTxSigOpsCost is the maximum sigop cost of a standard transaction.
+	MaxStandardTxSigOpsCost int
+	// MaxP2SHSigOps is the maximum number of sigops in a standard P2SH redeem script.
+	MaxP2SHSigOps int
+}
+
+// PolicyCoreV24 returns the default standardness policy of Bitcoin Core v24 to v27.
+func PolicyCoreV24() Policy {
+	return Policy{
+		MaxStandardVersion:          2,
+		MaxStandardTxWeight:         400000,
+		MinStandardTxNonWitnessSize: 65,
+		MaxScriptSigSize:            1650,
+		DustRelayFee:                3000,
+		MaxDustOutputs:              0,
+		DataCarrier:                 true,
+		MaxDataCarrierBytes:         83,
+		MaxOPReturnOutputs:          1,
+		PermitBareMultisig:          true,
+		MaxBareMultisigKeys:         3,
+		MaxP2WSHScriptSize:          3600,
+		MaxP2WSHStackItems:          100,
+		MaxP2WSHStackItemSize:       80,
+		MaxTapscriptStackItemSize:   80,
+		PermitAnnex:                 false,
+		MaxStandardTxSigOpsCost:     16000,
+		MaxP2SHSigOps:               15,
+	}
+}
+
+// PolicyCoreV28 returns the default standardness policy of Bitcoin Core v28,
+// which made version 3 (TRUC) transactions standard.
+func PolicyCoreV28() Policy {
+	policy := PolicyCoreV24()
+	policy.MaxStandardVersion = 3
+	return policy
+}
+
+// PolicyCoreV29 returns the default standardness policy of Bitcoin Core v29,
+// which allows a single (ephemeral) dust output per transaction.
+func PolicyCoreV29() Policy {
+	policy := PolicyCoreV28()
+	policy.MaxDustOutputs = 1
+	return policy
+}
+
+// PolicyCoreV30 returns the default standardness policy of Bitcoin Core v30,
+// which allows multiple OP_RETURN outputs with a combined size of up to the
+// maximum transaction size.
+func PolicyCoreV30() Policy {
+	policy := PolicyCoreV29()
+	policy.MaxDataCarrierBytes = 100000
+	policy.MaxOPReturnOutputs = 0
+	return policy
+}
+
+// DefaultPolicy returns the standardness policy of the latest supported
+// Bitcoin Core version.
+func DefaultPolicy() Policy {
+	return PolicyCoreV30()
+}
+
+// PolicyViolationType defines the type of a standardness policy violation
+type PolicyViolationType int
+
+// Possible types of policy violations
+const (
+	ViolationVersion PolicyViolationType = iota + 1
+	ViolationTxSize
+	ViolationTxSizeSmall
+	ViolationScriptSigSize
+	ViolationScriptSigNotPushOnly
+	ViolationNonStandardScriptPubKey
+	ViolationBareMultisig
+	ViolationDust
+	ViolationOPReturnSize
+	ViolationMultipleOPReturns
+	ViolationWitness
+	ViolationTooManySigOps
+	ViolationP2SHSigOps
+)
+
+var policyViolationTypeStringMap = map[PolicyViolationType]string{
+	ViolationVersion:                 "VERSION",
+	ViolationTxSize:                  "TX_SIZE",
+	ViolationTxSizeSmall:             "TX_SIZE_SMALL",
+	ViolationScriptSigSize:           "SCRIPTSIG_SIZE",
+	ViolationScriptSigNotPushOnly:    "SCRIPTSIG_NOT_PUSHONLY",
+	ViolationNonStandardScriptPubKey: "NONSTANDARD_SCRIPTPUBKEY",
+	ViolationBareMultisig:            "BARE_MULTISIG",
+	ViolationDust:                    "DUST",
+	ViolationOPReturnSize:            "OPRETURN_SIZE",
+	ViolationMultipleOPReturns:       "MULTIPLE_OPRETURNS",
+	ViolationWitness:                 "WITNESS",
+	ViolationTooManySigOps:           "TOO_MANY_SIGOPS",
+	ViolationP2SHSigOps:              "P2SH_SIGOPS",
+}
+
+// policyViolationRejectReasonMap maps the policy violations to the reject
+// reasons used by Bitcoin Core.
+var policyViolationRejectReasonMap = map[PolicyViolationType]string{
+	ViolationVersion:                 "version",
+	ViolationTxSize:                  "tx-size",
+	ViolationTxSizeSmall:             "tx-size-small",
+	ViolationScriptSigSize:           "scriptsig-size",
+	ViolationScriptSigNotPushOnly:    "scriptsig-not-pushonly",
+	ViolationNonStandardScriptPubKey: "scriptpubkey",
+	ViolationBareMultisig:            "bare-multisig",
+	ViolationDust:                    "dust",
+	ViolationOPReturnSize:            "scriptpubkey",
+	ViolationMultipleOPReturns:       "multi-op-return",
+	ViolationWitness:                 "bad-witness-nonstandard",
+	ViolationTooManySigOps:           "bad-txns-too-many-sigops",
+	ViolationP2SHSigOps:              "bad-txns-nonstandard-inputs",
+}
+
+func (pvt PolicyViolationType) String() string {
+	return policyViolationTypeStringMap[pvt]
+}
+
+// RejectReason returns the reject reason Bitcoin Core uses for the violation.
+func (pvt PolicyViolationType) RejectReason() string {
+	return policyViolationRejectReasonMap[pvt]
+}
+
+// PolicyViolation describes why a transaction is non-standard. Index is the
+// index of the input or output causing the violation or -1 if the violation
+// applies to the whole transaction.
+type PolicyViolation struct {
+	Type    PolicyViolationType
+	Index   int
+	Details string
+}
+
+func (pv PolicyViolation) String() string {
+	if pv.Index >= 0 {
+		return fmt.Sprintf("%s (%d): %s", pv.Type.RejectReason(), pv.Index, pv.Details)
+	}
+	return fmt.Sprintf("%s: %s", pv.Type.RejectReason(), pv.Details)
+}
+
+// IsStandard returns a boolean indicating if the transaction is standard
+// under the passed policy.
+func (tx *Tx) IsStandard(policy Policy) bool {
+	return len(tx.CheckStandard(policy)) == 0
+}
+
+// CheckStandard checks the transaction against the passed standardness policy
+// and returns all violations found. This mirrors Bitcoin Core's IsStandardTx
+// and IsWitnessStandard. As the prevouts are not part of the raw transaction,
+// the witness rules are applied based on the input type if the prevout of an
+// input is unknown.
+func (tx *Tx) CheckStandard(policy Policy) (violations []PolicyViolation) {
+	addViolation := func(t PolicyViolationType, index int, format string, a ...interface{}) {
+		violations = append(violations, PolicyViolation{Type: t, Index: index, Details: fmt.Sprintf(format, a...)})
+	}
+
+	if tx.Version > policy.MaxStandardVersion || tx.Version < 1 {
+		addViolation(ViolationVersion, -1, "version %d is not between 1 and %d", tx.Version, policy.MaxStandardVersion)
+	}
+
+	if weight := tx.GetWeight(); weight > policy.MaxStandardTxWeight {
+		addViolation(ViolationTxSize, -1, "weight %d is larger than %d", weight, policy.MaxStandardTxWeight)
+	}
+
+	if tx.serializeSizeStripped < policy.MinStandardTxNonWitnessSize {
+		addViolation(ViolationTxSizeSmall, -1, "non-witness size %d is smaller than %d", tx.serializeSizeStripped, policy.MinStandardTxNonWitnessSize)
+	}
+
+	for index, in := range tx.Inputs {
+		if len(in.ScriptSig) > policy.MaxScriptSigSize {
+			addViolation(ViolationScriptSigSize, index, "scriptSig size %d is larger than %d", len(in.ScriptSig), policy.MaxScriptSigSize)
+		}
+		if !in.ScriptSig.IsPushOnly() {
+			addViolation(ViolationScriptSigNotPushOnly, index, "scriptSig contains non-push operations")
+		}
+		if details, ok := in.checkWitnessStandard(policy); !ok {
+			addViolation(ViolationWitness, index, details)
+		}
+		if sigops := in.P2SHSigOpCount(); sigops > policy.MaxP2SHSigOps {
+			addViolation(ViolationP2SHSigOps, index, "%d P2SH sigops are more than %d", sigops, policy.MaxP2SHSigOps)
+		}
+	}
+
+	if sigOpCost := tx.SigOpCost(); sigOpCost > policy.MaxStandardTxSigOpsCost {
+		addViolation(ViolationTooManySigOps, -1, "sigop cost %d is larger than %d", sigOpCost, policy.MaxStandardTxSigOpsCost)
+	}
+
+	var numOPReturns, numDust, dataCarrierBytes int
+	for index, out := range tx.Outputs {
+		if out.ScriptPubKey.IsNullData() {
+			numOPReturns++
+			dataCarrierBytes += len(out.ScriptPubKey)
+			continue
+		}
+
+		if isMultisig, m, n := out.IsP2MSOutput(); isMultisig {
+			if n < 1 || n > policy.MaxBareMultisigKeys || m < 1 || m > n {
+				addViolation(ViolationNonStandardScriptPubKey, index, "%d-of-%d bare multisig is non-standard", m, n)
+			} else if !policy.PermitBareMultisig {
+				addViolation(ViolationBareMultisig, index, "bare multisig is not permitted")
+			}
+		} else if !out.isStandardScriptPubKey() {
+			addViolation(ViolationNonStandardScriptPubKey, index, "scriptPubKey type is non-standard")
+		}
+
+		if out.IsDust(policy.DustRelayFee) {
+			numDust++
+		}
+	}
+
+	if numOPReturns > 0 && !policy.DataCarrier {
+		addViolation(ViolationOPReturnSize, -1, "OP_RETURN outputs are not relayed")
+	} else if dataCarrierBytes > policy.MaxDataCarrierBytes {
+		addViolation(ViolationOPReturnSize, -1, "combined OP_RETURN scriptPubKey size %d is larger than %d", dataCarrierBytes, policy.MaxDataCarrierBytes)
+	}
+	if policy.MaxOPReturnOutputs > 0 && numOPReturns > policy.MaxOPReturnOutputs {
+		addViolation(ViolationMultipleOPReturns, -1, "%d OP_RETURN outputs, but only %d allowed", numOPReturns, policy.MaxOPReturnOutputs)
+	}
+
+	if numDust > policy.MaxDustOutputs {
+		addViolation(ViolationDust, -1, "%d dust outputs, but only %d allowed", numDust, policy.MaxDustOutputs)
+	}
+
+	return violations
+}
+
+// isStandardScriptPubKey checks if the scriptPubKey of a non-multisig and
+// non-OP_RETURN output is of a standard type. Witness programs of unknown
+// versions are standard.
+func (out *Output) isStandardScriptPubKey() bool {
+	switch out.GetType() {
+	case OutP2PK, OutP2PKH, OutP2SH, OutP2WPKH, OutP2WSH, OutP2TR:
+		return true
+	}
+	if isWitnessProgram, version, _ := out.ScriptPubKey.IsWitnessProgram(); isWitnessProgram && version != 0 {
+		return true
+	}
+	return false
+}
+
+// DustThreshold returns the minimum value in satoshi an output needs to have to
+// not be considered dust for the passed dust relay feerate in sat/kvB. The
+// threshold is the fee needed to create and spend the output. Unspendable
+// outputs have a dust threshold of zero.
+func (out *Output) DustThreshold(dustRelayFee int64) int64 {
+	if out.ScriptPubKey.IsUnspendable() {
+		return 0
+	}
+
+	// the serialized output: 8 byte value, the script length and the script
+	size := 8 + compactSizeLength(uint64(len(out.ScriptPubKey))) + len(out.ScriptPubKey)
+	if isWitnessProgram, _, _ := out.ScriptPubKey.IsWitnessProgram(); isWitnessProgram {
+		// outpoint, scriptSig length, the witness discounted by the
+		// witness scale factor and the sequence
+		size += 32 + 4 + 1 + (107 / 4) + 4
+	} else {
+		// outpoint, scriptSig with a signature and a pubkey and the sequence
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return dustRelayFee * int64(size) / 1000
+}
+
+// IsDust returns a boolean indicating if the output is dust under the passed
+// dust relay feerate in sat/kvB.
+func (out *Output) IsDust(dustRelayFee int64) bool {
+	return out.Value < out.DustThreshold(dustRelayFee)
+}
+
+// checkWitnessStandard applies Bitcoin Core's witness standardness rules to the
+// input. False and a description are returned if the witness is non-standard.
+func (in *Input) checkWitnessStandard(policy Policy) (string, bool) {
+	if !in.HasWitness() || in.IsCoinbase() {
+		return "", true
+	}
+
+	isWitnessProgram, isP2WSH, isP2TR := in.spentWitnessProgram()
+	if !isWitnessProgram {
+		return "witness on an input not spending a witness program", false
+	}
+	witness := in.Witness
+
+	if isP2WSH {
+		witnessScript := witness[len(witness)-1].PushedData
+		if len(witnessScript) > policy.MaxP2WSHScriptSize {
+			return fmt.Sprintf("witness script size %d is larger than %d", len(witnessScript), policy.MaxP2WSHScriptSize), false
+		}
+		stack := witness[:len(witness)-1]
+		if len(stack) > policy.MaxP2WSHStackItems {
+			return fmt.Sprintf("%d witness stack items are more than %d", len(stack), policy.MaxP2WSHStackItems), false
+		}
+		for _, item := range stack {
+			if len(item.PushedData) > policy.MaxP2WSHStackItemSize {
+				return fmt.Sprintf("witness stack item size %d is larger than %d", len(item.PushedData), policy.MaxP2WSHStackItemSize), false
+			}
+		}
+	}
+
+	if isP2TR {
+		stack := witness
+		if len(stack) >= 2 && len(stack[len(stack)-1].PushedData) > 0 && stack[len(stack)-1].PushedData[0] == TAPROOT_ANNEX_INDICATOR {
+			if !policy.PermitAnnex {
+				return "taproot annex is non-standard", false
+			}
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) >= 2 {
+			controlBlock := stack[len(stack)-1].PushedData
+			if len(controlBlock) == 0 {
+				return "empty taproot control block", false
+			}
+			if controlBlock[0]&TAPROOT_LEAF_MASK == TAPROOT_LEAF_TAPSCRIPT {
+				for _, item := range stack[:len(stack)-2] {
+					if len(item.PushedData) > policy.MaxTapscriptStackItemSize {
+						return fmt.Sprintf("tapscript stack item size %d is larger than %d", len(item.PushedData), policy.MaxTapscriptStackItemSize), false
+					}
+				}
+			}
+		}
+	}
+
+	return "", true
+}
+
+// spentWitnessProgram returns if the input spends a witness program (native
+// or nested) and if it's a P2WSH (native or nested) or a P2TR output. The
+// prevout is used if known, otherwise the input type is used and a witness
+// program is assumed.
+func (in *Input) spentWitnessProgram() (isWitnessProgram bool, isP2WSH bool, isP2TR bool) {
+	if in.Prevout == nil {
+		switch in.GetType() {
+		case InP2WSH, InP2SH_P2WSH:
+			return true, true, false
+		case InP2TRKP, InP2TRSP:
+			return true, false, true
+		}
+		return true, false, false
+	}
+
+	script := in.Prevout.ScriptPubKey
+	isNested := false
+	if in.Prevout.IsP2SHOutput() {
+		pbs := in.ParsedScriptSig()
+		if len(pbs) == 0 {
+			return false, false, false
+		}
+		script = pbs[len(pbs)-1].PushedData
+		isNested = true
+	}
+
+	isWitnessProgram, version, program := script.IsWitnessProgram()
+	if !isWitnessProgram {
+		return false, false, false
+	}
+	return true, version == 0 && len(program) == 32, version == 1 && len(program) == 32 && !isNested
+}
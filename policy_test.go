@@ -0,0 +1,188 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// p2wpkhScriptPubKey is a P2WPKH scriptPubKey used in the policy tests
+var p2wpkhScriptPubKey, _ = hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+
+// newTestPolicyTx returns a standard version 2 transaction with one P2WPKH
+// input and one P2WPKH output. The passed function can modify the
+// transaction before it's converted into a Tx.
+func newTestPolicyTx(modify func(wireTx *wire.MsgTx)) Tx {
+	wireTx := wire.NewMsgTx(2)
+	prevHash := chainhash.Hash{0x01}
+	txIn := wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil)
+	sig, _ := hex.DecodeString("304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee01")
+	pubkey, _ := hex.DecodeString("025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee6357")
+	txIn.Witness = wire.TxWitness{sig, pubkey}
+	wireTx.AddTxIn(txIn)
+	wireTx.AddTxOut(wire.NewTxOut(10000, p2wpkhScriptPubKey))
+	if modify != nil {
+		modify(wireTx)
+	}
+	tx := Tx{}
+	tx.FromWireMsgTx(wireTx)
+	return tx
+}
+
+func hasViolation(violations []PolicyViolation, violationType PolicyViolationType) bool {
+	for _, v := range violations {
+		if v.Type == violationType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckStandard(t *testing.T) {
+	p2wshStack := func(items ...[]byte) func(*wire.MsgTx) {
+		return func(wireTx *wire.MsgTx) {
+			wireTx.TxIn[0].Witness = items
+		}
+	}
+	withPrevout := func(tx Tx, scriptPubKey []byte) Tx {
+		tx.Inputs[0].Prevout = NewOutput(20000, scriptPubKey)
+		return tx
+	}
+	p2pkhScriptPubKey, _ := hex.DecodeString("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+	multisig1of4, _ := hex.DecodeString("5121020000000000000000000000000000000000000000000000000000000000000001210200000000000000000000000000000000000000000000000000000000000000022102000000000000000000000000000000000000000000000000000000000000000321020000000000000000000000000000000000000000000000000000000000000004" + "54ae")
+	multisig1of2, _ := hex.DecodeString("512102000000000000000000000000000000000000000000000000000000000000000121020000000000000000000000000000000000000000000000000000000000000002" + "52ae")
+
+	testCases := []struct {
+		name     string
+		tx       Tx
+		policy   Policy
+		expected []PolicyViolationType
+	}{
+		{"standard", newTestPolicyTx(nil), PolicyCoreV24(), nil},
+		{"version 3 before v28", newTestPolicyTx(func(w *wire.MsgTx) { w.Version = 3 }), PolicyCoreV24(), []PolicyViolationType{ViolationVersion}},
+		{"version 3 with v28", newTestPolicyTx(func(w *wire.MsgTx) { w.Version = 3 }), PolicyCoreV28(), nil},
+		{"version 0", newTestPolicyTx(func(w *wire.MsgTx) { w.Version = 0 }), DefaultPolicy(), []PolicyViolationType{ViolationVersion}},
+		{"too small", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxOut[0].PkScript = []byte{byte(OpRETURN)}
+			w.TxOut[0].Value = 0
+		}), DefaultPolicy(), []PolicyViolationType{ViolationTxSizeSmall}},
+		{"scriptSig not push-only", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxIn[0].SignatureScript = []byte{byte(OpDUP)}
+		}), DefaultPolicy(), []PolicyViolationType{ViolationScriptSigNotPushOnly}},
+		{"scriptSig too large", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxIn[0].SignatureScript = append([]byte{byte(OpPUSHDATA2), 0x72, 0x06}, make([]byte, 1650)...)
+		}), DefaultPolicy(), []PolicyViolationType{ViolationScriptSigSize}},
+		{"dust output", newTestPolicyTx(func(w *wire.MsgTx) { w.TxOut[0].Value = 293 }), PolicyCoreV24(), []PolicyViolationType{ViolationDust}},
+		{"no dust at threshold", newTestPolicyTx(func(w *wire.MsgTx) { w.TxOut[0].Value = 294 }), PolicyCoreV24(), nil},
+		{"single ephemeral dust output", newTestPolicyTx(func(w *wire.MsgTx) { w.TxOut[0].Value = 0 }), PolicyCoreV29(), nil},
+		{"two dust outputs", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxOut[0].Value = 0
+			w.AddTxOut(wire.NewTxOut(0, p2wpkhScriptPubKey))
+		}), PolicyCoreV29(), []PolicyViolationType{ViolationDust}},
+		{"two OP_RETURNs before v30", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.AddTxOut(wire.NewTxOut(0, []byte{byte(OpRETURN), byte(OpDATA1), 0xb1}))
+			w.AddTxOut(wire.NewTxOut(0, []byte{byte(OpRETURN), byte(OpDATA1), 0x0c}))
+		}), PolicyCoreV24(), []PolicyViolationType{ViolationMultipleOPReturns}},
+		{"two OP_RETURNs with v30", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.AddTxOut(wire.NewTxOut(0, []byte{byte(OpRETURN), byte(OpDATA1), 0xb1}))
+			w.AddTxOut(wire.NewTxOut(0, []byte{byte(OpRETURN), byte(OpDATA1), 0x0c}))
+		}), PolicyCoreV30(), nil},
+		{"large OP_RETURN before v30", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.AddTxOut(wire.NewTxOut(0, append([]byte{byte(OpRETURN), byte(OpPUSHDATA1), 81}, make([]byte, 81)...)))
+		}), PolicyCoreV24(), []PolicyViolationType{ViolationOPReturnSize}},
+		{"large OP_RETURN with v30", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.AddTxOut(wire.NewTxOut(0, append([]byte{byte(OpRETURN), byte(OpPUSHDATA1), 81}, make([]byte, 81)...)))
+		}), PolicyCoreV30(), nil},
+		{"large combined OP_RETURNs", newTestPolicyTx(func(w *wire.MsgTx) {
+			for i := 0; i < 3; i++ {
+				w.AddTxOut(wire.NewTxOut(0, append([]byte{byte(OpRETURN), byte(OpPUSHDATA1), 50}, make([]byte, 50)...)))
+			}
+		}), func() Policy {
+			policy := PolicyCoreV30()
+			policy.MaxDataCarrierBytes = 83
+			return policy
+		}(), []PolicyViolationType{ViolationOPReturnSize}},
+		{"OP_RETURN without data carrier", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.AddTxOut(wire.NewTxOut(0, []byte{byte(OpRETURN), byte(OpDATA1), 0xb1}))
+		}), func() Policy {
+			policy := PolicyCoreV30()
+			policy.DataCarrier = false
+			return policy
+		}(), []PolicyViolationType{ViolationOPReturnSize}},
+		{"1-of-4 bare multisig", newTestPolicyTx(func(w *wire.MsgTx) { w.TxOut[0].PkScript = multisig1of4 }), DefaultPolicy(), []PolicyViolationType{ViolationNonStandardScriptPubKey}},
+		{"1-of-2 bare multisig", newTestPolicyTx(func(w *wire.MsgTx) { w.TxOut[0].PkScript = multisig1of2 }), DefaultPolicy(), nil},
+		{"nonstandard scriptPubKey", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxOut[0].PkScript = []byte{byte(OpTRUE), byte(OpNOP), byte(OpNOP), byte(OpNOP), byte(OpNOP)}
+		}), DefaultPolicy(), []PolicyViolationType{ViolationNonStandardScriptPubKey}},
+		{"unknown witness version", newTestPolicyTx(func(w *wire.MsgTx) {
+			w.TxOut[0].PkScript = append([]byte{byte(Op2), byte(OpDATA32)}, make([]byte, 32)...)
+		}), DefaultPolicy(), nil},
+		{"P2WSH stack item too large", newTestPolicyTx(p2wshStack(make([]byte, 81), []byte{byte(OpDROP), byte(OpTRUE)})), DefaultPolicy(), []PolicyViolationType{ViolationWitness}},
+		{"P2WSH witness script too large", newTestPolicyTx(p2wshStack([]byte{0x01}, bytes.Repeat([]byte{byte(OpNOP)}, 3601))), DefaultPolicy(), []PolicyViolationType{ViolationWitness}},
+		{"P2WSH standard", newTestPolicyTx(p2wshStack(make([]byte, 80), []byte{byte(OpDROP), byte(OpTRUE)})), DefaultPolicy(), nil},
+		{"witness spending a P2WPKH prevout", withPrevout(newTestPolicyTx(nil), p2wpkhScriptPubKey), DefaultPolicy(), nil},
+		{"witness spending a P2PKH prevout", withPrevout(newTestPolicyTx(nil), p2pkhScriptPubKey), DefaultPolicy(), []PolicyViolationType{ViolationWitness}},
+	}
+
+	for _, tc := range testCases {
+		violations := tc.tx.CheckStandard(tc.policy)
+		if len(violations) != len(tc.expected) {
+			t.Errorf("Expected %d violations for %s, but got %v", len(tc.expected), tc.name, violations)
+			continue
+		}
+		for _, expected := range tc.expected {
+			if !hasViolation(violations, expected) {
+				t.Errorf("Expected violation %s for %s, but got %v", expected, tc.name, violations)
+			}
+		}
+		if tc.tx.IsStandard(tc.policy) != (len(tc.expected) == 0) {
+			t.Errorf("Expected IsStandard() to be %t for %s", len(tc.expected) == 0, tc.name)
+		}
+	}
+}
+
+func TestDustThreshold(t *testing.T) {
+	p2pkh, _ := hex.DecodeString("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+	testCases := []struct {
+		script   []byte
+		expected int64
+	}{
+		{p2pkh, 546},
+		{p2wpkhScriptPubKey, 294},
+		{[]byte{byte(OpRETURN)}, 0},
+	}
+
+	for _, tc := range testCases {
+		out := Output{ScriptPubKey: tc.script}
+		if threshold := out.DustThreshold(3000); threshold != tc.expected {
+			t.Errorf("Expected DustThreshold() to be %d, but got %d for script %x", tc.expected, threshold, tc.script)
+		}
+	}
+}
+
+func TestIsPushOnly(t *testing.T) {
+	testCases := map[string]bool{
+		"":                 true,
+		"00":               true,
+		"4f51":             true,
+		"0201":             false, // push past the end of the script
+		"4c":               false, // missing OP_PUSHDATA1 length
+		"4c0101":           true,
+		"76":               false,
+		"0302030476":       false,
+		"50":               true, // OP_RESERVED is considered push-only
+		"4d0100ff":         true,
+		"4e01000000ff":     true,
+		"4e0100000000ffff": false,
+	}
+
+	for script, expected := range testCases {
+		s, _ := hex.DecodeString(script)
+		if BitcoinScript(s).IsPushOnly() != expected {
+			t.Errorf("Expected IsPushOnly() to be %t for script %s", expected, script)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// PoolMatchReason defines why a block was attributed to a mining pool
+type PoolMatchReason int
+
+// Reasons for a mining pool match
+const (
+	// PoolMatchPayoutAddress means a coinbase output pays to an address of
+	// the pool.
+	PoolMatchPayoutAddress PoolMatchReason = iota + 1
+	// PoolMatchCoinbaseTag means the coinbase scriptSig contains a tag of the
+	// pool.
+	PoolMatchCoinbaseTag
+)
+
+var poolMatchReasonStringMap = map[PoolMatchReason]string{
+	PoolMatchPayoutAddress: "payout address",
+	PoolMatchCoinbaseTag:   "coinbase tag",
+}
+
+func (pmr PoolMatchReason) String() string {
+	return poolMatchReasonStringMap[pmr]
+}
+
+// Pool is a mining pool definition as in the community-maintained pool lists.
+type Pool struct {
+	ID        int      `json:"id,omitempty"`
+	Name      string   `json:"name"`
+	Link      string   `json:"link,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// PoolMatch is the mining pool a block was attributed to, the reason and the
+// matched tag or address.
+type PoolMatch struct {
+	Pool   *Pool
+	Reason PoolMatchReason
+	Match  string
+	// OutputIndex is the index of the coinbase output paying to the matched
+	// address or -1 for a tag match.
+	OutputIndex int
+}
+
+// PoolList identifies the mining pool of blocks. Payout addresses take
+// precedence over coinbase tags, as a pool can't fake the payout address of
+// another pool, but tags can be copied.
+type PoolList struct {
+	Pools     []Pool
+	params    *chaincfg.Params
+	addresses map[string]*Pool
+}
+
+// NewPoolList returns a PoolList for the pool definitions. The addresses are
+// expected to be valid for the network params.
+func NewPoolList(pools []Pool, params *chaincfg.Params) *PoolList {
+	pl := &PoolList{Pools: pools, params: params, addresses: make(map[string]*Pool)}
+	for i := range pl.Pools {
+		for _, address := range pl.Pools[i].Addresses {
+			if _, ok := pl.addresses[address]; !ok {
+				pl.addresses[address] = &pl.Pools[i]
+			}
+		}
+	}
+	return pl
+}
+
+// legacyPoolList is the format of the pools.json used by blockchain.info,
+// btc.com and others. Tags and addresses are keys of objects with the pool.
+type legacyPoolList struct {
+	CoinbaseTags    map[string]legacyPool `json:"coinbase_tags"`
+	PayoutAddresses map[string]legacyPool `json:"payout_addresses"`
+}
+
+type legacyPool struct {
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
+
+// LoadPoolList reads a pool list in JSON. Both the array of pools of the
+// pools-v2.json format and the object with coinbase_tags and payout_addresses
+// of the legacy pools.json format are supported.
+func LoadPoolList(r io.Reader, params *chaincfg.Params) (*PoolList, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var pools []Pool
+		if err := json.Unmarshal(b, &pools); err != nil {
+			return nil, fmt.Errorf("pool list: %s", err)
+		}
+		return NewPoolList(pools, params), nil
+	}
+
+	var legacy legacyPoolList
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return nil, fmt.Errorf("pool list: %s", err)
+	}
+	return NewPoolList(legacy.pools(), params), nil
+}
+
+// LoadPoolListFile reads a pool list from a JSON file.
+func LoadPoolListFile(name string, params *chaincfg.Params) (*PoolList, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadPoolList(f, params)
+}
+
+// pools groups the legacy tags and addresses by pool name. The pools, tags
+// and addresses are sorted to be independent of the JSON object order.
+func (l *legacyPoolList) pools() []Pool {
+	byName := make(map[string]*Pool)
+	get := func(lp legacyPool) *Pool {
+		p, ok := byName[lp.Name]
+		if !ok {
+			p = &Pool{Name: lp.Name, Link: lp.Link}
+			byName[lp.Name] = p
+		}
+		return p
+	}
+	for tag, lp := range l.CoinbaseTags {
+		p := get(lp)
+		p.Tags = append(p.Tags, tag)
+	}
+	for address, lp := range l.PayoutAddresses {
+		p := get(lp)
+		p.Addresses = append(p.Addresses, address)
+	}
+
+	pools := make([]Pool, 0, len(byName))
+	for _, p := range byName {
+		sort.Strings(p.Tags)
+		sort.Strings(p.Addresses)
+		pools = append(pools, *p)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools
+}
+
+// Identify returns the mining pool of a coinbase transaction. The outputs are
+// checked for payout addresses first, then the scriptSig for tags. Of multiple
+// matching tags, the longest wins, so a tag containing another tag takes
+// precedence. False is returned if the transaction isn't a coinbase or no pool
+// matches.
+func (pl *PoolList) Identify(coinbase *Tx) (*PoolMatch, bool) {
+	if !coinbase.IsCoinbase() {
+		return nil, false
+	}
+	for i, out := range coinbase.Outputs {
+		address := out.ScriptPubKey.DecodeScriptPubKey(pl.params).Address
+		if pool, ok := pl.addresses[address]; ok && address != "" {
+			return &PoolMatch{Pool: pool, Reason: PoolMatchPayoutAddress, Match: address, OutputIndex: i}, true
+		}
+	}
+
+	scriptSig := coinbase.Inputs[0].ScriptSig
+	var match *PoolMatch
+	for i := range pl.Pools {
+		for _, tag := range pl.Pools[i].Tags {
+			if tag != "" && (match == nil || len(tag) > len(match.Match)) && bytes.Contains(scriptSig, []byte(tag)) {
+				match = &PoolMatch{Pool: &pl.Pools[i], Reason: PoolMatchCoinbaseTag, Match: tag, OutputIndex: -1}
+			}
+		}
+	}
+	return match, match != nil
+}
+
+// MiningPool returns the mining pool of the block as identified by the pool
+// list. False is returned if no pool matches.
+func (b *Block) MiningPool(pools *PoolList) (*PoolMatch, bool) {
+	coinbase, ok := b.Coinbase()
+	if !ok {
+		return nil, false
+	}
+	return pools.Identify(coinbase)
+}
@@ -0,0 +1,119 @@
+package rawtx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// the zero P2WPKH program paid to by testCoinbase
+const testPayoutAddress = "bc1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq9e75rs"
+
+const testPoolsV2 = `[
+	{"id": 1, "name": "Example Pool", "link": "https://example.com", "addresses": [], "tags": ["/Example Pool/"]},
+	{"id": 2, "name": "Payout Pool", "addresses": ["` + testPayoutAddress + `"], "tags": ["/Payout/"]},
+	{"id": 3, "name": "Satoshi", "tags": ["Chancellor"]}
+]`
+
+const testPoolsLegacy = `{
+	"coinbase_tags": {
+		"/Example Pool/": {"name": "Example Pool", "link": "https://example.com"},
+		"Chancellor": {"name": "Satoshi", "link": ""},
+		"brink": {"name": "Satoshi", "link": ""}
+	},
+	"payout_addresses": {}
+}`
+
+func TestMiningPool(t *testing.T) {
+	pools, err := LoadPoolList(strings.NewReader(testPoolsV2), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the payout address takes precedence over the tag of another pool
+	tx := testCoinbase(t, 700000)
+	match, ok := pools.Identify(&tx)
+	if !ok || match.Pool.Name != "Payout Pool" || match.Reason != PoolMatchPayoutAddress || match.Match != testPayoutAddress || match.OutputIndex != 0 {
+		t.Errorf("Expected a payout address match of the Payout Pool, but got %+v", match)
+	}
+
+	tx.Outputs[0] = *NewOutput(tx.Outputs[0].Value, append([]byte{0x00, 0x14}, bytes.Repeat([]byte{0x01}, 20)...))
+	match, ok = pools.Identify(&tx)
+	if !ok || match.Pool.Name != "Example Pool" || match.Reason != PoolMatchCoinbaseTag || match.Match != "/Example Pool/" || match.OutputIndex != -1 {
+		t.Errorf("Expected a coinbase tag match of the Example Pool, but got %+v", match)
+	}
+	if match.Reason.String() != "coinbase tag" || PoolMatchPayoutAddress.String() != "payout address" {
+		t.Errorf("Expected the match reasons as string, but got %s and %s", match.Reason, PoolMatchPayoutAddress)
+	}
+
+	// the longest matching tag wins, regardless of the order of the pools
+	prefixPools, err := LoadPoolList(strings.NewReader(`[{"id": 4, "name": "Example", "tags": ["/Example"]}, `+testPoolsV2[1:]), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if match, ok := prefixPools.Identify(&tx); !ok || match.Pool.Name != "Example Pool" || match.Match != "/Example Pool/" {
+		t.Errorf("Expected the longest tag to match, but got %+v", match)
+	}
+
+	tx.Inputs[0].ScriptSig = appendScriptNum(nil, 700000)
+	if match, ok := pools.Identify(&tx); ok {
+		t.Errorf("Expected no match for an unknown pool, but got %+v", match)
+	}
+
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+	block, err := DeserializeBlock(genesis.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if match, ok := block.MiningPool(pools); !ok || match.Pool.Name != "Satoshi" || match.Pool.ID != 3 {
+		t.Errorf("Expected the genesis block to be attributed to Satoshi, but got %+v", match)
+	}
+	if match, ok := pools.Identify(&block.Transactions[0]); !ok || match.Match != "Chancellor" {
+		t.Errorf("Expected the genesis coinbase to match the tag Chancellor, but got %+v", match)
+	}
+}
+
+func TestLoadPoolListLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rawtx")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "pools.json")
+	if err := ioutil.WriteFile(name, []byte(testPoolsLegacy), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	pools, err := LoadPoolListFile(name, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(pools.Pools) != 2 || pools.Pools[0].Name != "Example Pool" || pools.Pools[0].Link != "https://example.com" {
+		t.Fatalf("Expected the pools grouped by name, but got %+v", pools.Pools)
+	}
+	if tags := pools.Pools[1].Tags; len(tags) != 2 || tags[0] != "Chancellor" || tags[1] != "brink" {
+		t.Errorf("Expected the sorted tags of Satoshi, but got %q", tags)
+	}
+
+	tx := testCoinbase(t, 700000)
+	if match, ok := pools.Identify(&tx); !ok || match.Pool.Name != "Example Pool" {
+		t.Errorf("Expected a match of the Example Pool, but got %+v", match)
+	}
+
+	for _, invalid := range []string{"", "[{]", `{"coinbase_tags": []}`} {
+		if _, err := LoadPoolList(strings.NewReader(invalid), &chaincfg.MainNetParams); err == nil {
+			t.Errorf("Expected an error for the pool list %q", invalid)
+		}
+	}
+	if _, err := LoadPoolListFile(filepath.Join(dir, "missing.json"), &chaincfg.MainNetParams); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
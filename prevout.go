@@ -0,0 +1,58 @@
+package rawtx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrPrevoutNotFound is returned by a PrevoutFetcher if the output spent by an
+// outpoint is unknown.
+var ErrPrevoutNotFound = errors.New("prevout not found")
+
+// PrevoutFetcher looks up the outputs spent by transaction inputs, for example
+// from a node, a block explorer or a UTXO set.
+type PrevoutFetcher interface {
+	// FetchPrevout returns the output created at the outpoint or
+	// ErrPrevoutNotFound if the output is unknown.
+	FetchPrevout(ctx context.Context, outpoint Outpoint) (*Output, error)
+}
+
+// PrevoutMap is a PrevoutFetcher backed by a map.
+type PrevoutMap map[Outpoint]*Output
+
+// FetchPrevout returns the output at the outpoint from the map.
+func (m PrevoutMap) FetchPrevout(ctx context.Context, outpoint Outpoint) (*Output, error) {
+	if out, ok := m[outpoint]; ok {
+		return out, nil
+	}
+	return nil, ErrPrevoutNotFound
+}
+
+// AddTx adds the outputs of the transaction to the map.
+func (m PrevoutMap) AddTx(tx *Tx) {
+	for i := range tx.Outputs {
+		m[Outpoint{PrevTxHash: tx.Hash, OutputIndex: uint32(i)}] = &tx.Outputs[i]
+	}
+}
+
+// FetchPrevouts sets the Prevout of all inputs with an unknown prevout using
+// the fetcher. The inputs of a coinbase transaction don't spend outputs and
+// are skipped.
+func (tx *Tx) FetchPrevouts(ctx context.Context, fetcher PrevoutFetcher) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	for i := range tx.Inputs {
+		in := &tx.Inputs[i]
+		if in.Prevout != nil {
+			continue
+		}
+		prevout, err := fetcher.FetchPrevout(ctx, in.Outpoint)
+		if err != nil {
+			return fmt.Errorf("input %d spending %s:%d: %w", i, in.Outpoint.PrevTxHash, in.Outpoint.OutputIndex, err)
+		}
+		in.Prevout = prevout
+	}
+	return nil
+}
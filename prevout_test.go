@@ -0,0 +1,59 @@
+package rawtx
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFetchPrevouts(t *testing.T) {
+	ctx := context.Background()
+	for _, testTx := range GetTestTransactions() {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		prevouts := make(PrevoutMap)
+		if err := tx.FetchPrevouts(ctx, prevouts); !tx.IsCoinbase() && !errors.Is(err, ErrPrevoutNotFound) {
+			t.Errorf("Expected ErrPrevoutNotFound for an empty PrevoutMap, but got %v for testTx: %+v", err, testTx)
+		}
+
+		for i, in := range tx.Inputs {
+			prevouts[in.Outpoint] = NewOutput(int64(1000+i), BitcoinScript{byte(OpTRUE)})
+		}
+		if err := tx.FetchPrevouts(ctx, prevouts); err != nil {
+			t.Fatal(err.Error())
+		}
+		if tx.IsCoinbase() {
+			if tx.HasAllPrevouts() {
+				t.Errorf("Expected no prevouts for a coinbase transaction, but got them for testTx: %+v", testTx)
+			}
+			continue
+		}
+		for i, in := range tx.Inputs {
+			if in.Prevout == nil || in.Prevout.Value != int64(1000+i) {
+				t.Errorf("Expected the prevout of input %d to be set, but got %+v for testTx: %+v", i, in.Prevout, testTx)
+			}
+		}
+	}
+}
+
+func TestPrevoutMapAddTx(t *testing.T) {
+	tx, err := StringToTx(GetTestTransactions()[0].RawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	prevouts := make(PrevoutMap)
+	prevouts.AddTx(&tx)
+
+	for i := range tx.Outputs {
+		out, err := prevouts.FetchPrevout(context.Background(), Outpoint{PrevTxHash: tx.Hash, OutputIndex: uint32(i)})
+		if err != nil || out != &tx.Outputs[i] {
+			t.Errorf("Expected the output %d, but got %+v (%v)", i, out, err)
+		}
+	}
+	if _, err := prevouts.FetchPrevout(context.Background(), Outpoint{PrevTxHash: tx.Hash, OutputIndex: uint32(len(tx.Outputs))}); err != ErrPrevoutNotFound {
+		t.Errorf("Expected ErrPrevoutNotFound, but got %v", err)
+	}
+}
@@ -0,0 +1,842 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// psbtMagic are the magic bytes every PSBT starts with: "psbt" followed by 0xff.
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// PSBT global key types as defined in BIP174 and BIP370.
+const (
+	psbtGlobalUnsignedTx       = 0x00
+	psbtGlobalXPub             = 0x01
+	psbtGlobalTxVersion        = 0x02
+	psbtGlobalFallbackLocktime = 0x03
+	psbtGlobalInputCount       = 0x04
+	psbtGlobalOutputCount      = 0x05
+	psbtGlobalTxModifiable     = 0x06
+	psbtGlobalVersion          = 0xfb
+)
+
+// PSBT input key types as defined in BIP174, BIP370 and BIP371.
+const (
+	psbtInNonWitnessUtxo          = 0x00
+	psbtInWitnessUtxo             = 0x01
+	psbtInPartialSig              = 0x02
+	psbtInSighashType             = 0x03
+	psbtInRedeemScript            = 0x04
+	psbtInWitnessScript           = 0x05
+	psbtInBIP32Derivation         = 0x06
+	psbtInFinalScriptSig          = 0x07
+	psbtInFinalScriptWitness      = 0x08
+	psbtInPreviousTxID            = 0x0e
+	psbtInOutputIndex             = 0x0f
+	psbtInSequence                = 0x10
+	psbtInRequiredTimeLocktime    = 0x11
+	psbtInRequiredHeightLocktime  = 0x12
+	psbtInTaprootKeySig           = 0x13
+	psbtInTaprootScriptSig        = 0x14
+	psbtInTaprootLeafScript       = 0x15
+	psbtInTaprootBIP32Derivation  = 0x16
+	psbtInTaprootInternalKey      = 0x17
+	psbtInTaprootMerkleRoot       = 0x18
+	psbtOutRedeemScript           = 0x00
+	psbtOutWitnessScript          = 0x01
+	psbtOutBIP32Derivation        = 0x02
+	psbtOutAmount                 = 0x03
+	psbtOutScript                 = 0x04
+	psbtOutTaprootInternalKey     = 0x05
+	psbtOutTaprootTree            = 0x06
+	psbtOutTaprootBIP32Derivation = 0x07
+)
+
+// ErrInvalidPSBTMagic is returned when the PSBT does not start with the
+// magic bytes "psbt" 0xff.
+var ErrInvalidPSBTMagic = errors.New("invalid PSBT magic bytes")
+
+// PSBT represents a partially signed bitcoin transaction (BIP174 version 0 or
+// BIP370 version 2) as a struct. Tx is the transaction described by the PSBT.
+// Inputs which are finalized have their final scriptSig and witness set in
+// Tx, and all inputs with a known UTXO have their Prevout set.
+type PSBT struct {
+	Version         uint32
+	Tx              Tx
+	XPubs           []PSBTXPub
+	TxModifiable    byte
+	Inputs          []PSBTInput
+	Outputs         []PSBTOutput
+	UnknownGlobals  []PSBTKeyValue
+	hasTxModifiable bool
+}
+
+// PSBTKeyValue is a raw PSBT key-value pair which is not decoded into a field.
+// The Key includes the key type.
+type PSBTKeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// PSBTXPub is a global extended public key together with its derivation.
+type PSBTXPub struct {
+	XPub        []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// BIP32Derivation maps a public key to the fingerprint of the master key and
+// the derivation path used to derive it.
+type BIP32Derivation struct {
+	PubKey      []byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// TaprootBIP32Derivation maps a x-only public key to the leaf hashes it is
+// used in and its BIP32 derivation.
+type TaprootBIP32Derivation struct {
+	XOnlyPubKey []byte
+	LeafHashes  [][]byte
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// PartialSig is a signature for a public key.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// TaprootScriptSig is a schnorr signature for a x-only public key in the leaf
+// with the leaf hash LeafHash.
+type TaprootScriptSig struct {
+	XOnlyPubKey []byte
+	LeafHash    []byte
+	Signature   []byte
+}
+
+// TaprootLeafScript is a tapscript with its leaf version and the control block
+// needed to spend it.
+type TaprootLeafScript struct {
+	ControlBlock []byte
+	Script       BitcoinScript
+	LeafVersion  byte
+}
+
+// TaprootTreeLeaf is a leaf of a taproot tree in a PSBT output.
+type TaprootTreeLeaf struct {
+	Depth       byte
+	LeafVersion byte
+	Script      BitcoinScript
+}
+
+// PSBTInput represents the per-input fields of a PSBT.
+type PSBTInput struct {
+	NonWitnessUtxo          *Tx
+	WitnessUtxo             *Output
+	PartialSigs             []PartialSig
+	SighashType             uint32
+	RedeemScript            BitcoinScript
+	WitnessScript           BitcoinScript
+	BIP32Derivations        []BIP32Derivation
+	FinalScriptSig          BitcoinScript
+	FinalScriptWitness      [][]byte
+	RequiredTimeLocktime    uint32
+	RequiredHeightLocktime  uint32
+	TaprootKeySig           []byte
+	TaprootScriptSigs       []TaprootScriptSig
+	TaprootLeafScripts      []TaprootLeafScript
+	TaprootBIP32Derivations []TaprootBIP32Derivation
+	TaprootInternalKey      []byte
+	TaprootMerkleRoot       []byte
+	Unknowns                []PSBTKeyValue
+
+	hasSighashType bool
+	hasFinal       bool
+	// PSBTv2 fields describing the transaction input
+	previousTxID *chainhash.Hash
+	outputIndex  *uint32
+	sequence     *uint32
+}
+
+// PSBTOutput represents the per-output fields of a PSBT.
+type PSBTOutput struct {
+	RedeemScript            BitcoinScript
+	WitnessScript           BitcoinScript
+	BIP32Derivations        []BIP32Derivation
+	TaprootInternalKey      []byte
+	TaprootTree             []TaprootTreeLeaf
+	TaprootBIP32Derivations []TaprootBIP32Derivation
+	Unknowns                []PSBTKeyValue
+
+	// PSBTv2 fields describing the transaction output
+	amount *int64
+	script BitcoinScript
+}
+
+// HasSighashType returns a boolean indicating if the input specifies a sighash type.
+func (in *PSBTInput) HasSighashType() bool {
+	return in.hasSighashType
+}
+
+// IsFinalized returns a boolean indicating if the input has a final scriptSig
+// or a final witness.
+func (in *PSBTInput) IsFinalized() bool {
+	return in.hasFinal
+}
+
+// Prevout returns the output spent by the input. The witness UTXO is preferred
+// over the non-witness UTXO. The outpoint is needed to pick the spent output
+// from the non-witness UTXO. False is returned if the prevout is unknown.
+func (in *PSBTInput) Prevout(outpoint Outpoint) (*Output, bool) {
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, true
+	}
+	if in.NonWitnessUtxo != nil {
+		if in.NonWitnessUtxo.Hash != outpoint.PrevTxHash {
+			return nil, false
+		}
+		if int(outpoint.OutputIndex) < len(in.NonWitnessUtxo.Outputs) {
+			return &in.NonWitnessUtxo.Outputs[outpoint.OutputIndex], true
+		}
+	}
+	return nil, false
+}
+
+// IsModifiable returns the PSBT_GLOBAL_TX_MODIFIABLE flags of a PSBTv2 and a
+// boolean indicating if the field was present.
+func (p *PSBT) IsModifiable() (flags byte, ok bool) {
+	return p.TxModifiable, p.hasTxModifiable
+}
+
+// StringToPSBT decodes a PSBT from a base64 string or, if it starts with the
+// hex encoded magic bytes, from a hex string.
+func StringToPSBT(s string) (*PSBT, error) {
+	s = strings.TrimSpace(s)
+	var raw []byte
+	var err error
+	if strings.HasPrefix(s, hex.EncodeToString(psbtMagic)) {
+		raw, err = hex.DecodeString(s)
+	} else {
+		raw, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DeserializePSBT(raw)
+}
+
+// DeserializePSBT decodes a serialized PSBT. Both PSBTv0 (BIP174) and PSBTv2
+// (BIP370) are supported.
+func DeserializePSBT(raw []byte) (*PSBT, error) {
+	if !bytes.HasPrefix(raw, psbtMagic) {
+		return nil, ErrInvalidPSBTMagic
+	}
+	r := &psbtReader{buf: raw, pos: len(psbtMagic)}
+	p := &PSBT{}
+
+	var unsignedTx *wire.MsgTx
+	var txVersion, fallbackLocktime *uint32
+	var inputCount, outputCount *uint64
+	err := r.readMap(func(keyType uint64, keyData []byte, key []byte, value []byte) (err error) {
+		switch keyType {
+		case psbtGlobalUnsignedTx:
+			if err = expectEmptyKey(keyData, "unsigned tx"); err != nil {
+				return
+			}
+			unsignedTx = wire.NewMsgTx(1)
+			// The unsigned transaction has empty scriptSigs and witnesses and
+			// must be deserialized in the non-witness format.
+			err = unsignedTx.DeserializeNoWitness(bytes.NewReader(value))
+		case psbtGlobalXPub:
+			if len(keyData) != 78 {
+				return fmt.Errorf("invalid PSBT xpub length %d", len(keyData))
+			}
+			var xpub PSBTXPub
+			xpub.XPub = keyData
+			xpub.Fingerprint, xpub.Path, err = decodeKeyOrigin(value)
+			p.XPubs = append(p.XPubs, xpub)
+		case psbtGlobalTxVersion:
+			txVersion, err = decodeUint32Value(keyData, value, "tx version")
+		case psbtGlobalFallbackLocktime:
+			fallbackLocktime, err = decodeUint32Value(keyData, value, "fallback locktime")
+		case psbtGlobalInputCount:
+			inputCount, err = decodeCompactSizeValue(keyData, value, "input count")
+		case psbtGlobalOutputCount:
+			outputCount, err = decodeCompactSizeValue(keyData, value, "output count")
+		case psbtGlobalTxModifiable:
+			if err = expectEmptyKey(keyData, "tx modifiable"); err != nil {
+				return
+			}
+			if len(value) != 1 {
+				return fmt.Errorf("invalid PSBT tx modifiable length %d", len(value))
+			}
+			p.TxModifiable = value[0]
+			p.hasTxModifiable = true
+		case psbtGlobalVersion:
+			var version *uint32
+			version, err = decodeUint32Value(keyData, value, "version")
+			if err == nil {
+				p.Version = *version
+			}
+		default:
+			p.UnknownGlobals = append(p.UnknownGlobals, PSBTKeyValue{Key: key, Value: value})
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var numInputs, numOutputs int
+	switch p.Version {
+	case 0:
+		if unsignedTx == nil {
+			return nil, errors.New("PSBTv0 is missing the unsigned transaction")
+		}
+		if txVersion != nil || fallbackLocktime != nil || inputCount != nil || outputCount != nil || p.hasTxModifiable {
+			return nil, errors.New("PSBTv0 must not contain PSBTv2 global fields")
+		}
+		for _, txIn := range unsignedTx.TxIn {
+			if len(txIn.SignatureScript) > 0 || len(txIn.Witness) > 0 {
+				return nil, errors.New("PSBTv0 unsigned transaction has a non-empty scriptSig or witness")
+			}
+		}
+		numInputs, numOutputs = len(unsignedTx.TxIn), len(unsignedTx.TxOut)
+	case 2:
+		if unsignedTx != nil {
+			return nil, errors.New("PSBTv2 must not contain an unsigned transaction")
+		}
+		if txVersion == nil || inputCount == nil || outputCount == nil {
+			return nil, errors.New("PSBTv2 is missing the tx version, input count or output count")
+		}
+		// each input and output map ends with at least a separator byte
+		if *inputCount > math.MaxInt32 || *outputCount > math.MaxInt32 {
+			return nil, fmt.Errorf("PSBTv2 input count %d or output count %d is out of range", *inputCount, *outputCount)
+		}
+		if *inputCount+*outputCount > uint64(len(r.buf)-r.pos) {
+			return nil, fmt.Errorf("PSBTv2 input count %d and output count %d exceed the remaining data", *inputCount, *outputCount)
+		}
+		numInputs, numOutputs = int(*inputCount), int(*outputCount)
+	default:
+		return nil, fmt.Errorf("unsupported PSBT version %d", p.Version)
+	}
+
+	p.Inputs = make([]PSBTInput, numInputs)
+	for i := range p.Inputs {
+		if err := r.readInput(&p.Inputs[i], p.Version); err != nil {
+			return nil, fmt.Errorf("PSBT input %d: %s", i, err)
+		}
+	}
+	p.Outputs = make([]PSBTOutput, numOutputs)
+	for i := range p.Outputs {
+		if err := r.readOutput(&p.Outputs[i], p.Version); err != nil {
+			return nil, fmt.Errorf("PSBT output %d: %s", i, err)
+		}
+	}
+	if r.pos != len(r.buf) {
+		return nil, fmt.Errorf("%d unexpected trailing bytes after PSBT", len(r.buf)-r.pos)
+	}
+
+	if p.Version == 2 {
+		unsignedTx, err = p.buildV2Tx(*txVersion, fallbackLocktime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// fill in the final scriptSigs and witnesses so the transaction can be
+	// classified like a network transaction
+	for i, in := range p.Inputs {
+		unsignedTx.TxIn[i].SignatureScript = in.FinalScriptSig
+		unsignedTx.TxIn[i].Witness = in.FinalScriptWitness
+	}
+	p.Tx.FromWireMsgTx(unsignedTx)
+
+	for i := range p.Tx.Inputs {
+		if prevout, ok := p.Inputs[i].Prevout(p.Tx.Inputs[i].Outpoint); ok {
+			p.Tx.Inputs[i].Prevout = prevout
+		}
+	}
+	return p, nil
+}
+
+// buildV2Tx constructs the transaction described by the fields of a PSBTv2.
+func (p *PSBT) buildV2Tx(version uint32, fallbackLocktime *uint32) (*wire.MsgTx, error) {
+	wireTx := wire.NewMsgTx(int32(version))
+	for i, in := range p.Inputs {
+		if in.previousTxID == nil || in.outputIndex == nil {
+			return nil, fmt.Errorf("PSBTv2 input %d is missing the previous txid or output index", i)
+		}
+		txIn := wire.NewTxIn(wire.NewOutPoint(in.previousTxID, *in.outputIndex), nil, nil)
+		if in.sequence != nil {
+			txIn.Sequence = *in.sequence
+		}
+		wireTx.AddTxIn(txIn)
+	}
+	for i, out := range p.Outputs {
+		if out.amount == nil || out.script == nil {
+			return nil, fmt.Errorf("PSBTv2 output %d is missing the amount or script", i)
+		}
+		wireTx.AddTxOut(wire.NewTxOut(*out.amount, out.script))
+	}
+
+	locktime, err := p.determineLocktime(fallbackLocktime)
+	if err != nil {
+		return nil, err
+	}
+	wireTx.LockTime = locktime
+	return wireTx, nil
+}
+
+// determineLocktime implements the BIP370 locktime determination algorithm.
+func (p *PSBT) determineLocktime(fallbackLocktime *uint32) (uint32, error) {
+	var hasRequirement, heightPossible, timePossible = false, true, true
+	var maxHeight, maxTime uint32
+	for _, in := range p.Inputs {
+		hasTime, hasHeight := in.RequiredTimeLocktime != 0, in.RequiredHeightLocktime != 0
+		if !hasTime && !hasHeight {
+			continue
+		}
+		hasRequirement = true
+		if !hasHeight {
+			heightPossible = false
+		}
+		if !hasTime {
+			timePossible = false
+		}
+		if in.RequiredHeightLocktime > maxHeight {
+			maxHeight = in.RequiredHeightLocktime
+		}
+		if in.RequiredTimeLocktime > maxTime {
+			maxTime = in.RequiredTimeLocktime
+		}
+	}
+
+	switch {
+	case !hasRequirement:
+		if fallbackLocktime != nil {
+			return *fallbackLocktime, nil
+		}
+		return 0, nil
+	case heightPossible:
+		return maxHeight, nil
+	case timePossible:
+		return maxTime, nil
+	}
+	return 0, errors.New("PSBTv2 inputs require incompatible height and time locktimes")
+}
+
+// psbtReader reads key-value maps from a serialized PSBT.
+type psbtReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *psbtReader) readCompactSize() (uint64, error) {
+	value, n, err := readCompactSize(r.buf[r.pos:])
+	if err != nil {
+		return 0, err
+	}
+	r.pos += n
+	return value, nil
+}
+
+func (r *psbtReader) readBytes(length uint64) ([]byte, error) {
+	if length > uint64(len(r.buf)-r.pos) {
+		return nil, errors.New("unexpected end of PSBT")
+	}
+	b := r.buf[r.pos : r.pos+int(length)]
+	r.pos += int(length)
+	return b, nil
+}
+
+// readMap reads a key-value map until the 0x00 separator and calls fn for every
+// pair. Duplicate keys are rejected.
+func (r *psbtReader) readMap(fn func(keyType uint64, keyData []byte, key []byte, value []byte) error) error {
+	seen := make(map[string]bool)
+	for {
+		keyLength, err := r.readCompactSize()
+		if err != nil {
+			return err
+		}
+		if keyLength == 0 {
+			return nil
+		}
+		key, err := r.readBytes(keyLength)
+		if err != nil {
+			return err
+		}
+		valueLength, err := r.readCompactSize()
+		if err != nil {
+			return err
+		}
+		value, err := r.readBytes(valueLength)
+		if err != nil {
+			return err
+		}
+
+		if seen[string(key)] {
+			return fmt.Errorf("duplicate PSBT key %x", key)
+		}
+		seen[string(key)] = true
+
+		keyType, n, err := readCompactSize(key)
+		if err != nil {
+			return err
+		}
+		if err := fn(keyType, key[n:], key, value); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *psbtReader) readInput(in *PSBTInput, version uint32) error {
+	return r.readMap(func(keyType uint64, keyData []byte, key []byte, value []byte) (err error) {
+		if keyType >= psbtInPreviousTxID && keyType <= psbtInRequiredHeightLocktime && version == 0 {
+			// PSBTv2 fields always have an empty key. Keys with key data are
+			// unknown to PSBTv0.
+			if len(keyData) == 0 {
+				return fmt.Errorf("PSBTv0 must not contain PSBTv2 input field %d", keyType)
+			}
+			in.Unknowns = append(in.Unknowns, PSBTKeyValue{Key: key, Value: value})
+			return
+		}
+
+		switch keyType {
+		case psbtInNonWitnessUtxo:
+			if err = expectEmptyKey(keyData, "non-witness utxo"); err != nil {
+				return
+			}
+			var tx Tx
+			tx, err = DeserializeRawTxBytes(value)
+			in.NonWitnessUtxo = &tx
+		case psbtInWitnessUtxo:
+			if err = expectEmptyKey(keyData, "witness utxo"); err != nil {
+				return
+			}
+			in.WitnessUtxo, err = decodePSBTOutput(value)
+		case psbtInPartialSig:
+			if err = expectPubKey(keyData, "partial signature"); err != nil {
+				return
+			}
+			in.PartialSigs = append(in.PartialSigs, PartialSig{PubKey: keyData, Signature: value})
+		case psbtInSighashType:
+			var sighash *uint32
+			sighash, err = decodeUint32Value(keyData, value, "sighash type")
+			if err == nil {
+				in.SighashType = *sighash
+				in.hasSighashType = true
+			}
+		case psbtInRedeemScript:
+			err = expectEmptyKey(keyData, "redeem script")
+			in.RedeemScript = value
+		case psbtInWitnessScript:
+			err = expectEmptyKey(keyData, "witness script")
+			in.WitnessScript = value
+		case psbtInBIP32Derivation:
+			if err = expectPubKey(keyData, "BIP32 derivation"); err != nil {
+				return
+			}
+			d := BIP32Derivation{PubKey: keyData}
+			d.Fingerprint, d.Path, err = decodeKeyOrigin(value)
+			in.BIP32Derivations = append(in.BIP32Derivations, d)
+		case psbtInFinalScriptSig:
+			err = expectEmptyKey(keyData, "final scriptSig")
+			in.FinalScriptSig = value
+			in.hasFinal = true
+		case psbtInFinalScriptWitness:
+			if err = expectEmptyKey(keyData, "final witness"); err != nil {
+				return
+			}
+			in.FinalScriptWitness, err = decodeWitnessStack(value)
+			in.hasFinal = true
+		case psbtInPreviousTxID:
+			if err = expectEmptyKey(keyData, "previous txid"); err != nil {
+				return
+			}
+			in.previousTxID, err = chainhash.NewHash(value)
+		case psbtInOutputIndex:
+			in.outputIndex, err = decodeUint32Value(keyData, value, "output index")
+		case psbtInSequence:
+			in.sequence, err = decodeUint32Value(keyData, value, "sequence")
+		case psbtInRequiredTimeLocktime:
+			var locktime *uint32
+			if locktime, err = decodeUint32Value(keyData, value, "required time locktime"); err != nil {
+				return
+			}
+			if *locktime < 500000000 {
+				return fmt.Errorf("invalid required time locktime %d", *locktime)
+			}
+			in.RequiredTimeLocktime = *locktime
+		case psbtInRequiredHeightLocktime:
+			var locktime *uint32
+			if locktime, err = decodeUint32Value(keyData, value, "required height locktime"); err != nil {
+				return
+			}
+			if *locktime == 0 || *locktime >= 500000000 {
+				return fmt.Errorf("invalid required height locktime %d", *locktime)
+			}
+			in.RequiredHeightLocktime = *locktime
+		case psbtInTaprootKeySig:
+			if err = expectEmptyKey(keyData, "taproot key signature"); err != nil {
+				return
+			}
+			if len(value) != 64 && len(value) != 65 {
+				return fmt.Errorf("invalid taproot key signature length %d", len(value))
+			}
+			in.TaprootKeySig = value
+		case psbtInTaprootScriptSig:
+			if len(keyData) != 64 {
+				return fmt.Errorf("invalid taproot script signature key length %d", len(keyData))
+			}
+			if len(value) != 64 && len(value) != 65 {
+				return fmt.Errorf("invalid taproot script signature length %d", len(value))
+			}
+			in.TaprootScriptSigs = append(in.TaprootScriptSigs, TaprootScriptSig{
+				XOnlyPubKey: keyData[:32],
+				LeafHash:    keyData[32:],
+				Signature:   value,
+			})
+		case psbtInTaprootLeafScript:
+			if len(keyData) < 33 || (len(keyData)-1)%32 != 0 {
+				return fmt.Errorf("invalid taproot control block length %d", len(keyData))
+			}
+			if len(value) < 1 {
+				return errors.New("empty taproot leaf script")
+			}
+			in.TaprootLeafScripts = append(in.TaprootLeafScripts, TaprootLeafScript{
+				ControlBlock: keyData,
+				Script:       value[:len(value)-1],
+				LeafVersion:  value[len(value)-1],
+			})
+		case psbtInTaprootBIP32Derivation:
+			var d TaprootBIP32Derivation
+			d, err = decodeTaprootBIP32Derivation(keyData, value)
+			in.TaprootBIP32Derivations = append(in.TaprootBIP32Derivations, d)
+		case psbtInTaprootInternalKey:
+			in.TaprootInternalKey, err = decodeFixedLengthValue(keyData, value, 32, "taproot internal key")
+		case psbtInTaprootMerkleRoot:
+			in.TaprootMerkleRoot, err = decodeFixedLengthValue(keyData, value, 32, "taproot merkle root")
+		default:
+			in.Unknowns = append(in.Unknowns, PSBTKeyValue{Key: key, Value: value})
+		}
+		return
+	})
+}
+
+func (r *psbtReader) readOutput(out *PSBTOutput, version uint32) error {
+	return r.readMap(func(keyType uint64, keyData []byte, key []byte, value []byte) (err error) {
+		if (keyType == psbtOutAmount || keyType == psbtOutScript) && version == 0 {
+			if len(keyData) == 0 {
+				return fmt.Errorf("PSBTv0 must not contain PSBTv2 output field %d", keyType)
+			}
+			out.Unknowns = append(out.Unknowns, PSBTKeyValue{Key: key, Value: value})
+			return
+		}
+
+		switch keyType {
+		case psbtOutRedeemScript:
+			err = expectEmptyKey(keyData, "redeem script")
+			out.RedeemScript = value
+		case psbtOutWitnessScript:
+			err = expectEmptyKey(keyData, "witness script")
+			out.WitnessScript = value
+		case psbtOutBIP32Derivation:
+			if err = expectPubKey(keyData, "BIP32 derivation"); err != nil {
+				return
+			}
+			d := BIP32Derivation{PubKey: keyData}
+			d.Fingerprint, d.Path, err = decodeKeyOrigin(value)
+			out.BIP32Derivations = append(out.BIP32Derivations, d)
+		case psbtOutAmount:
+			if err = expectEmptyKey(keyData, "amount"); err != nil {
+				return
+			}
+			if len(value) != 8 {
+				return fmt.Errorf("invalid amount length %d", len(value))
+			}
+			amount := int64(binary.LittleEndian.Uint64(value))
+			out.amount = &amount
+		case psbtOutScript:
+			err = expectEmptyKey(keyData, "script")
+			out.script = value
+		case psbtOutTaprootInternalKey:
+			out.TaprootInternalKey, err = decodeFixedLengthValue(keyData, value, 32, "taproot internal key")
+		case psbtOutTaprootTree:
+			if err = expectEmptyKey(keyData, "taproot tree"); err != nil {
+				return
+			}
+			out.TaprootTree, err = decodeTaprootTree(value)
+		case psbtOutTaprootBIP32Derivation:
+			var d TaprootBIP32Derivation
+			d, err = decodeTaprootBIP32Derivation(keyData, value)
+			out.TaprootBIP32Derivations = append(out.TaprootBIP32Derivations, d)
+		default:
+			out.Unknowns = append(out.Unknowns, PSBTKeyValue{Key: key, Value: value})
+		}
+		return
+	})
+}
+
+func expectEmptyKey(keyData []byte, name string) error {
+	if len(keyData) != 0 {
+		return fmt.Errorf("unexpected key data for PSBT %s", name)
+	}
+	return nil
+}
+
+// expectPubKey checks that the key data is a compressed or uncompressed public key.
+func expectPubKey(keyData []byte, name string) error {
+	if len(keyData) == 33 && (keyData[0] == 0x02 || keyData[0] == 0x03) {
+		return nil
+	}
+	if len(keyData) == 65 && keyData[0] == 0x04 {
+		return nil
+	}
+	return fmt.Errorf("invalid public key in PSBT %s key", name)
+}
+
+func decodeUint32Value(keyData []byte, value []byte, name string) (*uint32, error) {
+	if err := expectEmptyKey(keyData, name); err != nil {
+		return nil, err
+	}
+	if len(value) != 4 {
+		return nil, fmt.Errorf("invalid PSBT %s length %d", name, len(value))
+	}
+	v := binary.LittleEndian.Uint32(value)
+	return &v, nil
+}
+
+func decodeCompactSizeValue(keyData []byte, value []byte, name string) (*uint64, error) {
+	if err := expectEmptyKey(keyData, name); err != nil {
+		return nil, err
+	}
+	v, n, err := readCompactSize(value)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(value) {
+		return nil, fmt.Errorf("invalid PSBT %s", name)
+	}
+	return &v, nil
+}
+
+func decodeFixedLengthValue(keyData []byte, value []byte, length int, name string) ([]byte, error) {
+	if err := expectEmptyKey(keyData, name); err != nil {
+		return nil, err
+	}
+	if len(value) != length {
+		return nil, fmt.Errorf("invalid PSBT %s length %d", name, len(value))
+	}
+	return value, nil
+}
+
+// decodePSBTOutput decodes a serialized transaction output (8 byte value and
+// length prefixed scriptPubKey).
+func decodePSBTOutput(value []byte) (*Output, error) {
+	if len(value) < 9 {
+		return nil, errors.New("PSBT witness utxo too short")
+	}
+	scriptLength, n, err := readCompactSize(value[8:])
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(value)-8-n) != scriptLength {
+		return nil, errors.New("invalid PSBT witness utxo script length")
+	}
+	out := &Output{}
+	out.FromWireTxOut(wire.NewTxOut(int64(binary.LittleEndian.Uint64(value[:8])), value[8+n:]))
+	return out, nil
+}
+
+// decodeKeyOrigin decodes a 4 byte master key fingerprint followed by the
+// uint32 derivation path elements.
+func decodeKeyOrigin(value []byte) (fingerprint uint32, path []uint32, err error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return 0, nil, fmt.Errorf("invalid PSBT key origin length %d", len(value))
+	}
+	fingerprint = binary.BigEndian.Uint32(value[:4])
+	for i := 4; i < len(value); i += 4 {
+		path = append(path, binary.LittleEndian.Uint32(value[i:i+4]))
+	}
+	return fingerprint, path, nil
+}
+
+func decodeTaprootBIP32Derivation(keyData []byte, value []byte) (d TaprootBIP32Derivation, err error) {
+	if len(keyData) != 32 {
+		return d, fmt.Errorf("invalid taproot BIP32 derivation key length %d", len(keyData))
+	}
+	d.XOnlyPubKey = keyData
+	numHashes, n, err := readCompactSize(value)
+	if err != nil {
+		return d, err
+	}
+	value = value[n:]
+	if numHashes > uint64(len(value)/32) {
+		return d, errors.New("invalid taproot BIP32 derivation leaf hashes")
+	}
+	for i := uint64(0); i < numHashes; i++ {
+		d.LeafHashes = append(d.LeafHashes, value[:32])
+		value = value[32:]
+	}
+	d.Fingerprint, d.Path, err = decodeKeyOrigin(value)
+	return d, err
+}
+
+func decodeTaprootTree(value []byte) (leaves []TaprootTreeLeaf, err error) {
+	for len(value) > 0 {
+		if len(value) < 3 {
+			return nil, errors.New("invalid taproot tree")
+		}
+		leaf := TaprootTreeLeaf{Depth: value[0], LeafVersion: value[1]}
+		scriptLength, n, err := readCompactSize(value[2:])
+		if err != nil {
+			return nil, err
+		}
+		value = value[2+n:]
+		if scriptLength > uint64(len(value)) {
+			return nil, errors.New("invalid taproot tree script length")
+		}
+		leaf.Script = value[:scriptLength]
+		value = value[scriptLength:]
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+// decodeWitnessStack decodes a serialized witness stack as used for the final
+// scriptWitness.
+func decodeWitnessStack(value []byte) (witness [][]byte, err error) {
+	numItems, n, err := readCompactSize(value)
+	if err != nil {
+		return nil, err
+	}
+	value = value[n:]
+	for i := uint64(0); i < numItems; i++ {
+		itemLength, n, err := readCompactSize(value)
+		if err != nil {
+			return nil, err
+		}
+		value = value[n:]
+		if itemLength > uint64(len(value)) {
+			return nil, errors.New("invalid witness item length")
+		}
+		witness = append(witness, value[:itemLength])
+		value = value[itemLength:]
+	}
+	if len(value) != 0 {
+		return nil, errors.New("unexpected bytes after witness stack")
+	}
+	return witness, nil
+}
@@ -0,0 +1,308 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+// BIP174 test vector: PSBT with one P2PKH input and a non-witness UTXO.
+const testPSBTv0P2PKHHex = "70736274ff0100750200000001268171371edff285e937adeea4b37b78000c0566cbb3ad64641713ca42171bf60000000000feffffff02d3dff505000000001976a914d0c59903c5bac2868760e90fd521a4665aa7652088ac00e1f5050000000017a9143545e6e33b832c47050f24d3eeb93c9c03948bc787b32e1300000100fda5010100000000010289a3c71eab4d20e0371bbba4cc698fa295c9463afa2e397f8533ccb62f9567e50100000017160014be18d152a9b012039daf3da7de4f53349eecb985ffffffff86f8aa43a71dff1448893a530a7237ef6b4608bbb2dd2d0171e63aec6a4890b40100000017160014fe3e9ef1a745e974d902c4355943abcb34bd5353ffffffff0200c2eb0b000000001976a91485cff1097fd9e008bb34af709c62197b38978a4888ac72fef84e2c00000017a914339725ba21efd62ac753a9bcd067d6c7a6a39d05870247304402202712be22e0270f394f568311dc7ca9a68970b8025fdd3b240229f07f8a5f3a240220018b38d7dcd314e734c9276bd6fb40f673325bc4baa144c800d2f2f02db2765c012103d2e15674941bad4a996372cb87e1856d3652606d98562fe39c5e9e7e413f210502483045022100d12b852d85dcd961d2f5f4ab660654df6eedcc794c0c33ce5cc309ffb5fce58d022067338a8e0e1725c197fb1a88af59f51e44e4255b20167c8684031c05d1f2592a01210223b72beef0965d10be0778efecd61fcac6f79a4ea169393380734464f84f2ab300000000000000"
+
+// testPSBTBuilder serializes PSBT key-value maps for the unit tests.
+type testPSBTBuilder struct {
+	bytes.Buffer
+}
+
+func newTestPSBTBuilder() *testPSBTBuilder {
+	b := &testPSBTBuilder{}
+	b.Write(psbtMagic)
+	return b
+}
+
+func (b *testPSBTBuilder) writeCompactSize(v uint64) {
+	switch {
+	case v < 0xfd:
+		b.WriteByte(byte(v))
+	case v <= 0xffff:
+		b.WriteByte(0xfd)
+		binary.Write(b, binary.LittleEndian, uint16(v))
+	default:
+		b.WriteByte(0xfe)
+		binary.Write(b, binary.LittleEndian, uint32(v))
+	}
+}
+
+func (b *testPSBTBuilder) pair(key []byte, value []byte) {
+	b.writeCompactSize(uint64(len(key)))
+	b.Write(key)
+	b.writeCompactSize(uint64(len(value)))
+	b.Write(value)
+}
+
+func (b *testPSBTBuilder) uint32Pair(keyType byte, v uint32) {
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, v)
+	b.pair([]byte{keyType}, value)
+}
+
+func (b *testPSBTBuilder) separator() {
+	b.WriteByte(0x00)
+}
+
+// buildTestPSBTv2 builds a finalized PSBTv2 for a transaction, which includes
+// a witness UTXO with the passed prevout value for every input.
+func buildTestPSBTv2(tx Tx, prevoutValue int64) []byte {
+	b := newTestPSBTBuilder()
+	b.uint32Pair(psbtGlobalVersion, 2)
+	b.uint32Pair(psbtGlobalTxVersion, uint32(tx.Version))
+	b.uint32Pair(psbtGlobalFallbackLocktime, tx.Locktime)
+	b.pair([]byte{psbtGlobalInputCount}, []byte{byte(len(tx.Inputs))})
+	b.pair([]byte{psbtGlobalOutputCount}, []byte{byte(len(tx.Outputs))})
+	b.separator()
+
+	for _, in := range tx.Inputs {
+		b.pair([]byte{psbtInPreviousTxID}, in.Outpoint.PrevTxHash[:])
+		b.uint32Pair(psbtInOutputIndex, in.Outpoint.OutputIndex)
+		b.uint32Pair(psbtInSequence, in.Sequence)
+
+		witnessUtxo := make([]byte, 8)
+		binary.LittleEndian.PutUint64(witnessUtxo, uint64(prevoutValue))
+		witnessUtxo = append(witnessUtxo, 0x00) // empty scriptPubKey
+		b.pair([]byte{psbtInWitnessUtxo}, witnessUtxo)
+
+		if len(in.ScriptSig) > 0 {
+			b.pair([]byte{psbtInFinalScriptSig}, in.ScriptSig)
+		}
+		if len(in.Witness) > 0 {
+			witness := &testPSBTBuilder{}
+			witness.writeCompactSize(uint64(len(in.Witness)))
+			for _, element := range in.Witness {
+				witness.writeCompactSize(uint64(len(element.PushedData)))
+				witness.Write(element.PushedData)
+			}
+			b.pair([]byte{psbtInFinalScriptWitness}, witness.Bytes())
+		}
+		b.separator()
+	}
+
+	for _, out := range tx.Outputs {
+		amount := make([]byte, 8)
+		binary.LittleEndian.PutUint64(amount, uint64(out.Value))
+		b.pair([]byte{psbtOutAmount}, amount)
+		b.pair([]byte{psbtOutScript}, out.ScriptPubKey)
+		b.separator()
+	}
+	return b.Bytes()
+}
+
+func TestDeserializePSBTv0(t *testing.T) {
+	raw, _ := hex.DecodeString(testPSBTv0P2PKHHex)
+	p, err := DeserializePSBT(raw)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if p.Version != 0 || len(p.Inputs) != 1 || len(p.Outputs) != 2 {
+		t.Errorf("Expected a PSBTv0 with 1 input and 2 outputs, but got version %d with %d inputs and %d outputs", p.Version, len(p.Inputs), len(p.Outputs))
+	}
+
+	if p.Inputs[0].NonWitnessUtxo == nil {
+		t.Fatalf("Expected the input to have a non-witness UTXO")
+	}
+
+	if p.Inputs[0].IsFinalized() {
+		t.Errorf("Expected the input to not be finalized")
+	}
+
+	if p.Tx.Inputs[0].Prevout == nil || p.Tx.Inputs[0].Prevout.GetType() != OutP2PKH {
+		t.Errorf("Expected the prevout of the input to be a P2PKH output, but got %+v", p.Tx.Inputs[0].Prevout)
+	}
+
+	fee, ok := p.Tx.GetFee()
+	if !ok || fee != 301 {
+		t.Errorf("Expected GetFee() to be 301, but got %d (ok=%t)", fee, ok)
+	}
+
+	if p.Tx.Outputs[0].GetType() != OutP2PKH || p.Tx.Outputs[1].GetType() != OutP2SH {
+		t.Errorf("Expected the outputs to be P2PKH and P2SH")
+	}
+}
+
+func TestStringToPSBT(t *testing.T) {
+	raw, _ := hex.DecodeString(testPSBTv0P2PKHHex)
+
+	fromHex, err := StringToPSBT(testPSBTv0P2PKHHex)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fromBase64, err := StringToPSBT(base64.StdEncoding.EncodeToString(raw))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if fromHex.Tx.Hash != fromBase64.Tx.Hash {
+		t.Errorf("Expected the hex and base64 encoded PSBTs to be equal, but got %s and %s", fromHex.Tx.Hash, fromBase64.Tx.Hash)
+	}
+
+	if _, err := StringToPSBT("not a psbt"); err == nil {
+		t.Errorf("Expected an error for an invalid PSBT string")
+	}
+}
+
+func TestDeserializePSBTv2(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		p, err := DeserializePSBT(buildTestPSBTv2(tx, 1000))
+		if err != nil {
+			t.Errorf("Could not deserialize PSBTv2: %s for testTx: %+v", err, testTx)
+			continue
+		}
+
+		if p.Tx.Hash != tx.Hash {
+			t.Errorf("Expected the PSBTv2 txid to be %s, but got %s for testTx: %+v", tx.Hash, p.Tx.Hash, testTx)
+		}
+
+		if p.Tx.GetSizeWithWitness() != testTx.Size {
+			t.Errorf("Expected the PSBTv2 tx size to be %d, but got %d for testTx: %+v", testTx.Size, p.Tx.GetSizeWithWitness(), testTx)
+		}
+
+		for index, in := range p.Tx.Inputs {
+			if in.GetType() != testTx.InputTypes[index] {
+				t.Errorf("Expected input type %s at index %d, but got %s for testTx: %+v", testTx.InputTypes[index], index, in.GetType(), testTx)
+			}
+			if in.Prevout == nil || in.Prevout.Value != 1000 {
+				t.Errorf("Expected the prevout at index %d to be set from the witness UTXO for testTx: %+v", index, testTx)
+			}
+		}
+	}
+}
+
+func TestPSBTv2Locktime(t *testing.T) {
+	build := func(fallback uint32, requirements [][2]uint32) []byte {
+		b := newTestPSBTBuilder()
+		b.uint32Pair(psbtGlobalVersion, 2)
+		b.uint32Pair(psbtGlobalTxVersion, 2)
+		if fallback != 0 {
+			b.uint32Pair(psbtGlobalFallbackLocktime, fallback)
+		}
+		b.pair([]byte{psbtGlobalInputCount}, []byte{byte(len(requirements))})
+		b.pair([]byte{psbtGlobalOutputCount}, []byte{0x00})
+		b.separator()
+		for i, req := range requirements {
+			b.pair([]byte{psbtInPreviousTxID}, bytes.Repeat([]byte{byte(i + 1)}, 32))
+			b.uint32Pair(psbtInOutputIndex, 0)
+			if req[0] != 0 {
+				b.uint32Pair(psbtInRequiredTimeLocktime, req[0])
+			}
+			if req[1] != 0 {
+				b.uint32Pair(psbtInRequiredHeightLocktime, req[1])
+			}
+			b.separator()
+		}
+		return b.Bytes()
+	}
+
+	testCases := []struct {
+		fallback     uint32
+		requirements [][2]uint32
+		expected     uint32
+		fails        bool
+	}{
+		{0, [][2]uint32{{0, 0}}, 0, false},
+		{700000, [][2]uint32{{0, 0}}, 700000, false},
+		{0, [][2]uint32{{0, 10000}, {0, 20000}}, 20000, false},
+		{0, [][2]uint32{{1657048460, 0}, {1657048470, 0}}, 1657048470, false},
+		{0, [][2]uint32{{1657048460, 10000}, {0, 20000}}, 20000, false},
+		{0, [][2]uint32{{1657048460, 10000}, {1657048470, 0}}, 1657048470, false},
+		{0, [][2]uint32{{1657048460, 0}, {0, 20000}}, 0, true},
+	}
+
+	for _, tc := range testCases {
+		p, err := DeserializePSBT(build(tc.fallback, tc.requirements))
+		if tc.fails {
+			if err == nil {
+				t.Errorf("Expected an error for the locktime requirements %v", tc.requirements)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error %s for the locktime requirements %v", err, tc.requirements)
+			continue
+		}
+		if p.Tx.Locktime != tc.expected {
+			t.Errorf("Expected the locktime to be %d, but got %d for the locktime requirements %v", tc.expected, p.Tx.Locktime, tc.requirements)
+		}
+	}
+}
+
+func TestDeserializePSBTInvalid(t *testing.T) {
+	invalid := map[string][]byte{}
+
+	invalid["wrong magic"] = []byte{0x70, 0x73, 0x62, 0x74, 0x00}
+
+	b := newTestPSBTBuilder()
+	b.separator()
+	invalid["PSBTv0 without unsigned tx"] = b.Bytes()
+
+	b = newTestPSBTBuilder()
+	b.uint32Pair(psbtGlobalVersion, 2)
+	b.uint32Pair(psbtGlobalVersion, 2)
+	b.separator()
+	invalid["duplicate key"] = b.Bytes()
+
+	b = newTestPSBTBuilder()
+	b.uint32Pair(psbtGlobalVersion, 2)
+	b.uint32Pair(psbtGlobalTxVersion, 2)
+	b.pair([]byte{psbtGlobalInputCount}, []byte{0x01})
+	b.pair([]byte{psbtGlobalOutputCount}, []byte{0x00})
+	b.separator()
+	b.uint32Pair(psbtInOutputIndex, 0)
+	b.separator()
+	invalid["PSBTv2 input without previous txid"] = b.Bytes()
+
+	b = newTestPSBTBuilder()
+	b.uint32Pair(psbtGlobalVersion, 3)
+	b.separator()
+	invalid["unsupported version"] = b.Bytes()
+
+	oversized := map[string]uint64{
+		"input count above the remaining data": 3,
+		"input count above MaxInt32":           math.MaxInt32 + 1,
+		"input count above MaxInt64":           0x7fffffffffffffff,
+	}
+	for name, count := range oversized {
+		b = newTestPSBTBuilder()
+		b.uint32Pair(psbtGlobalVersion, 2)
+		b.uint32Pair(psbtGlobalTxVersion, 2)
+		b.pair([]byte{psbtGlobalInputCount}, appendCompactSize(nil, count))
+		b.pair([]byte{psbtGlobalOutputCount}, []byte{0x00})
+		b.separator()
+		b.separator()
+		b.separator()
+		invalid[name] = b.Bytes()
+	}
+
+	raw, _ := hex.DecodeString(testPSBTv0P2PKHHex)
+	invalid["trailing bytes"] = append(raw, 0x00)
+	invalid["truncated"] = raw[:len(raw)-5]
+
+	for name, psbt := range invalid {
+		if _, err := DeserializePSBT(psbt); err == nil {
+			t.Errorf("Expected an error for the invalid PSBT: %s", name)
+		}
+	}
+}
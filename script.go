@@ -5,8 +5,12 @@ import (
 	"encoding/hex"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// MaxScriptSize is the maximum size of a script in bytes allowed by the consensus rules.
+const MaxScriptSize = 10000
+
 // BitcoinScript represents a bitcoin script as a byte slice
 // A script can for example be the scriptPubKey or the scriptSig
 type BitcoinScript []byte
@@ -290,3 +294,110 @@ func (s BitcoinScript) IsMultisigScript() (isMultisig bool, numRequiredSigs int,
 
 	return false, 0, 0
 }
+
+// IsPushOnly checks if the BitcoinScript only contains data pushes and small
+// integer pushes (OP_0, OP_1NEGATE and OP_1 to OP_16). A script with a data
+// push past the end of the script is not push-only.
+func (s BitcoinScript) IsPushOnly() bool {
+	for len(s) > 0 {
+		opCode := OpCode(s[0])
+		if opCode > Op16 {
+			return false
+		}
+
+		if opCode.IsDataPushOpCode() {
+			headerLength := 1
+			switch opCode {
+			case OpPUSHDATA1:
+				headerLength = 2
+			case OpPUSHDATA2:
+				headerLength = 3
+			case OpPUSHDATA4:
+				headerLength = 5
+			}
+			if len(s) < headerLength {
+				return false
+			}
+
+			dataPushLength, encodingLength := s.getDataPushLength()
+			if dataPushLength+encodingLength > len(s) {
+				return false
+			}
+			s = s[dataPushLength+encodingLength:]
+			continue
+		}
+		s = s[1:]
+	}
+	return true
+}
+
+// IsWitnessProgram checks if the BitcoinScript is a witness program as defined
+// in BIP141: a version byte (OP_0 or OP_1 to OP_16) followed by a single push
+// of 2 to 40 bytes. The witness version and the witness program are returned.
+func (s BitcoinScript) IsWitnessProgram() (isWitnessProgram bool, version int, program []byte) {
+	if len(s) < 4 || len(s) > 42 {
+		return false, 0, nil
+	}
+
+	versionOpCode := OpCode(s[0])
+	if versionOpCode != Op0 && (versionOpCode < Op1 || versionOpCode > Op16) {
+		return false, 0, nil
+	}
+
+	if int(s[1])+2 != len(s) {
+		return false, 0, nil
+	}
+
+	if versionOpCode != Op0 {
+		version = int(versionOpCode - Op1 + 1)
+	}
+	return true, version, s[2:]
+}
+
+// IsUnspendable checks if the BitcoinScript is provably unspendable. This is
+// the case for scripts starting with OP_RETURN and for scripts larger than the
+// maximum script size of 10000 bytes.
+func (s BitcoinScript) IsUnspendable() bool {
+	return (len(s) > 0 && OpCode(s[0]) == OpRETURN) || len(s) > MaxScriptSize
+}
+
+// IsNullData checks if the BitcoinScript is a OP_RETURN (null data) script in
+// the sense of Bitcoin Core's standardness rules: a OP_RETURN followed by only
+// push operations.
+func (s BitcoinScript) IsNullData() bool {
+	return len(s) >= 1 && OpCode(s[0]) == OpRETURN && s[1:].IsPushOnly()
+}
+
+// parsedScriptCache lazily parses a script once and caches the result. It's
+// safe for concurrent use. The cache is shared between copies of an Input or
+// Output.
+type parsedScriptCache struct {
+	once   sync.Once
+	script BitcoinScript
+	parsed ParsedBitcoinScript
+}
+
+func newParsedScriptCache(s BitcoinScript) *parsedScriptCache {
+	return &parsedScriptCache{script: s}
+}
+
+// get returns the cached parsed script. The script is parsed without caching
+// if the cache is nil or if the script was replaced after the cache was
+// created.
+func (c *parsedScriptCache) get(s BitcoinScript) ParsedBitcoinScript {
+	if c == nil || !sameScript(c.script, s) {
+		return s.Parse()
+	}
+	c.once.Do(func() {
+		c.parsed = c.script.Parse()
+	})
+	return c.parsed
+}
+
+// sameScript returns true if both scripts reference the same memory.
+func sameScript(a, b BitcoinScript) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || &a[0] == &b[0]
+}
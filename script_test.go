@@ -1,6 +1,9 @@
 package rawtx
 
 import (
+	"encoding/json"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -225,3 +228,126 @@ func TestPBSString(t *testing.T) {
 		t.Errorf("Expected pbs.String()=OP_0 OP_DATA_1(fa) OP_PUSHDATA1(5, deadbeef53), got %s", pbs.String())
 	}
 }
+
+func TestParsedScriptCache(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, in := range tx.Inputs {
+					if !reflect.DeepEqual(in.ParsedScriptSig(), in.ScriptSig.Parse()) {
+						t.Errorf("Expected ParsedScriptSig() to equal ScriptSig.Parse() for testTx: %+v", testTx)
+					}
+				}
+				for _, out := range tx.Outputs {
+					if !reflect.DeepEqual(out.ParsedScriptPubKey(), out.ScriptPubKey.Parse()) {
+						t.Errorf("Expected ParsedScriptPubKey() to equal ScriptPubKey.Parse() for testTx: %+v", testTx)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		// replacing the script invalidates the cache
+		out := tx.Outputs[0]
+		out.ScriptPubKey = BitcoinScript{byte(OpRETURN), byte(OpDATA1), 0xb1}
+		if parsed := out.ParsedScriptPubKey(); len(parsed) != 2 || parsed[0].OpCode != OpRETURN {
+			t.Errorf("Expected ParsedScriptPubKey() to parse the replaced script, but got %s for testTx: %+v", parsed, testTx)
+		}
+	}
+
+	// inputs and outputs constructed without cache still work
+	out := Output{ScriptPubKey: BitcoinScript{byte(OpRETURN), byte(OpDATA1), 0xb1}}
+	if !out.IsOPReturnOutput() {
+		t.Errorf("Expected a output constructed without cache to be an OP_RETURN output")
+	}
+}
+
+// benchmarkBlockTxns returns the test transactions repeated until they are
+// about the size of a 1 MB block.
+func benchmarkBlockTxns(b *testing.B) (txns []Tx) {
+	size := 0
+	for size < 1000000 {
+		for _, testTx := range GetTestTransactions() {
+			tx, err := StringToTx(testTx.RawTx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			txns = append(txns, tx)
+			size += tx.GetSizeWithWitness()
+		}
+	}
+	return txns
+}
+
+// withoutScriptCache returns copies of the transactions where the inputs and
+// outputs don't cache the parsed scripts.
+func withoutScriptCache(txns []Tx) []Tx {
+	uncached := make([]Tx, len(txns))
+	for i, tx := range txns {
+		uncached[i] = tx
+		uncached[i].Inputs = append([]Input{}, tx.Inputs...)
+		uncached[i].Outputs = append([]Output{}, tx.Outputs...)
+		for j := range uncached[i].Inputs {
+			uncached[i].Inputs[j].parsedScriptSig = nil
+		}
+		for j := range uncached[i].Outputs {
+			uncached[i].Outputs[j].parsedScriptPubKey = nil
+		}
+	}
+	return uncached
+}
+
+func benchmarkBlockStats(b *testing.B, txns []Tx) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range txns {
+			txns[j].Stats()
+		}
+	}
+}
+
+func BenchmarkBlockStatsCached(b *testing.B) {
+	benchmarkBlockStats(b, benchmarkBlockTxns(b))
+}
+
+func BenchmarkBlockStatsUncached(b *testing.B) {
+	benchmarkBlockStats(b, withoutScriptCache(benchmarkBlockTxns(b)))
+}
+
+func TestOpCodeMarshalText(t *testing.T) {
+	for i := 0; i <= 0xff; i++ {
+		opCode := OpCode(i)
+		parsed, err := ParseOpCode(opCode.String())
+		if err != nil || parsed != opCode {
+			t.Errorf("Expected ParseOpCode(%s) to be %#02x, but got %#02x (%v)", opCode, i, byte(parsed), err)
+		}
+	}
+
+	if opCode, err := ParseOpCode("OP_CHECKSIGADD"); err != nil || opCode != OpCHECKSIGADD || opCode.String() != "OP_UNKNOWN186" {
+		t.Errorf("Expected OP_CHECKSIGADD as alias of OP_UNKNOWN186, but got %s (%v)", opCode, err)
+	}
+	if _, err := ParseOpCode("OP_UNKNOWN"); err == nil {
+		t.Error("Expected an error parsing an unknown opcode name")
+	}
+
+	// a []OpCode is marshalled as list of names and not base64 encoded
+	opCodes := []OpCode{OpDUP, OpHASH160, OpDATA20, OpEQUALVERIFY, OpCHECKSIG}
+	b, _ := json.Marshal(opCodes)
+	if string(b) != `["OP_DUP","OP_HASH160","OP_DATA_20","OP_EQUALVERIFY","OP_CHECKSIG"]` {
+		t.Errorf("Expected the opcodes to be marshalled by name, but got %s", b)
+	}
+	var unmarshalled []OpCode
+	if err := json.Unmarshal(b, &unmarshalled); err != nil || !reflect.DeepEqual(unmarshalled, opCodes) {
+		t.Errorf("Expected the opcodes to be unmarshalled by name, but got %v (%v)", unmarshalled, err)
+	}
+}
@@ -0,0 +1,138 @@
+package rawtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Serialize returns the transaction serialized in the bitcoin wire format. The
+// witness is only serialized (BIP144) if withWitness is set and at least one
+// input has a witness.
+func (tx *Tx) Serialize(withWitness bool) []byte {
+	hasWitness := withWitness && tx.IsSpendingSegWit()
+
+	b := make([]byte, 0, tx.serializedSize(hasWitness))
+	b = appendUint32(b, uint32(tx.Version))
+	if hasWitness {
+		b = append(b, 0x00, 0x01)
+	}
+
+	b = appendCompactSize(b, uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		b = append(b, in.Outpoint.PrevTxHash[:]...)
+		b = appendUint32(b, in.Outpoint.OutputIndex)
+		b = appendVarBytes(b, in.ScriptSig)
+		b = appendUint32(b, in.Sequence)
+	}
+
+	b = appendCompactSize(b, uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		b = appendUint64(b, uint64(out.Value))
+		b = appendVarBytes(b, out.ScriptPubKey)
+	}
+
+	if hasWitness {
+		for _, in := range tx.Inputs {
+			b = appendCompactSize(b, uint64(len(in.Witness)))
+			for _, element := range in.Witness {
+				b = appendVarBytes(b, element.PushedData)
+			}
+		}
+	}
+
+	return appendUint32(b, tx.Locktime)
+}
+
+// Hex returns the transaction serialized with witness as hex string.
+func (tx *Tx) Hex() string {
+	return hex.EncodeToString(tx.Serialize(true))
+}
+
+// ToWireMsgTx returns the transaction as wire.MsgTx. The scripts and witness
+// elements are copied.
+func (tx *Tx) ToWireMsgTx() *wire.MsgTx {
+	wireTx := wire.NewMsgTx(tx.Version)
+	wireTx.LockTime = tx.Locktime
+	for _, in := range tx.Inputs {
+		prevHash := chainhash.Hash(in.Outpoint.PrevTxHash)
+		txIn := wire.NewTxIn(wire.NewOutPoint(&prevHash, in.Outpoint.OutputIndex), cloneBytes(in.ScriptSig), nil)
+		txIn.Sequence = in.Sequence
+		if len(in.Witness) > 0 {
+			txIn.Witness = make(wire.TxWitness, 0, len(in.Witness))
+			for _, element := range in.Witness {
+				txIn.Witness = append(txIn.Witness, cloneBytes(element.PushedData))
+			}
+		}
+		wireTx.AddTxIn(txIn)
+	}
+	for _, out := range tx.Outputs {
+		wireTx.AddTxOut(wire.NewTxOut(out.Value, cloneBytes(out.ScriptPubKey)))
+	}
+	return wireTx
+}
+
+// serializedSize returns the size of the serialized transaction in bytes.
+func (tx *Tx) serializedSize(withWitness bool) int {
+	size := 4 + compactSizeLength(uint64(len(tx.Inputs))) + compactSizeLength(uint64(len(tx.Outputs))) + 4
+	for _, in := range tx.Inputs {
+		size += HashSize + 4 + varBytesLength(in.ScriptSig) + 4
+	}
+	for _, out := range tx.Outputs {
+		size += 8 + varBytesLength(out.ScriptPubKey)
+	}
+	if withWitness {
+		size += 2
+		for _, in := range tx.Inputs {
+			size += compactSizeLength(uint64(len(in.Witness)))
+			for _, element := range in.Witness {
+				size += varBytesLength(element.PushedData)
+			}
+		}
+	}
+	return size
+}
+
+func varBytesLength(b []byte) int {
+	return compactSizeLength(uint64(len(b))) + len(b)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendCompactSize appends v encoded as bitcoin CompactSize unsigned integer.
+func appendCompactSize(b []byte, v uint64) []byte {
+	switch compactSizeLength(v) {
+	case 1:
+		return append(b, byte(v))
+	case 3:
+		return append(b, 0xfd, byte(v), byte(v>>8))
+	case 5:
+		return appendUint32(append(b, 0xfe), uint32(v))
+	}
+	return appendUint64(append(b, 0xff), v)
+}
+
+func appendVarBytes(b []byte, data []byte) []byte {
+	return append(appendCompactSize(b, uint64(len(data))), data...)
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
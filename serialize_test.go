@@ -0,0 +1,93 @@
+package rawtx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestSerialize(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		if result := tx.Hex(); result != testTx.RawTx {
+			t.Errorf("Expected Hex() to be %s, but got %s for testTx: %+v", testTx.RawTx, result, testTx)
+		}
+
+		withWitness := tx.Serialize(true)
+		if len(withWitness) != tx.GetSizeWithWitness() || DoubleSHA256(withWitness) != tx.WTxID() {
+			t.Errorf("Expected Serialize(true) to match the size and wtxid for testTx: %+v", testTx)
+		}
+
+		withoutWitness := tx.Serialize(false)
+		if len(withoutWitness) != tx.serializeSizeStripped || DoubleSHA256(withoutWitness) != tx.TxID() {
+			t.Errorf("Expected Serialize(false) to match the stripped size and txid for testTx: %+v", testTx)
+		}
+	}
+}
+
+func TestToWireMsgTx(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		raw, _ := hex.DecodeString(testTx.RawTx)
+		tx, err := DeserializeTx(raw)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		wireTx := tx.ToWireMsgTx()
+		var buf bytes.Buffer
+		if err := wireTx.Serialize(&buf); err != nil {
+			t.Fatal(err.Error())
+		}
+		if !bytes.Equal(buf.Bytes(), raw) {
+			t.Errorf("Expected ToWireMsgTx() to serialize to %x, but got %x for testTx: %+v", raw, buf.Bytes(), testTx)
+		}
+		if wireTx.TxHash() != [HashSize]byte(tx.TxID()) {
+			t.Errorf("Expected ToWireMsgTx() to have the txid %s, but got %s for testTx: %+v", tx.TxID(), wireTx.TxHash(), testTx)
+		}
+
+		roundTripped := Tx{}
+		roundTripped.FromWireMsgTx(wireTx)
+		if !reflect.DeepEqual(roundTripped, tx) {
+			t.Errorf("Expected the round-tripped transaction to equal the original, but got %+v and %+v for testTx: %+v", roundTripped, tx, testTx)
+		}
+
+		// the wire.MsgTx doesn't reference the scripts of the Tx
+		if len(tx.Outputs[0].ScriptPubKey) > 0 {
+			wireTx.TxOut[0].PkScript[0] ^= 0xff
+			if tx.Outputs[0].ScriptPubKey[0] == wireTx.TxOut[0].PkScript[0] {
+				t.Errorf("Expected ToWireMsgTx() to copy the scriptPubKey for testTx: %+v", testTx)
+			}
+		}
+	}
+}
+
+func TestAppendCompactSize(t *testing.T) {
+	testCases := map[uint64]string{
+		0:          "00",
+		0xfc:       "fc",
+		0xfd:       "fdfd00",
+		0xffff:     "fdffff",
+		0x10000:    "fe00000100",
+		0xffffffff: "feffffffff",
+		0x10000000: "fe00000010",
+		1 << 32:    "ff0000000001000000",
+	}
+
+	for value, expected := range testCases {
+		result := hex.EncodeToString(appendCompactSize(nil, value))
+		if result != expected {
+			t.Errorf("Expected appendCompactSize(%d) to be %s, but got %s", value, expected, result)
+		}
+		decoded, n, err := readCompactSize(appendCompactSize(nil, value))
+		if err != nil || decoded != value || n != len(expected)/2 {
+			t.Errorf("Expected readCompactSize() to round-trip %d, but got %d (%d bytes, %v)", value, decoded, n, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package rawtx
+
+// MaxPubKeysPerMultisig is the number of sigops counted for a OP_CHECKMULTISIG
+// when the number of public keys is not known (inaccurate counting).
+const MaxPubKeysPerMultisig = 20
+
+// WitnessScaleFactor is the factor legacy sigops and non-witness bytes are
+// scaled with compared to witness sigops and witness bytes.
+const WitnessScaleFactor = 4
+
+// DefaultBytesPerSigOp is Bitcoin Core's default -bytespersigop value used
+// when calculating the sigop-adjusted virtual size of a transaction.
+const DefaultBytesPerSigOp = 20
+
+// SigOpCount counts the signature operations in a BitcoinScript. In accurate
+// mode the number of public keys pushed before a OP_CHECKMULTISIG(VERIFY) is
+// used. Otherwise, and in accurate mode if the number of public keys is not
+// pushed as OP_1 to OP_16, a OP_CHECKMULTISIG(VERIFY) counts as 20 sigops.
+func (s BitcoinScript) SigOpCount(accurate bool) (count int) {
+	lastOpCode := OpINVALIDOPCODE
+	for _, poc := range s.Parse() {
+		switch poc.OpCode {
+		case OpCHECKSIG, OpCHECKSIGVERIFY:
+			count++
+		case OpCHECKMULTISIG, OpCHECKMULTISIGVERIFY:
+			if accurate && lastOpCode >= Op1 && lastOpCode <= Op16 {
+				count += int(lastOpCode - Op1 + 1)
+			} else {
+				count += MaxPubKeysPerMultisig
+			}
+		}
+		lastOpCode = poc.OpCode
+	}
+	return count
+}
+
+// LegacySigOpCount returns the number of sigops in the scriptSig of the input
+// counted in inaccurate mode.
+func (in *Input) LegacySigOpCount() int {
+	return in.ScriptSig.SigOpCount(false)
+}
+
+// LegacySigOpCount returns the number of sigops in the scriptPubKey of the
+// output counted in inaccurate mode.
+func (out *Output) LegacySigOpCount() int {
+	return out.ScriptPubKey.SigOpCount(false)
+}
+
+// p2shRedeemScript returns the last data pushed by a push-only scriptSig. This
+// is the redeem script if the input spends a P2SH output.
+func (in *Input) p2shRedeemScript() (BitcoinScript, bool) {
+	if !in.ScriptSig.IsPushOnly() {
+		return nil, false
+	}
+	pbs := in.ParsedScriptSig()
+	if len(pbs) == 0 {
+		return nil, false
+	}
+	return pbs[len(pbs)-1].PushedData, true
+}
+
+// spendsP2SHOutput returns if the input spends a P2SH output. If the prevout is
+// unknown, the input type is used to determine this.
+func (in *Input) spendsP2SHOutput() bool {
+	if in.Prevout != nil {
+		return in.Prevout.IsP2SHOutput()
+	}
+	switch in.GetType() {
+	case InP2SH, InP2SH_P2WPKH, InP2SH_P2WSH:
+		return true
+	}
+	return false
+}
+
+// P2SHSigOpCount returns the number of sigops in the redeem script of a P2SH
+// input counted in accurate mode. Zero is returned for non-P2SH inputs.
+func (in *Input) P2SHSigOpCount() int {
+	if in.IsCoinbase() || !in.spendsP2SHOutput() {
+		return 0
+	}
+	redeemScript, ok := in.p2shRedeemScript()
+	if !ok {
+		return 0
+	}
+	return redeemScript.SigOpCount(true)
+}
+
+// WitnessSigOpCount returns the number of sigops of a native or nested SegWit
+// v0 input. A P2WPKH input counts as one sigop and the sigops of a P2WSH
+// witness script are counted in accurate mode. Taproot inputs don't count
+// sigops.
+func (in *Input) WitnessSigOpCount() int {
+	if in.IsCoinbase() {
+		return 0
+	}
+
+	var witnessProgram BitcoinScript
+	if in.Prevout != nil {
+		witnessProgram = in.Prevout.ScriptPubKey
+		if in.Prevout.IsP2SHOutput() {
+			redeemScript, ok := in.p2shRedeemScript()
+			if !ok {
+				return 0
+			}
+			witnessProgram = redeemScript
+		}
+	} else {
+		switch in.GetType() {
+		case InP2WPKH, InP2SH_P2WPKH:
+			return 1
+		case InP2WSH, InP2SH_P2WSH:
+			return BitcoinScript(in.Witness[len(in.Witness)-1].PushedData).SigOpCount(true)
+		}
+		return 0
+	}
+
+	isWitnessProgram, version, program := witnessProgram.IsWitnessProgram()
+	if !isWitnessProgram || version != 0 {
+		return 0
+	}
+	if len(program) == 20 {
+		return 1
+	}
+	if len(program) == 32 && len(in.Witness) > 0 {
+		return BitcoinScript(in.Witness[len(in.Witness)-1].PushedData).SigOpCount(true)
+	}
+	return 0
+}
+
+// SigOpCost returns the sigop cost of the input: the legacy and P2SH sigops
+// scaled by the witness scale factor plus the witness sigops.
+func (in *Input) SigOpCost() int {
+	return (in.LegacySigOpCount()+in.P2SHSigOpCount())*WitnessScaleFactor + in.WitnessSigOpCount()
+}
+
+// LegacySigOpCount returns the number of sigops in all scriptSigs and
+// scriptPubKeys of the transaction counted in inaccurate mode.
+func (tx *Tx) LegacySigOpCount() (count int) {
+	for _, in := range tx.Inputs {
+		count += in.LegacySigOpCount()
+	}
+	for _, out := range tx.Outputs {
+		count += out.LegacySigOpCount()
+	}
+	return count
+}
+
+// P2SHSigOpCount returns the number of sigops in the redeem scripts of all P2SH
+// inputs of the transaction.
+func (tx *Tx) P2SHSigOpCount() (count int) {
+	for _, in := range tx.Inputs {
+		count += in.P2SHSigOpCount()
+	}
+	return count
+}
+
+// WitnessSigOpCount returns the number of witness sigops of all inputs of the
+// transaction.
+func (tx *Tx) WitnessSigOpCount() (count int) {
+	for _, in := range tx.Inputs {
+		count += in.WitnessSigOpCount()
+	}
+	return count
+}
+
+// SigOpCost returns the sigop cost of the transaction as defined in BIP141.
+func (tx *Tx) SigOpCost() int {
+	return (tx.LegacySigOpCount()+tx.P2SHSigOpCount())*WitnessScaleFactor + tx.WitnessSigOpCount()
+}
+
+// GetSigOpAdjustedVSize returns the virtual size of the transaction in vbyte
+// where each sigop is accounted for with at least bytesPerSigOp bytes. This is
+// the virtual size Bitcoin Core uses for feerate calculations in its mempool.
+// Bitcoin Core's default is DefaultBytesPerSigOp.
+func (tx *Tx) GetSigOpAdjustedVSize(bytesPerSigOp int) int {
+	weight := tx.GetWeight()
+	if sigOpWeight := tx.SigOpCost() * bytesPerSigOp; sigOpWeight > weight {
+		weight = sigOpWeight
+	}
+	return (weight + WitnessScaleFactor - 1) / WitnessScaleFactor
+}
@@ -0,0 +1,125 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSigOpCount(t *testing.T) {
+	testCases := []struct {
+		script     string
+		accurate   int
+		inaccurate int
+	}{
+		{"", 0, 0},
+		{"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", 1, 1},                               // P2PKH
+		{"a914751e76e8199196d454941c45d1b3a323f1433bd687", 0, 0},                                   // P2SH
+		{"5121020000000000000000000000000000000000000000000000000000000000000001" + "51ae", 1, 20}, // 1-of-1 multisig
+		{"52ae", 2, 20},    // OP_2 OP_CHECKMULTISIG
+		{"0102af", 20, 20}, // OP_DATA_1 OP_CHECKMULTISIGVERIFY
+		{"adacad", 3, 3},   // OP_CHECKSIGVERIFY OP_CHECKSIG OP_CHECKSIGVERIFY
+		{"ba", 0, 0},       // OP_CHECKSIGADD does not count as legacy sigop
+	}
+
+	for _, tc := range testCases {
+		s, _ := hex.DecodeString(tc.script)
+		if count := BitcoinScript(s).SigOpCount(true); count != tc.accurate {
+			t.Errorf("Expected SigOpCount(true) to be %d, but got %d for script %s", tc.accurate, count, tc.script)
+		}
+		if count := BitcoinScript(s).SigOpCount(false); count != tc.inaccurate {
+			t.Errorf("Expected SigOpCount(false) to be %d, but got %d for script %s", tc.inaccurate, count, tc.script)
+		}
+	}
+}
+
+func TestInputSigOpCount(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		for index, in := range tx.Inputs {
+			var expectedP2SH, expectedWitness int
+			switch testTx.InputTypes[index] {
+			case InP2SH:
+				if testTx.MultisigType[index].is {
+					expectedP2SH = testTx.MultisigType[index].n
+				}
+			case InP2WPKH, InP2SH_P2WPKH:
+				expectedWitness = 1
+			case InP2WSH, InP2SH_P2WSH:
+				if testTx.MultisigType[index].is {
+					expectedWitness = testTx.MultisigType[index].n
+				}
+			}
+
+			if testTx.MultisigType[index].is || testTx.InputTypes[index] == InP2WPKH || testTx.InputTypes[index] == InP2SH_P2WPKH {
+				if result := in.P2SHSigOpCount(); result != expectedP2SH {
+					t.Errorf("Expected P2SHSigOpCount() to be %d at index %d, but got %d for testTx: %+v", expectedP2SH, index, result, testTx)
+				}
+				if result := in.WitnessSigOpCount(); result != expectedWitness {
+					t.Errorf("Expected WitnessSigOpCount() to be %d at index %d, but got %d for testTx: %+v", expectedWitness, index, result, testTx)
+				}
+			}
+
+			if testTx.InputTypes[index] == InP2TRKP || testTx.InputTypes[index] == InP2TRSP {
+				if result := in.SigOpCost(); result != 0 {
+					t.Errorf("Expected SigOpCost() of a taproot input to be 0 at index %d, but got %d for testTx: %+v", index, result, testTx)
+				}
+			}
+		}
+	}
+}
+
+func TestTxSigOpCost(t *testing.T) {
+	testTxns := GetTestTransactions()
+	for _, testTx := range testTxns {
+		tx, err := StringToTx(testTx.RawTx)
+		if err != nil {
+			t.Error(err.Error())
+		}
+
+		expected := (tx.LegacySigOpCount()+tx.P2SHSigOpCount())*4 + tx.WitnessSigOpCount()
+		if result := tx.SigOpCost(); result != expected {
+			t.Errorf("Expected SigOpCost() to be %d, but got %d for testTx: %+v", expected, result, testTx)
+		}
+
+		if result := tx.GetSigOpAdjustedVSize(0); result != testTx.VSize {
+			t.Errorf("Expected GetSigOpAdjustedVSize(0) to be %d, but got %d for testTx: %+v", testTx.VSize, result, testTx)
+		}
+	}
+}
+
+func TestGetSigOpAdjustedVSize(t *testing.T) {
+	// "Bitfinex P2SH 7x 3-of-6 multisig" with a P2SH and a P2PKH output
+	testTx := GetTestTransactions()[9]
+	tx, err := StringToTx(testTx.RawTx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if tx.LegacySigOpCount() != 1 || tx.P2SHSigOpCount() != 42 || tx.WitnessSigOpCount() != 0 {
+		t.Errorf("Expected 1 legacy, 42 P2SH and 0 witness sigops, but got %d, %d and %d", tx.LegacySigOpCount(), tx.P2SHSigOpCount(), tx.WitnessSigOpCount())
+	}
+
+	if result := tx.GetSigOpAdjustedVSize(DefaultBytesPerSigOp); result != 3368 {
+		t.Errorf("Expected GetSigOpAdjustedVSize(20) to be 3368, but got %d", result)
+	}
+
+	// (1 + 42) * 4 * 100 = 17200 sigop weight is more than the 13472 weight
+	if result := tx.GetSigOpAdjustedVSize(100); result != 4300 {
+		t.Errorf("Expected GetSigOpAdjustedVSize(100) to be 4300, but got %d", result)
+	}
+
+	if violations := tx.CheckStandard(DefaultPolicy()); len(violations) != 0 {
+		t.Errorf("Expected the transaction with 6 P2SH sigops per input to be standard, but got %v", violations)
+	}
+
+	policy := DefaultPolicy()
+	policy.MaxP2SHSigOps = 5
+	if violations := tx.CheckStandard(policy); len(violations) != 7 || !hasViolation(violations, ViolationP2SHSigOps) {
+		t.Errorf("Expected 7 P2SH sigop violations, but got %v", violations)
+	}
+}
@@ -11,13 +11,16 @@ import (
 )
 
 // Tx represents a bitcoin transaction as a struct.
+// Hash is the txid of the transaction. HashString is deprecated, use
+// Hash.String() instead.
 type Tx struct {
-	Hash                  []byte
+	Hash                  Hash
 	HashString            string
 	Version               int32
 	Inputs                []Input
 	Outputs               []Output
 	Locktime              uint32
+	wtxid                 Hash
 	bip69sorted           bool
 	serializeSizeStripped int
 	serializeSize         int
@@ -30,9 +33,9 @@ func (tx *Tx) FromWireMsgTx(wireTx *wire.MsgTx) {
 	tx.serializeSize = wireTx.SerializeSize()
 	tx.serializeSizeStripped = wireTx.SerializeSizeStripped()
 	tx.bip69sorted = txsort.IsSorted(wireTx)
-	hash := wireTx.TxHash()
-	tx.Hash = hash.CloneBytes()
-	tx.HashString = hash.String()
+	tx.Hash = Hash(wireTx.TxHash())
+	tx.HashString = tx.Hash.String()
+	tx.wtxid = Hash(wireTx.WitnessHash())
 
 	for _, wireInput := range wireTx.TxIn {
 		in := Input{}
@@ -47,6 +50,17 @@ func (tx *Tx) FromWireMsgTx(wireTx *wire.MsgTx) {
 	}
 }
 
+// TxID returns the transaction id. The witness is not committed to in the txid.
+func (tx *Tx) TxID() Hash {
+	return tx.Hash
+}
+
+// WTxID returns the witness transaction id as defined in BIP141. For
+// transactions without witness the wtxid is equal to the txid.
+func (tx *Tx) WTxID() Hash {
+	return tx.wtxid
+}
+
 // GetNumInputs returns the number of inputs the transaction has
 func (tx *Tx) GetNumInputs() int {
 	return len(tx.Inputs)
@@ -65,6 +79,41 @@ func (tx *Tx) GetOutputSum() (sumOutputValues int64) {
 	return
 }
 
+// HasAllPrevouts returns a boolean indicating if the prevouts of all inputs are known
+func (tx *Tx) HasAllPrevouts() bool {
+	for _, in := range tx.Inputs {
+		if in.Prevout == nil {
+			return false
+		}
+	}
+	return len(tx.Inputs) > 0
+}
+
+// GetInputSum returns the sum of all prevout values of the transaction in satoshi.
+// False is returned if a prevout is unknown.
+func (tx *Tx) GetInputSum() (sumInputValues int64, ok bool) {
+	if !tx.HasAllPrevouts() {
+		return 0, false
+	}
+	for _, in := range tx.Inputs {
+		sumInputValues += in.Prevout.Value
+	}
+	return sumInputValues, true
+}
+
+// GetFee returns the fee paid by the transaction in satoshi. False is returned
+// if a prevout is unknown or if the transaction is a coinbase.
+func (tx *Tx) GetFee() (fee int64, ok bool) {
+	if tx.IsCoinbase() {
+		return 0, false
+	}
+	sumInputValues, ok := tx.GetInputSum()
+	if !ok {
+		return 0, false
+	}
+	return sumInputValues - tx.GetOutputSum(), true
+}
+
 // GetLocktime returns the locktime of the transaction
 func (tx *Tx) GetLocktime() uint32 {
 	return tx.Locktime
@@ -81,6 +130,11 @@ func (tx *Tx) GetSizeWithWitness() int {
 	return tx.serializeSize
 }
 
+// GetWeight returns the transaction weight in weight units as defined in BIP141
+func (tx *Tx) GetWeight() int {
+	return tx.serializeSizeStripped*3 + tx.serializeSize
+}
+
 // IsSpendingSegWit returns a boolean indicating if a transaction spends SegWit inputs
 func (tx *Tx) IsSpendingSegWit() bool {
 	for _, in := range tx.Inputs {
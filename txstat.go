@@ -1,14 +1,20 @@
 package rawtx
 
 // TxStats contains stats about a transaction.
+// TxIDString is deprecated, use TxID.String() instead.
 type TxStats struct {
-	TxID                     []byte
+	TxID                     Hash
+	WTxID                    Hash
 	TxIDString               string
 	Version                  int32
 	Payments                 uint32
 	OutAmount                int64
+	Fee                      int64 // only known if the prevouts of all inputs are known, see HasFee
+	HasFee                   bool
 	VSize                    int
+	SigOpAdjustedVSize       int
 	Size                     int
+	SigOpCost                int
 	IsCoinbase               bool
 	IsSpendingSegWit         bool
 	IsSpendingTaproot        bool
@@ -25,11 +31,14 @@ type TxStats struct {
 func (tx *Tx) Stats() *TxStats {
 	txstats := &TxStats{}
 	txstats.TxID = tx.Hash
-	txstats.TxIDString = tx.HashString
+	txstats.WTxID = tx.WTxID()
+	txstats.TxIDString = tx.Hash.String()
 	txstats.Version = tx.Version
 	txstats.IsCoinbase = tx.IsCoinbase()
 	txstats.VSize = tx.GetSizeWithoutWitness()
 	txstats.Size = tx.GetSizeWithWitness()
+	txstats.SigOpCost = tx.SigOpCost()
+	txstats.SigOpAdjustedVSize = tx.GetSigOpAdjustedVSize(DefaultBytesPerSigOp)
 	txstats.IsSpendingNativeSegWit = tx.IsSpendingNativeSegWit()
 	txstats.IsSpendingNestedSegWit = tx.IsSpendingNestedSegWit()
 	txstats.IsSpendingSegWit = tx.IsSpendingSegWit()
@@ -37,6 +46,7 @@ func (tx *Tx) Stats() *TxStats {
 	txstats.IsBIP69Compliant = tx.IsBIP69Compliant()
 	txstats.IsExplicitlyRBFSignaling = tx.IsExplicitlyRBFSignaling()
 	txstats.Locktime = tx.LocktimeStats()
+	txstats.Fee, txstats.HasFee = tx.GetFee()
 
 	txstats.InStats = make([]*InputStats, 0)
 	for _, input := range tx.Inputs {
@@ -65,26 +75,62 @@ func (tx *Tx) Stats() *TxStats {
 
 // LocktimeStats contains stats about the transaction locktime
 type LocktimeStats struct {
-	Locktime      uint32
-	IsEnforced    bool
-	IsBlockHeight bool
-	IsTimestamp   bool
+	Locktime            uint32
+	IsEnforced          bool
+	IsBlockHeight       bool
+	IsTimestamp         bool
+	HasRelativeLocktime bool
 }
 
 // LocktimeStats returns a populated *LocktimeStats struct for the transaction
 func (tx *Tx) LocktimeStats() *LocktimeStats {
 	locktimeStats := &LocktimeStats{}
 	locktimeStats.Locktime = tx.Locktime
-	locktimeStats.IsBlockHeight = (tx.Locktime > 0 && tx.Locktime < 500000000)
-	locktimeStats.IsTimestamp = (tx.Locktime >= 500000000)
-	for _, input := range tx.Inputs {
-		if input.Sequence < 0xffffffff {
-			locktimeStats.IsEnforced = true
-		}
-	}
+	locktimeStats.IsBlockHeight = (tx.Locktime > 0 && tx.Locktime < LocktimeThreshold)
+	locktimeStats.IsTimestamp = (tx.Locktime >= LocktimeThreshold)
+	locktimeStats.IsEnforced = tx.IsLocktimeEnforced()
+	locktimeStats.HasRelativeLocktime = tx.HasRelativeLocktime()
 	return locktimeStats
 }
 
+// LocktimeContextStats contains stats about the transaction locktime relative
+// to the block height and median time past the transaction was included at.
+// Delta is the number of blocks (for block height locktimes) or seconds (for
+// timestamp locktimes) the locktime lies in the past. A negative Delta means
+// the locktime lies in the future.
+type LocktimeContextStats struct {
+	Locktime         uint32
+	Height           uint32
+	MedianTimePast   uint32
+	IsEnforced       bool
+	IsBlockHeight    bool
+	IsTimestamp      bool
+	IsFinal          bool
+	IsAntiFeeSniping bool
+	Delta            int64
+}
+
+// LocktimeContextStats returns a populated *LocktimeContextStats struct for
+// the transaction included in a block at the passed height. The
+// medianTimePast is the median time past of the previous block.
+func (tx *Tx) LocktimeContextStats(height uint32, medianTimePast uint32) *LocktimeContextStats {
+	stats := &LocktimeContextStats{}
+	stats.Locktime = tx.Locktime
+	stats.Height = height
+	stats.MedianTimePast = medianTimePast
+	stats.IsEnforced = tx.IsLocktimeEnforced()
+	stats.IsBlockHeight = (tx.Locktime > 0 && tx.Locktime < LocktimeThreshold)
+	stats.IsTimestamp = (tx.Locktime >= LocktimeThreshold)
+	stats.IsFinal = tx.IsFinal(height, medianTimePast)
+	stats.IsAntiFeeSniping = tx.IsAntiFeeSniping(height)
+	if stats.IsBlockHeight {
+		stats.Delta = int64(height) - int64(tx.Locktime)
+	} else if stats.IsTimestamp {
+		stats.Delta = int64(medianTimePast) - int64(tx.Locktime)
+	}
+	return stats
+}
+
 // InputStats contains stats about a transaction input
 type InputStats struct {
 	Type                   InputType
@@ -97,6 +143,9 @@ type InputStats struct {
 	IsSpendingMultisig     bool
 	MultiSigM              int
 	MultiSigN              int
+	SigOpCost              int
+	RelativeLocktime       RelativeLocktime // only enforced for transactions with version 2 or higher
+	ScriptTimelocks        []ScriptTimelock
 	SigStats               []*SignatureStats
 	PubKeyStats            []*PubKeyStats
 	OpCodes                []OpCode
@@ -113,6 +162,9 @@ func (input *Input) InputStats() *InputStats {
 	inputStats.IsSpendingSegWit = inputStats.IsSpendingNativeSegWit || inputStats.IsSpendingNestedSegWit
 	inputStats.IsLNUniliteralClosing = input.IsLNUniliteralClosing()
 	inputStats.IsSpendingMultisig = input.SpendsMultisig()
+	inputStats.SigOpCost = input.SigOpCost()
+	inputStats.RelativeLocktime = input.GetRelativeLocktime()
+	inputStats.ScriptTimelocks = input.GetScriptTimelocks()
 	if inputStats.IsSpendingMultisig {
 		switch inputStats.Type {
 		case InP2SH_P2WSH:
@@ -128,7 +180,7 @@ func (input *Input) InputStats() *InputStats {
 	inputStats.PubKeyStats = make([]*PubKeyStats, 0)
 	inputStats.OpCodes = make([]OpCode, 0)
 	if len(input.ScriptSig) > 0 {
-		parsedScriptSig := input.ScriptSig.Parse()
+		parsedScriptSig := input.ParsedScriptSig()
 		for _, opCode := range parsedScriptSig {
 			if opCode.IsSignature() {
 				ss := opCode.SignatureStats()
@@ -244,7 +296,7 @@ func (out *Output) OutputStats() *OutputStats {
 
 	outStats.PubKeyStats = make([]*PubKeyStats, 0)
 	outStats.OpCodes = make([]OpCode, 0)
-	parsedScriptPubKey := out.ScriptPubKey.Parse()
+	parsedScriptPubKey := out.ParsedScriptPubKey()
 	for _, opCode := range parsedScriptPubKey {
 		if opCode.IsECDSAPubKey() {
 			pks := opCode.PubKeyStats()
@@ -0,0 +1,173 @@
+package undo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// XORKeyFile is the file in the blocks directory with the key the blk*.dat
+// and rev*.dat files are obfuscated with since Bitcoin Core v28.0.
+const XORKeyFile = "xor.dat"
+
+// maxRecordSize limits the size of an undo record to guard against corrupt
+// files. It's the maximum size of serialized data in Bitcoin Core (MAX_SIZE).
+// The undo data of a block can be larger than the block, as an input of 41
+// bytes can spend an output with a script of up to 10000 bytes.
+const maxRecordSize = 0x02000000
+
+// ErrChecksumMismatch is returned by Record.Verify if the checksum doesn't
+// match the undo data.
+var ErrChecksumMismatch = errors.New("undo checksum mismatch")
+
+// Record is the undo data of a block in a rev*.dat file.
+type Record struct {
+	// Offset is the position of the undo data in the file, as stored in
+	// Bitcoin Core's block index.
+	Offset int64
+	Undo   BlockUndo
+	// Checksum is the double SHA256 hash of the previous block hash and the
+	// serialized undo data.
+	Checksum rawtx.Hash
+	raw      []byte
+}
+
+// Verify returns ErrChecksumMismatch if the record isn't the undo data of the
+// block with the previous block hash. As rev*.dat files aren't ordered by
+// height, the checksum can be used to find the undo data of a block.
+func (r *Record) Verify(prevBlock rawtx.Hash) error {
+	if rawtx.DoubleSHA256(append(prevBlock.CloneBytes(), r.raw...)) != r.Checksum {
+		return fmt.Errorf("%w for the block after %s", ErrChecksumMismatch, prevBlock)
+	}
+	return nil
+}
+
+// Reader reads the undo records of a rev*.dat file.
+type Reader struct {
+	r      *bufio.Reader
+	magic  wire.BitcoinNet
+	offset int64
+}
+
+// NewReader returns a Reader for a rev*.dat file of the network with the
+// magic, for example chaincfg.MainNetParams.Net.
+func NewReader(r io.Reader, magic wire.BitcoinNet) *Reader {
+	return &Reader{r: bufio.NewReader(r), magic: magic}
+}
+
+// NewXORReader returns a Reader for a rev*.dat file obfuscated with the key
+// from the xor.dat file. A zero or empty key means no obfuscation.
+func NewXORReader(r io.Reader, magic wire.BitcoinNet, key []byte) *Reader {
+	return NewReader(&xorReader{r: r, key: key}, magic)
+}
+
+// Next returns the next record, or io.EOF after the last one. Files are
+// preallocated by Bitcoin Core, so zero bytes after the last record are
+// treated as end of file.
+func (r *Reader) Next() (*Record, error) {
+	var header [8]byte
+	n, err := io.ReadFull(r.r, header[:])
+	if isZero(header[:n]) && (err == nil || err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("record at %d: %s", r.offset, err)
+	}
+	if magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[:4])); magic != r.magic {
+		return nil, fmt.Errorf("record at %d: network magic %s, expected %s", r.offset, magic, r.magic)
+	}
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record at %d: size %d exceeds the maximum of %d bytes", r.offset, size, maxRecordSize)
+	}
+
+	record := &Record{Offset: r.offset + 8, raw: make([]byte, size)}
+	if _, err := io.ReadFull(r.r, record.raw); err != nil {
+		return nil, fmt.Errorf("record at %d: %s", r.offset, unexpectedEOF(err))
+	}
+	if _, err := io.ReadFull(r.r, record.Checksum[:]); err != nil {
+		return nil, fmt.Errorf("record at %d: checksum: %s", r.offset, unexpectedEOF(err))
+	}
+	r.offset += 8 + int64(size) + rawtx.HashSize
+	if record.Undo, err = DeserializeBlockUndo(record.raw); err != nil {
+		return nil, fmt.Errorf("record at %d: %s", record.Offset-8, err)
+	}
+	return record, nil
+}
+
+// ReadFile reads all undo records of a rev*.dat file in a Bitcoin Core blocks
+// directory. The file is deobfuscated with the key in the xor.dat file of the
+// directory if present.
+func ReadFile(name string, magic wire.BitcoinNet) ([]*Record, error) {
+	key, err := ReadXORKey(filepath.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewXORReader(f, magic, key)
+	var records []*Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// ReadXORKey returns the obfuscation key from the xor.dat file in the blocks
+// directory. Nil is returned if the file doesn't exist, as in blocks
+// directories of Bitcoin Core versions before v28.0.
+func ReadXORKey(blocksDir string) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(blocksDir, XORKeyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 8 {
+		return nil, fmt.Errorf("%s: key is %d bytes long, expected 8 bytes", XORKeyFile, len(key))
+	}
+	return key, nil
+}
+
+// xorReader deobfuscates a file by XORing each byte with the key byte at the
+// file position modulo the key length.
+type xorReader struct {
+	r      io.Reader
+	key    []byte
+	offset int64
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	if len(x.key) > 0 {
+		for i := 0; i < n; i++ {
+			p[i] ^= x.key[(x.offset+int64(i))%int64(len(x.key))]
+		}
+	}
+	x.offset += int64(n)
+	return n, err
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
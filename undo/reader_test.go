@@ -0,0 +1,141 @@
+package undo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// appendRecord appends the undo data as a record of a rev*.dat file to b.
+func appendRecord(b []byte, undo BlockUndo, prevBlock rawtx.Hash) []byte {
+	raw := undo.Serialize()
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(chaincfg.MainNetParams.Net))
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(raw)))
+	checksum := rawtx.DoubleSHA256(append(prevBlock.CloneBytes(), raw...))
+	b = append(append(b, header[:]...), raw...)
+	return append(b, checksum[:]...)
+}
+
+func TestReadFile(t *testing.T) {
+	block, undo := testBlock170(t)
+	var emptyUndo BlockUndo
+	file := appendRecord(nil, emptyUndo, rawtx.Hash{1})
+	file = appendRecord(file, undo, block.Header.PrevBlock)
+	// Bitcoin Core preallocates the files
+	file = append(file, make([]byte, 100)...)
+
+	dir, err := ioutil.TempDir("", "rawtx")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	key := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	for _, obfuscated := range []bool{false, true} {
+		content := append([]byte{}, file...)
+		if obfuscated {
+			for i := range content {
+				content[i] ^= key[i%len(key)]
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, XORKeyFile), key, 0644); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		name := filepath.Join(dir, "rev00000.dat")
+		if err := ioutil.WriteFile(name, content, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		records, err := ReadFile(name, chaincfg.MainNetParams.Net)
+		if err != nil {
+			t.Fatalf("Expected the records to be read (obfuscated %t), but got %s", obfuscated, err)
+		}
+		if len(records) != 2 || len(records[0].Undo) != 0 || len(records[1].Undo) != 1 {
+			t.Fatalf("Expected two records (obfuscated %t), but got %+v", obfuscated, records)
+		}
+		if records[0].Offset != 8 || records[1].Offset != 8+1+32+8 {
+			t.Errorf("Expected the offsets 8 and 49, but got %d and %d", records[0].Offset, records[1].Offset)
+		}
+		if err := records[0].Verify(rawtx.Hash{1}); err != nil {
+			t.Errorf("Expected the first record to match, but got %s", err)
+		}
+		if err := records[1].Verify(rawtx.Hash{1}); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected ErrChecksumMismatch for the second record, but got %v", err)
+		}
+		if err := records[1].Verify(block.Header.PrevBlock); err != nil {
+			t.Errorf("Expected the second record to match block 170, but got %s", err)
+		}
+		if err := records[1].Undo.Apply(&block); err != nil {
+			t.Errorf("Expected the undo data to match block 170, but got %s", err)
+		}
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "missing"), chaincfg.MainNetParams.Net); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, XORKeyFile), key[:4], 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := ReadXORKey(dir); err == nil {
+		t.Error("Expected an error for a short key")
+	}
+	if key, err := ReadXORKey(filepath.Join(dir, "missing")); err != nil || key != nil {
+		t.Errorf("Expected no key without a xor.dat file, but got %x (%v)", key, err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, undo := testBlock170(t)
+	record := appendRecord(nil, undo, rawtx.Hash{})
+	invalid := map[string][]byte{
+		"truncated header":   record[:6],
+		"truncated undo":     record[:10],
+		"truncated checksum": record[:len(record)-1],
+		"invalid undo":       append(append(append([]byte{}, record[:8]...), 0x05), record[9:]...),
+		"large size":         append(append([]byte{}, record[:4]...), 0x01, 0x00, 0x00, 0x02),
+	}
+	for name, b := range invalid {
+		if _, err := NewReader(bytes.NewReader(b), chaincfg.MainNetParams.Net).Next(); err == nil || err == io.EOF {
+			t.Errorf("Expected an error for a %s, but got %v", name, err)
+		}
+	}
+	if _, err := NewReader(bytes.NewReader(record), chaincfg.TestNet3Params.Net).Next(); err == nil {
+		t.Error("Expected an error for a different network magic")
+	}
+
+	r := NewReader(bytes.NewReader(record), chaincfg.MainNetParams.Net)
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last record, but got %v", err)
+	}
+}
+
+func TestReaderLargeRecord(t *testing.T) {
+	// undo data larger than the maximum block weight
+	script := append([]byte{byte(rawtx.OpPUSHDATA2), 0x0d, 0x27}, make([]byte, maxScriptSize-3)...)
+	txUndo := make(TxUndo, 401)
+	for i := range txUndo {
+		txUndo[i] = Coin{Output: rawtx.NewOutput(1000, script), Height: 1}
+	}
+	record := appendRecord(nil, BlockUndo{txUndo}, rawtx.Hash{})
+	if len(record) <= 4000000 {
+		t.Fatalf("Expected a record larger than 4000000 bytes, but got %d", len(record))
+	}
+	got, err := NewReader(bytes.NewReader(record), chaincfg.MainNetParams.Net).Next()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(got.Undo) != 1 || len(got.Undo[0]) != len(txUndo) {
+		t.Errorf("Expected %d coins, but got %+v", len(txUndo), got.Undo)
+	}
+}
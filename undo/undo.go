@@ -0,0 +1,359 @@
+// Package undo reads the block undo data of Bitcoin Core's rev*.dat files.
+//
+// For each block, Bitcoin Core stores the outputs spent by the block in its
+// undo data to be able to disconnect the block in a reorg. These are the
+// prevouts of the inputs, which makes fee and prevout dependent analysis of
+// historical blocks possible without a node or a UTXO set.
+package undo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxScriptSize is the maximum size of a script. Larger scripts are stored as
+// OP_RETURN, as they are unspendable.
+const maxScriptSize = 10000
+
+// numSpecialScripts is the number of script types with a special compression.
+const numSpecialScripts = 6
+
+// ErrCountMismatch is wrapped by the errors returned if the undo data doesn't
+// match the transactions or inputs of a block.
+var ErrCountMismatch = errors.New("undo data doesn't match the block")
+
+// Coin is an output spent by an input with the height and if it was created
+// by a coinbase transaction.
+type Coin struct {
+	Output     *rawtx.Output
+	Height     uint32
+	IsCoinbase bool
+}
+
+// TxUndo are the coins spent by the inputs of a transaction, in input order.
+type TxUndo []Coin
+
+// BlockUndo is the undo data of a block. It has an entry for each transaction
+// except the coinbase, in block order.
+type BlockUndo []TxUndo
+
+// DeserializeBlockUndo deserializes the undo data of a block.
+func DeserializeBlockUndo(b []byte) (BlockUndo, error) {
+	r := bufio.NewReader(bytes.NewReader(b))
+	numTxns, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, fmt.Errorf("transaction count: %s", err)
+	}
+	// each transaction undo has at least one coin of 3 bytes
+	if numTxns > uint64(len(b)/4) {
+		return nil, fmt.Errorf("transaction count %d exceeds the size of the undo data", numTxns)
+	}
+	undo := make(BlockUndo, numTxns)
+	for i := range undo {
+		numCoins, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: coin count: %s", i, err)
+		}
+		if numCoins > uint64(len(b)/3) {
+			return nil, fmt.Errorf("transaction %d: coin count %d exceeds the size of the undo data", i, numCoins)
+		}
+		undo[i] = make(TxUndo, numCoins)
+		for j := range undo[i] {
+			if undo[i][j], err = ReadCoin(r); err != nil {
+				return nil, fmt.Errorf("transaction %d: coin %d: %s", i, j, err)
+			}
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after the block undo")
+	}
+	return undo, nil
+}
+
+// Serialize returns the serialized undo data as stored by Bitcoin Core.
+func (u BlockUndo) Serialize() []byte {
+	var buf bytes.Buffer
+	wire.WriteVarInt(&buf, 0, uint64(len(u)))
+	for _, txUndo := range u {
+		wire.WriteVarInt(&buf, 0, uint64(len(txUndo)))
+		for _, coin := range txUndo {
+			buf.Write(AppendCoin(nil, coin))
+		}
+	}
+	return buf.Bytes()
+}
+
+// Apply sets the prevouts of the inputs of the block from the undo data. An
+// error wrapping ErrCountMismatch is returned if the number of transactions
+// or inputs doesn't match.
+func (u BlockUndo) Apply(block *rawtx.Block) error {
+	if err := u.check(block); err != nil {
+		return err
+	}
+	for i, txUndo := range u {
+		tx := &block.Transactions[i+1]
+		for j := range tx.Inputs {
+			tx.Inputs[j].Prevout = txUndo[j].Output
+		}
+	}
+	return nil
+}
+
+// Prevouts returns a PrevoutFetcher with the outputs spent by the block, for
+// example to be used for Block.Stats.
+func (u BlockUndo) Prevouts(block *rawtx.Block) (rawtx.PrevoutMap, error) {
+	if err := u.check(block); err != nil {
+		return nil, err
+	}
+	prevouts := make(rawtx.PrevoutMap)
+	for i, txUndo := range u {
+		for j, in := range block.Transactions[i+1].Inputs {
+			prevouts[in.Outpoint] = txUndo[j].Output
+		}
+	}
+	return prevouts, nil
+}
+
+func (u BlockUndo) check(block *rawtx.Block) error {
+	if len(block.Transactions) != len(u)+1 {
+		return fmt.Errorf("%w: %d transactions in the undo data of block %s with %d transactions", ErrCountMismatch, len(u), block.Hash, len(block.Transactions))
+	}
+	for i, txUndo := range u {
+		if n := len(block.Transactions[i+1].Inputs); n != len(txUndo) {
+			return fmt.Errorf("%w: %d coins in the undo data of transaction %d with %d inputs", ErrCountMismatch, len(txUndo), i+1, n)
+		}
+	}
+	return nil
+}
+
+// ReadCoin reads a coin in the compressed format of Bitcoin Core's undo data.
+// Unlike in the UTXO set, coins with a height are followed by a version.
+func ReadCoin(r io.ByteReader) (Coin, error) {
+	code, err := ReadVarInt(r)
+	if err != nil {
+		return Coin{}, fmt.Errorf("height: %s", err)
+	}
+	if code>>1 > 0xffffffff {
+		return Coin{}, fmt.Errorf("height %d out of range", code>>1)
+	}
+	coin := Coin{Height: uint32(code >> 1), IsCoinbase: code&1 == 1}
+	if coin.Height > 0 {
+		// an unused version for compatibility with the old undo format
+		if _, err := ReadVarInt(r); err != nil {
+			return Coin{}, fmt.Errorf("version: %s", err)
+		}
+	}
+	if coin.Output, err = ReadCompressedOutput(r); err != nil {
+		return Coin{}, err
+	}
+	return coin, nil
+}
+
+// AppendCoin appends the coin in the compressed format of Bitcoin Core's undo
+// data to b.
+func AppendCoin(b []byte, coin Coin) []byte {
+	code := uint64(coin.Height) << 1
+	if coin.IsCoinbase {
+		code |= 1
+	}
+	b = AppendVarInt(b, code)
+	if coin.Height > 0 {
+		b = append(b, 0)
+	}
+	return AppendCompressedOutput(b, coin.Output)
+}
+
+// ReadCompressedOutput reads an output with a compressed amount and script.
+func ReadCompressedOutput(r io.ByteReader) (*rawtx.Output, error) {
+	amount, err := ReadVarInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("amount: %s", err)
+	}
+	script, err := readCompressedScript(r)
+	if err != nil {
+		return nil, fmt.Errorf("script: %s", err)
+	}
+	return rawtx.NewOutput(int64(DecompressAmount(amount)), script), nil
+}
+
+// AppendCompressedOutput appends the output with a compressed amount and
+// script to b.
+func AppendCompressedOutput(b []byte, out *rawtx.Output) []byte {
+	b = AppendVarInt(b, CompressAmount(uint64(out.Value)))
+	return appendCompressedScript(b, out.ScriptPubKey)
+}
+
+// ReadVarInt reads a variable length integer in the MSB base-128 format
+// Bitcoin Core uses for its databases and undo data. It's different from the
+// CompactSize format used in transactions.
+func ReadVarInt(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if n > (1<<64-1)>>7 {
+			return 0, errors.New("VarInt overflows 64 bits")
+		}
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			return n, nil
+		}
+		if n == 1<<64-1 {
+			return 0, errors.New("VarInt overflows 64 bits")
+		}
+		n++
+	}
+}
+
+// AppendVarInt appends n in the format read by ReadVarInt to b.
+func AppendVarInt(b []byte, n uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(n & 0x7f)
+	for n > 0x7f {
+		n = (n >> 7) - 1
+		i--
+		tmp[i] = byte(n&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
+
+// CompressAmount compresses an amount in sat as Bitcoin Core does for its
+// UTXO set, making round amounts small.
+func CompressAmount(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	e := uint64(0)
+	for n%10 == 0 && e < 9 {
+		n /= 10
+		e++
+	}
+	if e < 9 {
+		d := n % 10
+		n /= 10
+		return 1 + (n*9+d-1)*10 + e
+	}
+	return 1 + (n-1)*10 + 9
+}
+
+// DecompressAmount returns the amount in sat compressed by CompressAmount.
+func DecompressAmount(x uint64) uint64 {
+	if x == 0 {
+		return 0
+	}
+	x--
+	e := x % 10
+	x /= 10
+	var n uint64
+	if e < 9 {
+		d := x%9 + 1
+		x /= 9
+		n = x*10 + d
+	} else {
+		n = x + 1
+	}
+	for ; e > 0; e-- {
+		n *= 10
+	}
+	return n
+}
+
+// readCompressedScript reads a script compressed by appendCompressedScript.
+func readCompressedScript(r io.ByteReader) (rawtx.BitcoinScript, error) {
+	size, err := ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	switch size {
+	case 0, 1:
+		hash, err := readBytes(r, 20)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			script := []byte{byte(rawtx.OpDUP), byte(rawtx.OpHASH160), byte(rawtx.OpDATA20)}
+			return append(append(script, hash...), byte(rawtx.OpEQUALVERIFY), byte(rawtx.OpCHECKSIG)), nil
+		}
+		script := []byte{byte(rawtx.OpHASH160), byte(rawtx.OpDATA20)}
+		return append(append(script, hash...), byte(rawtx.OpEQUAL)), nil
+	case 2, 3, 4, 5:
+		x, err := readBytes(r, 32)
+		if err != nil {
+			return nil, err
+		}
+		if size < 4 {
+			script := append([]byte{byte(rawtx.OpDATA33), byte(size)}, x...)
+			return append(script, byte(rawtx.OpCHECKSIG)), nil
+		}
+		pubKey, err := btcec.ParsePubKey(append([]byte{byte(size - 2)}, x...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid compressed public key: %s", err)
+		}
+		script := append([]byte{byte(rawtx.OpDATA65)}, pubKey.SerializeUncompressed()...)
+		return append(script, byte(rawtx.OpCHECKSIG)), nil
+	}
+
+	size -= numSpecialScripts
+	if size > maxScriptSize {
+		// unspendable scripts are replaced by OP_RETURN
+		for i := uint64(0); i < size; i++ {
+			if _, err := r.ReadByte(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		return rawtx.BitcoinScript{byte(rawtx.OpRETURN)}, nil
+	}
+	return readBytes(r, int(size))
+}
+
+// appendCompressedScript appends the script to b. P2PKH, P2SH and P2PK
+// scripts are stored by their hash or x coordinate of the public key, all
+// other scripts with their length increased by the number of special
+// scripts.
+func appendCompressedScript(b []byte, script rawtx.BitcoinScript) []byte {
+	switch {
+	case len(script) == 25 && script[0] == byte(rawtx.OpDUP) && script[1] == byte(rawtx.OpHASH160) && script[2] == byte(rawtx.OpDATA20) &&
+		script[23] == byte(rawtx.OpEQUALVERIFY) && script[24] == byte(rawtx.OpCHECKSIG):
+		return append(append(b, 0), script[3:23]...)
+	case len(script) == 23 && script[0] == byte(rawtx.OpHASH160) && script[1] == byte(rawtx.OpDATA20) && script[22] == byte(rawtx.OpEQUAL):
+		return append(append(b, 1), script[2:22]...)
+	case len(script) == 35 && script[0] == byte(rawtx.OpDATA33) && (script[1] == 0x02 || script[1] == 0x03) && script[34] == byte(rawtx.OpCHECKSIG):
+		return append(append(b, script[1]), script[2:34]...)
+	case len(script) == 67 && script[0] == byte(rawtx.OpDATA65) && script[1] == 0x04 && script[66] == byte(rawtx.OpCHECKSIG):
+		// only valid public keys can be decompressed
+		if _, err := btcec.ParsePubKey(script[1:66]); err == nil {
+			return append(append(b, 0x04|script[65]&0x01), script[2:34]...)
+		}
+	}
+	b = AppendVarInt(b, uint64(len(script))+numSpecialScripts)
+	return append(b, script...)
+}
+
+func readBytes(r io.ByteReader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	for i := range b {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		b[i] = c
+	}
+	return b, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
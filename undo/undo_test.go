@@ -0,0 +1,228 @@
+package undo
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// satoshiToHal is the transaction in block 170 spending the coinbase of block 9.
+const satoshiToHal = "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000"
+
+// block9PubKey is the public key the coinbase of block 9 pays to.
+const block9PubKey = "0411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3"
+
+// block170Undo is the undo data of block 170 as stored in rev00000.dat.
+const block170Undo = "0101130032" + "05" + "11db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return b
+}
+
+// testBlock170 returns a block with a coinbase and the transaction from
+// Satoshi to Hal, and the undo data of the block.
+func testBlock170(t *testing.T) (rawtx.Block, BlockUndo) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), []byte{0x04, 0xff, 0xff, 0x00, 0x1d}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(5000000000, append(append([]byte{0x41}, mustDecodeHex(t, block9PubKey)...), 0xac)))
+	var buf bytes.Buffer
+	header := rawtx.BlockHeader{Version: 1, Timestamp: 1231731025, Bits: 0x1d00ffff}
+	buf.Write(header.Serialize())
+	buf.WriteByte(2)
+	if err := coinbase.Serialize(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	buf.Write(mustDecodeHex(t, satoshiToHal))
+	block, err := rawtx.DeserializeBlock(buf.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	undo := BlockUndo{{{
+		Output:     rawtx.NewOutput(5000000000, append(append([]byte{0x41}, mustDecodeHex(t, block9PubKey)...), 0xac)),
+		Height:     9,
+		IsCoinbase: true,
+	}}}
+	return block, undo
+}
+
+func TestBlockUndo(t *testing.T) {
+	block, expected := testBlock170(t)
+	raw := mustDecodeHex(t, block170Undo)
+	undo, err := DeserializeBlockUndo(raw)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(undo) != 1 || len(undo[0]) != 1 || undo[0][0].Height != 9 || !undo[0][0].IsCoinbase ||
+		!reflect.DeepEqual(undo[0][0].Output.ScriptPubKey, expected[0][0].Output.ScriptPubKey) || undo[0][0].Output.Value != 5000000000 {
+		t.Errorf("Expected the coinbase output of block 9, but got %+v", undo)
+	}
+	if serialized := expected.Serialize(); !bytes.Equal(serialized, raw) {
+		t.Errorf("Expected the serialized undo data %x, but got %x", raw, serialized)
+	}
+
+	prevouts, err := undo.Prevouts(&block)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	stats, err := block.Stats(context.Background(), prevouts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stats.TotalFee != 0 || stats.Ins != 1 {
+		t.Errorf("Expected no fee for block 170, but got %d", stats.TotalFee)
+	}
+
+	if err := undo.Apply(&block); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fee, ok := block.Transactions[1].GetFee(); !ok || fee != 0 {
+		t.Error("Expected the prevouts to be applied to the block")
+	}
+}
+
+func TestBlockUndoErrors(t *testing.T) {
+	block, undo := testBlock170(t)
+	mismatches := []BlockUndo{nil, {undo[0], undo[0]}, {append(undo[0], undo[0][0])}}
+	for _, mismatch := range mismatches {
+		if err := mismatch.Apply(&block); !errors.Is(err, ErrCountMismatch) {
+			t.Errorf("Expected ErrCountMismatch for %d transaction undos, but got %v", len(mismatch), err)
+		}
+		if _, err := mismatch.Prevouts(&block); !errors.Is(err, ErrCountMismatch) {
+			t.Errorf("Expected ErrCountMismatch for %d transaction undos, but got %v", len(mismatch), err)
+		}
+	}
+
+	raw := mustDecodeHex(t, block170Undo)
+	invalid := map[string][]byte{
+		"truncated":           raw[:len(raw)-1],
+		"trailing data":       append(append([]byte{}, raw...), 0),
+		"large count":         {0xfe, 0xff, 0xff, 0xff, 0xff},
+		"invalid public key":  append(append([]byte{}, raw[:5]...), append([]byte{0x04}, make([]byte, 32)...)...),
+		"empty":               {},
+		"truncated coin code": {0x01, 0x01, 0x80},
+	}
+	for name, b := range invalid {
+		if _, err := DeserializeBlockUndo(b); err == nil {
+			t.Errorf("Expected an error for %s undo data", name)
+		}
+	}
+}
+
+func TestVarInt(t *testing.T) {
+	tests := map[uint64]string{
+		0:          "00",
+		0x7f:       "7f",
+		0x80:       "8000",
+		0x1234:     "a334",
+		0xffff:     "82fe7f",
+		0x123456:   "c7e756",
+		0x80123456: "86ffc7e756",
+		0xffffffff: "8efefefe7f",
+		1<<64 - 1:  "80fefefefefefefefe7f",
+	}
+	for n, expected := range tests {
+		if b := AppendVarInt(nil, n); hex.EncodeToString(b) != expected {
+			t.Errorf("Expected %d to be encoded as %s, but got %x", n, expected, b)
+		}
+		if decoded, err := ReadVarInt(bytes.NewReader(mustDecodeHex(t, expected))); err != nil || decoded != n {
+			t.Errorf("Expected %s to be decoded as %d, but got %d (%v)", expected, n, decoded, err)
+		}
+	}
+	for _, invalid := range []string{"", "80", "80fefefefefefefefeff00", "81fefefefefefefefe7f"} {
+		if _, err := ReadVarInt(bytes.NewReader(mustDecodeHex(t, invalid))); err == nil {
+			t.Errorf("Expected an error for the VarInt %s", invalid)
+		}
+	}
+}
+
+func TestCompressAmount(t *testing.T) {
+	tests := map[uint64]uint64{
+		0:                0x0,
+		1:                0x1,
+		1000000:          0x7,
+		100000000:        0x9,
+		5000000000:       0x32,
+		2100000000000000: 0x1406f40,
+	}
+	for amount, expected := range tests {
+		if compressed := CompressAmount(amount); compressed != expected {
+			t.Errorf("Expected %d to be compressed to 0x%x, but got 0x%x", amount, expected, compressed)
+		}
+	}
+	for _, amount := range []uint64{0, 1, 9, 10, 123456789, 5000000000, 2100000000000000} {
+		if decompressed := DecompressAmount(CompressAmount(amount)); decompressed != amount {
+			t.Errorf("Expected %d after decompression, but got %d", amount, decompressed)
+		}
+	}
+}
+
+func TestCompressedScript(t *testing.T) {
+	hash := bytes.Repeat([]byte{0x42}, 20)
+	compressedKey := append([]byte{0x03}, bytes.Repeat([]byte{0x11}, 32)...)
+	tests := []struct {
+		script     string
+		compressed string
+	}{
+		{"76a914" + hex.EncodeToString(hash) + "88ac", "00" + hex.EncodeToString(hash)},
+		{"a914" + hex.EncodeToString(hash) + "87", "01" + hex.EncodeToString(hash)},
+		{"21" + hex.EncodeToString(compressedKey) + "ac", hex.EncodeToString(compressedKey)},
+		{"41" + block9PubKey + "ac", "05" + block9PubKey[2:66]},
+		// an invalid uncompressed public key is stored as it is
+		{"41" + "04" + hex.EncodeToString(make([]byte, 64)) + "ac", "49" + "4104" + hex.EncodeToString(make([]byte, 64)) + "ac"},
+		{"0014" + hex.EncodeToString(hash), "1c" + "0014" + hex.EncodeToString(hash)},
+		{"", "06"},
+	}
+	for _, test := range tests {
+		script := mustDecodeHex(t, test.script)
+		if compressed := appendCompressedScript(nil, script); hex.EncodeToString(compressed) != test.compressed {
+			t.Errorf("Expected %s to be compressed to %s, but got %x", test.script, test.compressed, compressed)
+		}
+		decompressed, err := readCompressedScript(bytes.NewReader(mustDecodeHex(t, test.compressed)))
+		if err != nil || !bytes.Equal(decompressed, script) {
+			t.Errorf("Expected %s to be decompressed to %s, but got %x (%v)", test.compressed, test.script, decompressed, err)
+		}
+	}
+
+	// scripts larger than the maximum are unspendable and replaced by OP_RETURN
+	large := append(AppendVarInt(nil, maxScriptSize+1+numSpecialScripts), make([]byte, maxScriptSize+1)...)
+	r := bytes.NewReader(append(large, 0xff))
+	if script, err := readCompressedScript(r); err != nil || !bytes.Equal(script, []byte{byte(rawtx.OpRETURN)}) || r.Len() != 1 {
+		t.Errorf("Expected an OP_RETURN script after skipping the large script, but got %x (%v)", script, err)
+	}
+}
+
+func TestCoin(t *testing.T) {
+	coins := []Coin{
+		{Output: rawtx.NewOutput(5000000000, mustDecodeHex(t, "41"+block9PubKey+"ac")), Height: 9, IsCoinbase: true},
+		{Output: rawtx.NewOutput(1234, mustDecodeHex(t, "51"))},
+		{Output: rawtx.NewOutput(0, mustDecodeHex(t, "6a")), Height: 800000},
+	}
+	for _, coin := range coins {
+		b := AppendCoin(nil, coin)
+		r := bytes.NewReader(b)
+		decoded, err := ReadCoin(r)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if decoded.Height != coin.Height || decoded.IsCoinbase != coin.IsCoinbase || decoded.Output.Value != coin.Output.Value ||
+			!bytes.Equal(decoded.Output.ScriptPubKey, coin.Output.ScriptPubKey) || r.Len() != 0 {
+			t.Errorf("Expected the coin %+v, but got %+v", coin, decoded)
+		}
+	}
+	// coins without height have no version byte
+	if b := AppendCoin(nil, coins[1]); !bytes.Equal(b, AppendCompressedOutput([]byte{0}, coins[1].Output)) {
+		t.Errorf("Expected no version for a coin without height, but got %x", b)
+	}
+}
@@ -1,31 +1,32 @@
 package rawtx
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
-	"strings"
+	"errors"
 
 	"github.com/btcsuite/btcd/wire"
 )
 
 /* utility functions */
 
-// StringToTx returns a wire.MsgTx for a raw transaction hex string
+// StringToTx returns a Tx for a raw transaction hex string
 func StringToTx(rawTx string) (Tx, error) {
 	hexDecodedTx, err := HexDecodeRawTxString(rawTx)
-	if err == nil {
-		tx, err := DeserializeRawTxBytes(hexDecodedTx)
-		if err == nil {
-			return tx, nil
-		}
+	if err != nil {
+		return Tx{}, err
 	}
-	return Tx{}, err
+	return DeserializeTx(hexDecodedTx)
 }
 
-// DeserializeRawTxBytes returns a wire.MsgTx for a hex decoded rawTx as byte slice.
+// DeserializeRawTxBytes returns a Tx for a hex decoded rawTx as byte slice.
+// The transaction is deserialized via a wire.MsgTx. See DeserializeTx for a
+// faster alternative that doesn't copy the rawTx.
 // If the rawTx is can't be deserialized an error is returned.
 func DeserializeRawTxBytes(rawTx []byte) (tx Tx, err error) {
 	wireTx := wire.NewMsgTx(1)
-	r := strings.NewReader(string(rawTx)) // FIXME: could this be made more efficenient?
+	r := bytes.NewReader(rawTx)
 	err = wireTx.Deserialize(r)
 	if err != nil {
 		return
@@ -43,3 +44,57 @@ func HexDecodeRawTxString(rawTx string) (hexDecodedTx []byte, err error) {
 	}
 	return
 }
+
+// readCompactSize reads a bitcoin CompactSize unsigned integer from the start
+// of b. The value and the number of bytes read are returned.
+func readCompactSize(b []byte) (value uint64, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, errors.New("unexpected end of data reading a CompactSize")
+	}
+
+	var length int
+	switch b[0] {
+	case 0xfd:
+		length = 2
+	case 0xfe:
+		length = 4
+	case 0xff:
+		length = 8
+	default:
+		return uint64(b[0]), 1, nil
+	}
+
+	if len(b) < 1+length {
+		return 0, 0, errors.New("unexpected end of data reading a CompactSize")
+	}
+
+	var min uint64
+	switch length {
+	case 2:
+		value, min = uint64(binary.LittleEndian.Uint16(b[1:3])), 0xfd
+	case 4:
+		value, min = uint64(binary.LittleEndian.Uint32(b[1:5])), 0x10000
+	case 8:
+		value, min = binary.LittleEndian.Uint64(b[1:9]), 0x100000000
+	}
+
+	// reject non-canonical encodings
+	if value < min {
+		return 0, 0, errors.New("non-canonical CompactSize encoding")
+	}
+	return value, 1 + length, nil
+}
+
+// compactSizeLength returns the number of bytes needed to encode the value as
+// a bitcoin CompactSize unsigned integer.
+func compactSizeLength(value uint64) int {
+	switch {
+	case value < 0xfd:
+		return 1
+	case value <= 0xffff:
+		return 3
+	case value <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
@@ -24,3 +24,10 @@ func TestStringToTx(t *testing.T) {
 		t.Errorf("The input %s should not be a valid hex string.\n", "abcdefghi")
 	}
 }
+
+func TestStringToTxInvalidTx(t *testing.T) {
+	tx, err := StringToTx("ff0052")
+	if err == nil {
+		t.Errorf("The input %s should not be a valid transaction, but got %+v.\n", "ff0052", tx)
+	}
+}
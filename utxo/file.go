@@ -0,0 +1,308 @@
+package utxo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/undo"
+)
+
+// Record types of the log of a FileStore.
+const (
+	recordAdd    = 'a'
+	recordDelete = 'd'
+	recordTip    = 't'
+)
+
+// fileCoin is the position of a coin in the file of a FileStore.
+type fileCoin struct {
+	offset int64
+	size   int
+}
+
+// FileStore is a Store keeping the coins in a file, with only an index of
+// the outpoints in memory. Updates are appended to the file as log of added
+// and deleted coins, followed by the new tip. When the file is opened, the
+// log is replayed up to the last tip, so an interrupted update is discarded.
+// Call Compact to remove deleted coins from the file.
+type FileStore struct {
+	f      *os.File
+	w      *bufio.Writer
+	name   string
+	index  map[rawtx.Outpoint]fileCoin
+	size   int64
+	tip    rawtx.Hash
+	height int64
+}
+
+// OpenFileStore opens the FileStore in the file, which is created if it
+// doesn't exist.
+func OpenFileStore(name string) (*FileStore, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStore{f: f, name: name, index: make(map[rawtx.Outpoint]fileCoin), height: -1}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	s.w = bufio.NewWriter(f)
+	return s, nil
+}
+
+// load replays the log and truncates the file after the last tip. A record
+// cut off at the end of the file is the rest of an interrupted update.
+func (s *FileStore) load() error {
+	r := &countingReader{r: bufio.NewReader(s.f)}
+	pending := make(map[rawtx.Outpoint]*fileCoin)
+	for {
+		offset := r.n
+		err := s.loadRecord(r, pending)
+		if err == io.EOF || r.eof {
+			break
+		} else if err != nil {
+			return fmt.Errorf("record at %d: %s", offset, err)
+		}
+	}
+	if err := s.f.Truncate(s.size); err != nil {
+		return err
+	}
+	_, err := s.f.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// loadRecord reads a record of the log. Added and deleted coins are pending
+// until the next tip.
+func (s *FileStore) loadRecord(r *countingReader, pending map[rawtx.Outpoint]*fileCoin) error {
+	recordType, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if recordType == recordTip {
+		var tip rawtx.Hash
+		if err := readFull(r, tip[:]); err != nil {
+			return err
+		}
+		height, err := undo.ReadVarInt(r)
+		if err != nil {
+			return err
+		}
+		for outpoint, coin := range pending {
+			if coin == nil {
+				delete(s.index, outpoint)
+			} else {
+				s.index[outpoint] = *coin
+			}
+			delete(pending, outpoint)
+		}
+		s.tip, s.height, s.size = tip, int64(height)-1, r.n
+		return nil
+	}
+
+	var outpoint rawtx.Outpoint
+	if err := readFull(r, outpoint.PrevTxHash[:]); err != nil {
+		return err
+	}
+	index, err := undo.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	outpoint.OutputIndex = uint32(index)
+	switch recordType {
+	case recordAdd:
+		offset := r.n
+		if _, err := readCoin(r); err != nil {
+			return err
+		}
+		pending[outpoint] = &fileCoin{offset: offset, size: int(r.n - offset)}
+	case recordDelete:
+		pending[outpoint] = nil
+	default:
+		return fmt.Errorf("invalid record type %d", recordType)
+	}
+	return nil
+}
+
+// Get reads the coin at the outpoint from the file.
+func (s *FileStore) Get(outpoint rawtx.Outpoint) (undo.Coin, bool, error) {
+	fc, ok := s.index[outpoint]
+	if !ok {
+		return undo.Coin{}, false, nil
+	}
+	if s.w.Buffered() > 0 {
+		if err := s.w.Flush(); err != nil {
+			return undo.Coin{}, false, err
+		}
+	}
+	b := make([]byte, fc.size)
+	if _, err := s.f.ReadAt(b, fc.offset); err != nil {
+		return undo.Coin{}, false, err
+	}
+	coin, err := readCoin(bytes.NewReader(b))
+	if err != nil {
+		return undo.Coin{}, false, fmt.Errorf("coin at %d: %s", fc.offset, err)
+	}
+	return coin, true, nil
+}
+
+// Update appends the update to the file.
+func (s *FileStore) Update(update *Update) error {
+	var b []byte
+	for _, outpoint := range update.Spent {
+		b = appendOutpoint(append(b, recordDelete), outpoint)
+	}
+	added := make([]fileCoin, len(update.Added))
+	for i, entry := range update.Added {
+		b = appendOutpoint(append(b, recordAdd), entry.Outpoint)
+		offset := len(b)
+		b = appendCoin(b, entry.Coin)
+		added[i] = fileCoin{offset: s.size + int64(offset), size: len(b) - offset}
+	}
+	b = append(b, recordTip)
+	b = append(b, update.Tip[:]...)
+	// the height is stored increased by one, as it's -1 for an empty set
+	b = undo.AppendVarInt(b, uint64(update.Height+1))
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+
+	s.size += int64(len(b))
+	for _, outpoint := range update.Spent {
+		delete(s.index, outpoint)
+	}
+	for i, entry := range update.Added {
+		s.index[entry.Outpoint] = added[i]
+	}
+	s.tip, s.height = update.Tip, update.Height
+	return nil
+}
+
+// ForEach calls fn for each coin in the file in random order.
+func (s *FileStore) ForEach(fn func(outpoint rawtx.Outpoint, coin undo.Coin) error) error {
+	for outpoint := range s.index {
+		coin, _, err := s.Get(outpoint)
+		if err != nil {
+			return err
+		}
+		if err := fn(outpoint, coin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outpoints returns the outpoints of the coins from the index without reading
+// the file.
+func (s *FileStore) Outpoints() []rawtx.Outpoint {
+	outpoints := make([]rawtx.Outpoint, 0, len(s.index))
+	for outpoint := range s.index {
+		outpoints = append(outpoints, outpoint)
+	}
+	return outpoints
+}
+
+// Tip returns the hash and height of the last block.
+func (s *FileStore) Tip() (rawtx.Hash, int64) {
+	return s.tip, s.height
+}
+
+// Len returns the number of coins.
+func (s *FileStore) Len() int {
+	return len(s.index)
+}
+
+// Flush writes the buffered updates to the file and syncs it to disk.
+func (s *FileStore) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Compact rewrites the file with only the unspent coins.
+func (s *FileStore) Compact() error {
+	name := s.name + ".tmp"
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tmp, err := OpenFileStore(name)
+	if err != nil {
+		return err
+	}
+	update := &Update{Height: -1}
+	err = s.ForEach(func(outpoint rawtx.Outpoint, coin undo.Coin) error {
+		update.Added = append(update.Added, Entry{Outpoint: outpoint, Coin: coin})
+		if len(update.Added) < loadBatchSize {
+			return nil
+		}
+		err := tmp.Update(update)
+		update.Added = update.Added[:0]
+		return err
+	})
+	if err == nil {
+		update.Tip, update.Height = s.tip, s.height
+		err = tmp.Update(update)
+	}
+	if err == nil {
+		err = tmp.Flush()
+	}
+	if err == nil {
+		err = os.Rename(name, s.name)
+	}
+	if err != nil {
+		tmp.f.Close()
+		os.Remove(name)
+		return err
+	}
+	s.f.Close()
+	tmp.name = s.name
+	*s = *tmp
+	return nil
+}
+
+// Close flushes the updates and closes the file.
+func (s *FileStore) Close() error {
+	if err := s.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func appendOutpoint(b []byte, outpoint rawtx.Outpoint) []byte {
+	b = append(b, outpoint.PrevTxHash[:]...)
+	return undo.AppendVarInt(b, uint64(outpoint.OutputIndex))
+}
+
+func readFull(r io.ByteReader, b []byte) error {
+	for i := range b {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		b[i] = c
+	}
+	return nil
+}
+
+// countingReader counts the bytes read and if the end of the file was hit.
+type countingReader struct {
+	r   *bufio.Reader
+	n   int64
+	eof bool
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	} else if err == io.EOF {
+		c.eof = true
+	}
+	return b, err
+}
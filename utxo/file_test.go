@@ -0,0 +1,130 @@
+package utxo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/undo"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// coins returns the coins of the store with the serialized outputs.
+func coins(t *testing.T, store Store) map[rawtx.Outpoint]string {
+	coins := make(map[rawtx.Outpoint]string)
+	err := store.ForEach(func(outpoint rawtx.Outpoint, coin undo.Coin) error {
+		coins[outpoint] = string(appendCoin(nil, coin))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return coins
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rawtx")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "utxo.dat")
+
+	store, err := OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	set, expected := NewSet(store), NewSet(NewMemoryStore())
+	for _, raw := range testChain(t) {
+		if _, err := set.ConnectBlock(deserializeBlock(t, raw)); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := expected.ConnectBlock(deserializeBlock(t, raw)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if !reflect.DeepEqual(coins(t, store), coins(t, expected.store)) {
+		t.Errorf("Expected the coins of the memory store, but got %x", coins(t, store))
+	}
+	var snapshot, expectedSnapshot bytes.Buffer
+	if err := set.SaveSnapshot(&snapshot, &chaincfg.RegressionNetParams); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := expected.SaveSnapshot(&expectedSnapshot, &chaincfg.RegressionNetParams); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(snapshot.Bytes(), expectedSnapshot.Bytes()) {
+		t.Errorf("Expected the snapshot of the memory store, but got %x", snapshot.Bytes())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// an interrupted update is discarded when the store is opened
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	interrupted := appendOutpoint([]byte{recordDelete}, rawtx.Outpoint{PrevTxHash: rawtx.Hash{1}})
+	interrupted = appendOutpoint(append(interrupted, recordAdd), rawtx.Outpoint{PrevTxHash: rawtx.Hash{2}})
+	if err := ioutil.WriteFile(name, append(content, interrupted[:len(interrupted)-1]...), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	store, err = OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedTip, expectedHeight := expected.Tip()
+	if tip, height := store.Tip(); tip != expectedTip || height != expectedHeight || !reflect.DeepEqual(coins(t, store), coins(t, expected.store)) {
+		t.Errorf("Expected the reopened store at the tip %s at %d, but got %s at %d", expectedTip, expectedHeight, tip, height)
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() != int64(len(content)) {
+		t.Errorf("Expected the interrupted update to be truncated, but got %v", err)
+	}
+
+	// compaction removes the spent coins
+	if err := store.Compact(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() >= int64(len(content)) {
+		t.Errorf("Expected the compacted file to be smaller, but got %v", err)
+	}
+	set = NewSet(store)
+	if tip, height := set.Tip(); tip != expectedTip || height != expectedHeight || !reflect.DeepEqual(coins(t, store), coins(t, expected.store)) {
+		t.Errorf("Expected the compacted store at the tip %s at %d, but got %s at %d", expectedTip, expectedHeight, tip, height)
+	}
+	// the compacted store can be updated and reopened
+	block3 := deserializeBlock(t, newBlock(t, expectedTip, newCoinbase(3)))
+	if _, err := set.ConnectBlock(block3); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	store, err = OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if tip, height := store.Tip(); tip != block3.Hash || height != 3 || store.Len() != expected.Len()+1 {
+		t.Errorf("Expected block 3 as tip of the reopened store, but got %s at %d", tip, height)
+	}
+	store.Close()
+
+	content, err = ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(name, append(content, bytes.Repeat([]byte{'x'}, 40)...), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := OpenFileStore(name); err == nil {
+		t.Error("Expected an error for an invalid record")
+	}
+	if _, err := OpenFileStore(filepath.Join(dir, "missing", "utxo.dat")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
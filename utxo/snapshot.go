@@ -0,0 +1,189 @@
+package utxo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/undo"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// snapshotMagic starts a UTXO snapshot.
+var snapshotMagic = []byte{'u', 't', 'x', 'o', 0xff}
+
+// snapshotVersion is the version of the snapshot format of Bitcoin Core
+// v28.0 and later.
+const snapshotVersion = 2
+
+// loadBatchSize is the number of coins added to the store at once while
+// loading a snapshot.
+const loadBatchSize = 100000
+
+// SaveSnapshot writes the coins and the tip of the set to w in the format of
+// Bitcoin Core's dumptxoutset RPC. The coins are written ordered by outpoint
+// like Bitcoin Core does. Only the outpoints are sorted in memory, each coin
+// is read from the store while it's written.
+func (s *Set) SaveSnapshot(w io.Writer, params *chaincfg.Params) error {
+	outpoints := s.store.Outpoints()
+	sort.Slice(outpoints, func(i, j int) bool {
+		a, b := outpoints[i], outpoints[j]
+		if c := bytes.Compare(a.PrevTxHash[:], b.PrevTxHash[:]); c != 0 {
+			return c < 0
+		}
+		return a.OutputIndex < b.OutputIndex
+	})
+
+	bw := bufio.NewWriter(w)
+	tip, _ := s.store.Tip()
+	header := append([]byte{}, snapshotMagic...)
+	header = appendUint16(header, snapshotVersion)
+	header = appendUint32(header, uint32(params.Net))
+	header = append(header, tip[:]...)
+	header = appendUint64(header, uint64(len(outpoints)))
+	bw.Write(header)
+
+	var b []byte
+	for i := 0; i < len(outpoints); {
+		txid := outpoints[i].PrevTxHash
+		n := 1
+		for i+n < len(outpoints) && outpoints[i+n].PrevTxHash == txid {
+			n++
+		}
+		bw.Write(txid[:])
+		wire.WriteVarInt(bw, 0, uint64(n))
+		for _, outpoint := range outpoints[i : i+n] {
+			coin, ok, err := s.store.Get(outpoint)
+			if err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("coin %s:%d not found in the store", outpoint.PrevTxHash, outpoint.OutputIndex)
+			}
+			wire.WriteVarInt(bw, 0, uint64(outpoint.OutputIndex))
+			b = appendCoin(b[:0], coin)
+			bw.Write(b)
+		}
+		i += n
+	}
+	return bw.Flush()
+}
+
+// LoadSnapshot loads a snapshot written by SaveSnapshot or Bitcoin Core's
+// dumptxoutset RPC into the empty store. The snapshot doesn't contain the
+// height of its base block, so it has to be passed as height, like the
+// base_height returned by dumptxoutset. Coins above the height are rejected.
+func LoadSnapshot(r io.Reader, store Store, params *chaincfg.Params, height int64) (*Set, error) {
+	if store.Len() != 0 {
+		return nil, errors.New("the store isn't empty")
+	}
+	if height < 0 || height > 0xffffffff {
+		return nil, fmt.Errorf("base height %d out of range", height)
+	}
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+2+4+rawtx.HashSize+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("snapshot header: %s", err)
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic) {
+		return nil, errors.New("not a UTXO snapshot")
+	}
+	header = header[len(snapshotMagic):]
+	if version := binary.LittleEndian.Uint16(header); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	if magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[2:])); magic != params.Net {
+		return nil, fmt.Errorf("snapshot of network %s, expected %s", magic, params.Net)
+	}
+	var tip rawtx.Hash
+	copy(tip[:], header[6:])
+	numCoins := binary.LittleEndian.Uint64(header[6+rawtx.HashSize:])
+
+	update := &Update{Height: -1}
+	for loaded := uint64(0); loaded < numCoins; {
+		var txid rawtx.Hash
+		if _, err := io.ReadFull(br, txid[:]); err != nil {
+			return nil, fmt.Errorf("coin %d: txid: %s", loaded, err)
+		}
+		n, err := wire.ReadVarInt(br, 0)
+		if err != nil {
+			return nil, fmt.Errorf("coin %d: count: %s", loaded, err)
+		}
+		if n == 0 || n > numCoins-loaded {
+			return nil, fmt.Errorf("coin %d: count %d exceeds the %d coins of the snapshot", loaded, n, numCoins)
+		}
+		for ; n > 0; n-- {
+			index, err := wire.ReadVarInt(br, 0)
+			if err != nil || index >= 0xffffffff {
+				return nil, fmt.Errorf("coin %d: invalid output index", loaded)
+			}
+			coin, err := readCoin(br)
+			if err != nil {
+				return nil, fmt.Errorf("coin %d: %s", loaded, err)
+			}
+			if int64(coin.Height) > height {
+				return nil, fmt.Errorf("coin %d: height %d above the base height %d", loaded, coin.Height, height)
+			}
+			update.Added = append(update.Added, Entry{Outpoint: rawtx.Outpoint{PrevTxHash: txid, OutputIndex: uint32(index)}, Coin: coin})
+			loaded++
+		}
+		if len(update.Added) >= loadBatchSize {
+			if err := store.Update(update); err != nil {
+				return nil, err
+			}
+			update.Added = update.Added[:0]
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after the coins of the snapshot")
+	}
+
+	update.Tip, update.Height = tip, height
+	if err := store.Update(update); err != nil {
+		return nil, err
+	}
+	return NewSet(store), nil
+}
+
+// readCoin reads a coin in the format of Bitcoin Core's UTXO set.
+func readCoin(r io.ByteReader) (undo.Coin, error) {
+	code, err := undo.ReadVarInt(r)
+	if err != nil {
+		return undo.Coin{}, fmt.Errorf("height: %s", err)
+	}
+	if code>>1 > 0xffffffff {
+		return undo.Coin{}, fmt.Errorf("height %d out of range", code>>1)
+	}
+	out, err := undo.ReadCompressedOutput(r)
+	if err != nil {
+		return undo.Coin{}, err
+	}
+	return undo.Coin{Output: out, Height: uint32(code >> 1), IsCoinbase: code&1 == 1}, nil
+}
+
+// appendCoin appends the coin in the format of Bitcoin Core's UTXO set to b.
+// Unlike in undo data, coins have no version.
+func appendCoin(b []byte, coin undo.Coin) []byte {
+	code := uint64(coin.Height) << 1
+	if coin.IsCoinbase {
+		code |= 1
+	}
+	return undo.AppendCompressedOutput(undo.AppendVarInt(b, code), coin.Output)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
@@ -0,0 +1,88 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestSnapshot(t *testing.T) {
+	set := NewSet(NewMemoryStore())
+	for _, raw := range testChain(t) {
+		if _, err := set.ConnectBlock(deserializeBlock(t, raw)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	var snapshot bytes.Buffer
+	if err := set.SaveSnapshot(&snapshot, &chaincfg.RegressionNetParams); err != nil {
+		t.Fatal(err.Error())
+	}
+	tip, height := set.Tip()
+	// magic, version 2, regtest network magic, tip and 4 coins
+	expectedHeader := "7574786fff" + "0200" + "fabfb5da" + hex.EncodeToString(tip[:]) + "0400000000000000"
+	if header := hex.EncodeToString(snapshot.Bytes()[:51]); header != expectedHeader {
+		t.Errorf("Expected the header %s, but got %s", expectedHeader, header)
+	}
+
+	loaded, err := LoadSnapshot(bytes.NewReader(snapshot.Bytes()), NewMemoryStore(), &chaincfg.RegressionNetParams, height)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if loadedTip, loadedHeight := loaded.Tip(); loadedTip != tip || loadedHeight != height {
+		t.Errorf("Expected the tip %s at %d, but got %s at %d", tip, height, loadedTip, loadedHeight)
+	}
+	if !reflect.DeepEqual(coins(t, loaded.store), coins(t, set.store)) {
+		t.Errorf("Expected the coins of the set, but got %x", coins(t, loaded.store))
+	}
+	var saved bytes.Buffer
+	if err := loaded.SaveSnapshot(&saved, &chaincfg.RegressionNetParams); err != nil || !bytes.Equal(saved.Bytes(), snapshot.Bytes()) {
+		t.Errorf("Expected the loaded set to be saved as the same snapshot, but got %v", err)
+	}
+
+	raw := snapshot.Bytes()
+	invalid := map[string][]byte{
+		"empty":           {},
+		"magic":           append([]byte("utxx"), raw[4:]...),
+		"version":         append(append(append([]byte{}, raw[:5]...), 0x01), raw[6:]...),
+		"truncated":       raw[:len(raw)-1],
+		"trailing data":   append(append([]byte{}, raw...), 0),
+		"too many coins":  append(append(append([]byte{}, raw[:43]...), 0x03), raw[44:]...),
+		"too few coins":   append(append(append([]byte{}, raw[:43]...), 0x05), raw[44:]...),
+		"network magic":   append(append(append([]byte{}, raw[:7]...), 0x00), raw[8:]...),
+		"zero coin count": append(append(append([]byte{}, raw[:83]...), 0x00), raw[84:]...),
+	}
+	for name, b := range invalid {
+		if _, err := LoadSnapshot(bytes.NewReader(b), NewMemoryStore(), &chaincfg.RegressionNetParams, height); err == nil {
+			t.Errorf("Expected an error for a snapshot with invalid %s", name)
+		}
+	}
+	if _, err := LoadSnapshot(bytes.NewReader(raw), set.store, &chaincfg.RegressionNetParams, height); err == nil {
+		t.Error("Expected an error for a store that isn't empty")
+	}
+	for _, invalidHeight := range []int64{-1, height - 1, 1 << 32} {
+		if _, err := LoadSnapshot(bytes.NewReader(raw), NewMemoryStore(), &chaincfg.RegressionNetParams, invalidHeight); err == nil {
+			t.Errorf("Expected an error for the base height %d", invalidHeight)
+		}
+	}
+
+	// the base height is taken as passed, even if no coin was created at it
+	if loaded, err = LoadSnapshot(bytes.NewReader(raw), NewMemoryStore(), &chaincfg.RegressionNetParams, height+10); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, loadedHeight := loaded.Tip(); loadedHeight != height+10 {
+		t.Errorf("Expected the base height %d, but got %d", height+10, loadedHeight)
+	}
+	var empty bytes.Buffer
+	if err := NewSet(NewMemoryStore()).SaveSnapshot(&empty, &chaincfg.RegressionNetParams); err != nil {
+		t.Fatal(err.Error())
+	}
+	if loaded, err = LoadSnapshot(bytes.NewReader(empty.Bytes()), NewMemoryStore(), &chaincfg.RegressionNetParams, 0); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, loadedHeight := loaded.Tip(); loadedHeight != 0 || loaded.Len() != 0 {
+		t.Errorf("Expected an empty set at height 0, but got %d coins at %d", loaded.Len(), loadedHeight)
+	}
+}
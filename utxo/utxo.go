@@ -0,0 +1,279 @@
+// Package utxo maintains a UTXO set by replaying blocks in order.
+//
+// The set provides the prevouts of the transactions in the replayed blocks and
+// implements rawtx.PrevoutFetcher for chain scans without a node. The coins are
+// kept in memory or in a file and the set can be saved and loaded as snapshot
+// in the format of Bitcoin Core's dumptxoutset and loadtxoutset.
+package utxo
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/undo"
+)
+
+// maxScriptSize is the maximum size of a script. Outputs with larger scripts
+// are unspendable and not added to the set.
+const maxScriptSize = 10000
+
+// bip30Exceptions are the two mainnet blocks with a coinbase duplicating an
+// earlier coinbase that wasn't spent yet. The coins of the earlier coinbases
+// were overwritten, as the blocks predate BIP30.
+var bip30Exceptions = map[int64]string{
+	91842: "00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec",
+	91880: "00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721",
+}
+
+// Like Bitcoin Core, the BIP30 check is skipped from the mainnet BIP34
+// activation height until bip34ImpliesBIP30Limit. BIP34 makes the coinbases
+// unique by their height until the first height a coinbase of a block before
+// BIP34 activation can duplicate. The test networks activated BIP34 earlier,
+// so the check is still done there between their activation and bip34Height.
+const (
+	bip34Height            = 227931
+	bip34ImpliesBIP30Limit = 1983702
+)
+
+// Entry is a coin at an outpoint.
+type Entry struct {
+	Outpoint rawtx.Outpoint
+	Coin     undo.Coin
+}
+
+// Update are the changes to the set by a block.
+type Update struct {
+	Spent  []rawtx.Outpoint
+	Added  []Entry
+	Tip    rawtx.Hash
+	Height int64
+}
+
+// Store stores the coins of a set.
+type Store interface {
+	// Get returns the coin at the outpoint and if it exists.
+	Get(outpoint rawtx.Outpoint) (undo.Coin, bool, error)
+	// Update removes the spent coins, adds the new coins, overwriting existing
+	// ones, and sets the tip.
+	Update(update *Update) error
+	// ForEach calls fn for each coin until an error is returned.
+	ForEach(fn func(outpoint rawtx.Outpoint, coin undo.Coin) error) error
+	// Outpoints returns the outpoints of the coins in random order.
+	Outpoints() []rawtx.Outpoint
+	// Tip returns the hash and height of the last block, or the zero hash
+	// and -1 for an empty set.
+	Tip() (rawtx.Hash, int64)
+	// Len returns the number of coins.
+	Len() int
+}
+
+// MemoryStore is a Store backed by a map.
+type MemoryStore struct {
+	coins  map[rawtx.Outpoint]undo.Coin
+	tip    rawtx.Hash
+	height int64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{coins: make(map[rawtx.Outpoint]undo.Coin), height: -1}
+}
+
+// Get returns the coin at the outpoint from the map.
+func (m *MemoryStore) Get(outpoint rawtx.Outpoint) (undo.Coin, bool, error) {
+	coin, ok := m.coins[outpoint]
+	return coin, ok, nil
+}
+
+// Update applies the update to the map.
+func (m *MemoryStore) Update(update *Update) error {
+	for _, outpoint := range update.Spent {
+		delete(m.coins, outpoint)
+	}
+	for _, entry := range update.Added {
+		m.coins[entry.Outpoint] = entry.Coin
+	}
+	m.tip, m.height = update.Tip, update.Height
+	return nil
+}
+
+// ForEach calls fn for each coin in the map in random order.
+func (m *MemoryStore) ForEach(fn func(outpoint rawtx.Outpoint, coin undo.Coin) error) error {
+	for outpoint, coin := range m.coins {
+		if err := fn(outpoint, coin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outpoints returns the outpoints of the coins in the map.
+func (m *MemoryStore) Outpoints() []rawtx.Outpoint {
+	outpoints := make([]rawtx.Outpoint, 0, len(m.coins))
+	for outpoint := range m.coins {
+		outpoints = append(outpoints, outpoint)
+	}
+	return outpoints
+}
+
+// Tip returns the hash and height of the last block.
+func (m *MemoryStore) Tip() (rawtx.Hash, int64) {
+	return m.tip, m.height
+}
+
+// Len returns the number of coins in the map.
+func (m *MemoryStore) Len() int {
+	return len(m.coins)
+}
+
+// Set is a UTXO set updated by connecting blocks in order.
+type Set struct {
+	store Store
+}
+
+// NewSet returns a Set with the coins in the store. Blocks are connected on
+// top of the tip of the store, starting with the genesis block for an empty
+// store.
+func NewSet(store Store) *Set {
+	return &Set{store: store}
+}
+
+// Tip returns the hash and height of the last connected block, or the zero
+// hash and -1 if no block was connected.
+func (s *Set) Tip() (rawtx.Hash, int64) {
+	return s.store.Tip()
+}
+
+// Len returns the number of unspent outputs.
+func (s *Set) Len() int {
+	return s.store.Len()
+}
+
+// FetchPrevout returns the unspent output at the outpoint or
+// rawtx.ErrPrevoutNotFound if it doesn't exist or is spent.
+func (s *Set) FetchPrevout(ctx context.Context, outpoint rawtx.Outpoint) (*rawtx.Output, error) {
+	coin, ok, err := s.store.Get(outpoint)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, rawtx.ErrPrevoutNotFound
+	}
+	return coin.Output, nil
+}
+
+// ConnectBlock spends the outputs spent by the block and adds the spendable
+// outputs it creates, like Bitcoin Core does. The prevouts of the inputs are
+// set and returned as undo data. The block has to build on the tip, else a
+// rawtx.BlockError of type BlockErrPrevBlockMismatch is returned. Inputs
+// spending unknown outputs and outputs overwriting unspent outputs (BIP30)
+// are rejected with a BlockError too, leaving the set unchanged. BIP30 isn't
+// checked while BIP34 implies it. The outputs of the genesis block aren't
+// spendable and not added.
+func (s *Set) ConnectBlock(block *rawtx.Block) (undo.BlockUndo, error) {
+	tip, height := s.store.Tip()
+	if block.Header.PrevBlock != tip {
+		return nil, &rawtx.BlockError{Type: rawtx.BlockErrPrevBlockMismatch, TxIndex: -1, Expected: tip, Got: block.Header.PrevBlock,
+			Details: fmt.Sprintf("block %s doesn't build on the tip %s", block.Hash, tip)}
+	}
+	height++
+	enforceBIP30 := bip30Exceptions[height] != block.Hash.String() && (height < bip34Height || height >= bip34ImpliesBIP30Limit)
+
+	update := &Update{Tip: block.Hash, Height: height}
+	created := make(map[rawtx.Outpoint]undo.Coin)
+	spent := make(map[rawtx.Outpoint]bool)
+	var blockUndo undo.BlockUndo
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if i > 0 {
+			txUndo := make(undo.TxUndo, len(tx.Inputs))
+			for j := range tx.Inputs {
+				in := &tx.Inputs[j]
+				coin, ok := created[in.Outpoint]
+				if ok {
+					delete(created, in.Outpoint)
+				} else if !spent[in.Outpoint] {
+					var err error
+					if coin, ok, err = s.store.Get(in.Outpoint); err != nil {
+						return nil, err
+					}
+					spent[in.Outpoint] = ok
+					update.Spent = append(update.Spent, in.Outpoint)
+				}
+				if !ok {
+					return nil, &rawtx.BlockError{Type: rawtx.BlockErrMissingInputs, TxIndex: i,
+						Details: fmt.Sprintf("input %d spends the unknown or spent output %s:%d", j, in.Outpoint.PrevTxHash, in.Outpoint.OutputIndex)}
+				}
+				in.Prevout = coin.Output
+				txUndo[j] = coin
+			}
+			blockUndo = append(blockUndo, txUndo)
+		}
+		if height == 0 {
+			continue
+		}
+
+		for j := range tx.Outputs {
+			out := &tx.Outputs[j]
+			if isUnspendable(out.ScriptPubKey) {
+				continue
+			}
+			outpoint := rawtx.Outpoint{PrevTxHash: tx.Hash, OutputIndex: uint32(j)}
+			if enforceBIP30 && !spent[outpoint] {
+				if _, ok, err := s.store.Get(outpoint); err != nil {
+					return nil, err
+				} else if ok {
+					return nil, &rawtx.BlockError{Type: rawtx.BlockErrBIP30, TxIndex: i, Details: fmt.Sprintf("output %d overwrites an unspent output", j)}
+				}
+			}
+			// the script is copied to not keep the raw block in memory
+			script := append(rawtx.BitcoinScript(nil), out.ScriptPubKey...)
+			created[outpoint] = undo.Coin{Output: rawtx.NewOutput(out.Value, script), Height: uint32(height), IsCoinbase: i == 0}
+			update.Added = append(update.Added, Entry{Outpoint: outpoint, Coin: created[outpoint]})
+		}
+	}
+
+	// outputs spent in the block are never added
+	added := update.Added[:0]
+	for _, entry := range update.Added {
+		if _, ok := created[entry.Outpoint]; ok {
+			added = append(added, entry)
+		}
+	}
+	update.Added = added
+	if err := s.store.Update(update); err != nil {
+		return nil, err
+	}
+	return blockUndo, nil
+}
+
+// Replay connects the blocks read from the source until it returns io.EOF.
+// Items that aren't blocks are rejected.
+func (s *Set) Replay(ctx context.Context, source rawtx.Source) error {
+	for index := 0; ; index++ {
+		item, err := source.Next(ctx)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !item.IsBlock {
+			return fmt.Errorf("item %d: not a block", index)
+		}
+		block, err := rawtx.DeserializeBlock(item.Raw)
+		if err != nil {
+			return fmt.Errorf("item %d: %s", index, err)
+		}
+		if _, err := s.ConnectBlock(&block); err != nil {
+			_, height := s.store.Tip()
+			return fmt.Errorf("item %d: block %s at height %d: %w", index, block.Hash, height+1, err)
+		}
+	}
+}
+
+// isUnspendable returns true for OP_RETURN outputs and outputs with a script
+// larger than the maximum, which Bitcoin Core doesn't add to its UTXO set.
+func isUnspendable(script rawtx.BitcoinScript) bool {
+	return (len(script) > 0 && script[0] == byte(rawtx.OpRETURN)) || len(script) > maxScriptSize
+}
@@ -0,0 +1,220 @@
+package utxo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/0xb10c/rawtx/undo"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var p2wpkh = append([]byte{0x00, 0x14}, make([]byte, 20)...)
+
+// newCoinbase returns a coinbase transaction paying to p2wpkh with an
+// OP_RETURN output. The extra nonce makes the transaction unique.
+func newCoinbase(extraNonce byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), []byte{0x01, extraNonce}, nil))
+	tx.AddTxOut(wire.NewTxOut(5000000000, p2wpkh))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{byte(rawtx.OpRETURN), 0x01, 0x00}))
+	return tx
+}
+
+// newTx returns a transaction spending the outpoints with an output of each
+// value.
+func newTx(outpoints []rawtx.Outpoint, values ...int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for _, outpoint := range outpoints {
+		hash := chainhash.Hash(outpoint.PrevTxHash)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, outpoint.OutputIndex), nil, nil))
+	}
+	for _, value := range values {
+		tx.AddTxOut(wire.NewTxOut(value, p2wpkh))
+	}
+	return tx
+}
+
+func outpoint(tx *wire.MsgTx, index uint32) rawtx.Outpoint {
+	return rawtx.Outpoint{PrevTxHash: rawtx.Hash(tx.TxHash()), OutputIndex: index}
+}
+
+// newBlock returns the raw block with the transactions on top of prevBlock.
+func newBlock(t *testing.T, prevBlock rawtx.Hash, txns ...*wire.MsgTx) []byte {
+	header := rawtx.BlockHeader{Version: 0x20000000, PrevBlock: prevBlock, Timestamp: 1700000000, Bits: 0x207fffff}
+	var buf bytes.Buffer
+	buf.Write(header.Serialize())
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(txns))); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, tx := range txns {
+		if err := tx.Serialize(&buf); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return buf.Bytes()
+}
+
+func deserializeBlock(t *testing.T, raw []byte) *rawtx.Block {
+	block, err := rawtx.DeserializeBlock(raw)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return &block
+}
+
+// testChain returns a chain of the genesis block, a block with a coinbase
+// and a block spending the coinbase with a child in the same block. The
+// coinbase of the second block and the child's outputs are unspent at the
+// tip.
+func testChain(t *testing.T) [][]byte {
+	genesis := newBlock(t, rawtx.Hash{}, newCoinbase(0))
+	coinbase1 := newCoinbase(1)
+	block1 := newBlock(t, deserializeBlock(t, genesis).Hash, coinbase1)
+	parent := newTx([]rawtx.Outpoint{outpoint(coinbase1, 0)}, 3000000000, 1999990000)
+	child := newTx([]rawtx.Outpoint{outpoint(parent, 0)}, 1000000000, 1999990000)
+	block2 := newBlock(t, deserializeBlock(t, block1).Hash, newCoinbase(2), parent, child)
+	return [][]byte{genesis, block1, block2}
+}
+
+func TestConnectBlock(t *testing.T) {
+	chain := testChain(t)
+	set := NewSet(NewMemoryStore())
+	if tip, height := set.Tip(); !tip.IsZero() || height != -1 {
+		t.Errorf("Expected an empty set, but got the tip %s at %d", tip, height)
+	}
+	for i, raw := range chain[:2] {
+		if _, err := set.ConnectBlock(deserializeBlock(t, raw)); err != nil {
+			t.Fatalf("Expected block %d to be connected, but got %s", i, err)
+		}
+	}
+	// the genesis outputs aren't spendable, OP_RETURN outputs are skipped
+	if set.Len() != 1 {
+		t.Errorf("Expected a single coin after block 1, but got %d", set.Len())
+	}
+
+	block2 := deserializeBlock(t, chain[2])
+	stats, err := block2.Stats(context.Background(), set)
+	if err != nil || stats.TotalFee != 20000 {
+		t.Fatalf("Expected the stats of block 2 with the set as PrevoutFetcher, but got %v", err)
+	}
+	block2 = deserializeBlock(t, chain[2])
+	blockUndo, err := set.ConnectBlock(block2)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if tip, height := set.Tip(); tip != block2.Hash || height != 2 {
+		t.Errorf("Expected block 2 as tip, but got %s at %d", tip, height)
+	}
+	if len(blockUndo) != 2 || blockUndo[0][0].Height != 1 || !blockUndo[0][0].IsCoinbase || blockUndo[1][0].Height != 2 || blockUndo[1][0].IsCoinbase {
+		t.Errorf("Expected the coinbase of block 1 and the parent output as undo data, but got %+v", blockUndo)
+	}
+	if fee, ok := block2.Transactions[2].GetFee(); !ok || fee != 10000 {
+		t.Errorf("Expected the prevouts to be set, but got a fee of %d (%t)", fee, ok)
+	}
+	// the coinbase, the parent's second output and the child's outputs
+	if set.Len() != 4 {
+		t.Errorf("Expected 4 coins after block 2, but got %d", set.Len())
+	}
+	parent := block2.Transactions[1].Hash
+	if _, err := set.FetchPrevout(context.Background(), rawtx.Outpoint{PrevTxHash: parent, OutputIndex: 0}); !errors.Is(err, rawtx.ErrPrevoutNotFound) {
+		t.Errorf("Expected the output spent in the same block to be unknown, but got %v", err)
+	}
+	out, err := set.FetchPrevout(context.Background(), rawtx.Outpoint{PrevTxHash: parent, OutputIndex: 1})
+	if err != nil || out.Value != 1999990000 || !bytes.Equal(out.ScriptPubKey, p2wpkh) {
+		t.Errorf("Expected the second output of the parent, but got %+v (%v)", out, err)
+	}
+}
+
+func TestConnectBlockErrors(t *testing.T) {
+	chain := testChain(t)
+	block1 := deserializeBlock(t, chain[1])
+	coinbase1 := newCoinbase(1)
+	unknown := rawtx.Outpoint{PrevTxHash: rawtx.Hash{1}}
+	spend := newTx([]rawtx.Outpoint{outpoint(coinbase1, 0)}, 1000)
+	doubleSpend := newTx([]rawtx.Outpoint{outpoint(coinbase1, 0)}, 2000)
+
+	tests := map[string]struct {
+		raw      []byte
+		expected rawtx.BlockErrorType
+	}{
+		"previous block":     {newBlock(t, rawtx.Hash{1}, newCoinbase(2)), rawtx.BlockErrPrevBlockMismatch},
+		"unknown prevout":    {newBlock(t, block1.Hash, newCoinbase(2), newTx([]rawtx.Outpoint{unknown}, 1000)), rawtx.BlockErrMissingInputs},
+		"double spend":       {newBlock(t, block1.Hash, newCoinbase(2), spend, doubleSpend), rawtx.BlockErrMissingInputs},
+		"duplicate coinbase": {newBlock(t, block1.Hash, coinbase1), rawtx.BlockErrBIP30},
+	}
+	for name, test := range tests {
+		set := NewSet(NewMemoryStore())
+		if err := set.Replay(context.Background(), &rawtx.SliceSource{Items: []rawtx.Item{{Raw: chain[0], IsBlock: true}, {Raw: chain[1], IsBlock: true}}}); err != nil {
+			t.Fatal(err.Error())
+		}
+		_, err := set.ConnectBlock(deserializeBlock(t, test.raw))
+		blockErr, ok := err.(*rawtx.BlockError)
+		if !ok || blockErr.Type != test.expected {
+			t.Errorf("Expected %s for a %s, but got %v", test.expected, name, err)
+		}
+		if tip, height := set.Tip(); tip != block1.Hash || height != 1 || set.Len() != 1 {
+			t.Errorf("Expected the set to be unchanged after a %s, but got the tip %s at %d", name, tip, height)
+		}
+	}
+
+	// the coinbases of the BIP30 exceptions overwrite the earlier coinbases
+	set := NewSet(NewMemoryStore())
+	for _, raw := range chain[:2] {
+		if _, err := set.ConnectBlock(deserializeBlock(t, raw)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	duplicate := deserializeBlock(t, newBlock(t, block1.Hash, coinbase1))
+	bip30Exceptions[2] = duplicate.Hash.String()
+	defer delete(bip30Exceptions, 2)
+	if _, err := set.ConnectBlock(duplicate); err != nil || set.Len() != 1 {
+		t.Errorf("Expected the duplicate coinbase to overwrite the earlier one, but got %v", err)
+	}
+	coin, _, _ := set.store.Get(outpoint(coinbase1, 0))
+	if coin.Height != 2 {
+		t.Errorf("Expected the coin of the duplicate coinbase, but got the height %d", coin.Height)
+	}
+
+	// BIP30 isn't checked while BIP34 is active, until a coinbase of a block
+	// before BIP34 activation could be duplicated
+	for height, enforced := range map[int64]bool{bip34Height - 1: true, bip34Height: false, bip34ImpliesBIP30Limit - 1: false, bip34ImpliesBIP30Limit: true} {
+		store := NewMemoryStore()
+		coin := undo.Coin{Output: rawtx.NewOutput(5000000000, p2wpkh), Height: 1, IsCoinbase: true}
+		if err := store.Update(&Update{Added: []Entry{{Outpoint: outpoint(coinbase1, 0), Coin: coin}}, Tip: block1.Hash, Height: height - 1}); err != nil {
+			t.Fatal(err.Error())
+		}
+		_, err := NewSet(store).ConnectBlock(deserializeBlock(t, newBlock(t, block1.Hash, coinbase1)))
+		if blockErr, ok := err.(*rawtx.BlockError); enforced && (!ok || blockErr.Type != rawtx.BlockErrBIP30) || !enforced && err != nil {
+			t.Errorf("Expected BIP30 to be enforced (%t) at height %d, but got %v", enforced, height, err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var items []rawtx.Item
+	for _, raw := range testChain(t) {
+		items = append(items, rawtx.Item{Raw: raw, IsBlock: true})
+	}
+	set := NewSet(NewMemoryStore())
+	if err := set.Replay(context.Background(), &rawtx.SliceSource{Items: items}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, height := set.Tip(); height != 2 || set.Len() != 4 {
+		t.Errorf("Expected 4 coins at height 2, but got %d at %d", set.Len(), height)
+	}
+
+	invalid := map[string][]rawtx.Item{
+		"transaction":         {{Raw: items[0].Raw}},
+		"invalid block":       {{Raw: items[0].Raw[:90], IsBlock: true}},
+		"out of order blocks": {items[1]},
+	}
+	for name, items := range invalid {
+		if err := NewSet(NewMemoryStore()).Replay(context.Background(), &rawtx.SliceSource{Items: items}); err == nil {
+			t.Errorf("Expected an error for a %s", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package zmqfeed
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned by the Recv method of a Publisher subscription after
+// the Publisher was closed and all queued messages were received.
+var ErrClosed = errors.New("publisher closed")
+
+// Publisher is an in-process stand-in for the ZMQ PUB socket of a node. Like
+// Bitcoin Core, it numbers the messages per topic. Like ZMQ, it drops the
+// messages for a subscriber whose queue is full. It's safe for concurrent use.
+type Publisher struct {
+	mu            sync.Mutex
+	sequences     map[string]uint32
+	subscriptions []*Subscription
+	closed        bool
+}
+
+// NewPublisher returns a Publisher without subscriptions.
+func NewPublisher() *Publisher {
+	return &Publisher{sequences: make(map[string]uint32)}
+}
+
+// Subscription is a Receiver of the messages sent by a Publisher.
+type Subscription struct {
+	topics   []string
+	messages chan [][]byte
+}
+
+// Subscribe returns a Subscription to the messages with a topic starting with
+// one of the topic prefixes, or to all messages if no prefix is given. Up to
+// highWaterMark messages are queued, newer messages are dropped.
+func (p *Publisher) Subscribe(highWaterMark int, topics ...string) *Subscription {
+	s := &Subscription{topics: topics, messages: make(chan [][]byte, highWaterMark)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		close(s.messages)
+	} else {
+		p.subscriptions = append(p.subscriptions, s)
+	}
+	return s
+}
+
+// Publish sends a message with the topic and body and the next sequence
+// number of the topic to the subscriptions. It's a no-op after Close.
+func (p *Publisher) Publish(topic string, body []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	sequence := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sequence, p.sequences[topic])
+	p.sequences[topic]++
+
+	for _, s := range p.subscriptions {
+		if !s.matches(topic) {
+			continue
+		}
+		select {
+		case s.messages <- [][]byte{[]byte(topic), body, sequence}:
+		default:
+			// the queue is full
+		}
+	}
+}
+
+// PublishTx publishes a raw transaction on the rawtx topic.
+func (p *Publisher) PublishTx(rawTx []byte) {
+	p.Publish(TopicRawTx, rawTx)
+}
+
+// PublishBlock publishes a raw block on the rawblock topic.
+func (p *Publisher) PublishBlock(rawBlock []byte) {
+	p.Publish(TopicRawBlock, rawBlock)
+}
+
+// Close closes the subscriptions after the queued messages.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, s := range p.subscriptions {
+		close(s.messages)
+	}
+}
+
+func (s *Subscription) matches(topic string) bool {
+	if len(s.topics) == 0 {
+		return true
+	}
+	for _, prefix := range s.topics {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Recv returns the frames of the next message: the topic, the body and the
+// sequence number.
+func (s *Subscription) Recv(ctx context.Context) ([][]byte, error) {
+	select {
+	case frames, ok := <-s.messages:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return frames, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
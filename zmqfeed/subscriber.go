@@ -0,0 +1,229 @@
+// Package zmqfeed consumes the rawtx and rawblock notifications published by
+// Bitcoin Core with -zmqpubrawtx and -zmqpubrawblock.
+//
+// The package doesn't depend on a ZMQ library. A SUB socket of any ZMQ
+// implementation can be used by wrapping it into a Receiver returning the
+// frames of the received multipart messages. The in-process Publisher is a
+// stand-in for a node, for example in tests.
+package zmqfeed
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/0xb10c/rawtx"
+)
+
+// The topics of the notifications decoded by a Subscriber.
+const (
+	TopicRawTx    = "rawtx"
+	TopicRawBlock = "rawblock"
+)
+
+// Receiver receives the frames of multipart messages from a subscription, for
+// example from a ZMQ SUB socket subscribed to the rawtx and rawblock topics.
+// The decoded transactions and blocks reference the frames, so the receiver
+// must not reuse them.
+type Receiver interface {
+	Recv(ctx context.Context) ([][]byte, error)
+}
+
+// Notification is a decoded rawtx or rawblock notification.
+type Notification struct {
+	Topic string
+	// Sequence is the sequence number of the notification. The publisher
+	// increments it per topic.
+	Sequence uint32
+	// Missed is the number of notifications on the topic that were published
+	// but not received before this one.
+	Missed uint32
+	// Restarted is set if the sequence number jumped backwards or more than
+	// 2^16 notifications forwards, for example because the node restarted or
+	// the notification was duplicated. Missed notifications can't be detected
+	// then and the sequence number of this notification is expected next.
+	Restarted bool
+	// Tx is set for rawtx notifications.
+	Tx *rawtx.Tx
+	// Block is set for rawblock notifications.
+	Block *rawtx.Block
+}
+
+// Subscriber decodes the notifications received by a Receiver and detects
+// gaps in their sequence numbers. It's not safe for concurrent use.
+type Subscriber struct {
+	receiver Receiver
+	// next is the expected sequence number per topic
+	next   map[string]uint32
+	missed map[string]uint64
+}
+
+// NewSubscriber returns a Subscriber decoding the messages of the receiver.
+func NewSubscriber(receiver Receiver) *Subscriber {
+	return &Subscriber{
+		receiver: receiver,
+		next:     make(map[string]uint32),
+		missed:   make(map[string]uint64),
+	}
+}
+
+// Next returns the next rawtx or rawblock notification. Messages with other
+// topics are skipped. The error of the receiver is returned as is, an error
+// decoding a message is returned as DecodeError.
+func (s *Subscriber) Next(ctx context.Context) (*Notification, error) {
+	n, body, err := s.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeBody(n, body); err != nil {
+		return nil, &DecodeError{Topic: n.Topic, Sequence: n.Sequence, Err: err}
+	}
+	return n, nil
+}
+
+// receive returns the next rawtx or rawblock notification with its sequence
+// number checked and the undecoded body.
+func (s *Subscriber) receive(ctx context.Context) (*Notification, []byte, error) {
+	for {
+		frames, err := s.receiver.Recv(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(frames) != 3 {
+			return nil, nil, &DecodeError{Err: fmt.Errorf("expected 3 message frames, but got %d", len(frames))}
+		}
+		topic := string(frames[0])
+		if topic != TopicRawTx && topic != TopicRawBlock {
+			continue
+		}
+		if len(frames[2]) != 4 {
+			return nil, nil, &DecodeError{Topic: topic, Err: fmt.Errorf("expected a 4 byte sequence number, but got %d bytes", len(frames[2]))}
+		}
+
+		n := &Notification{Topic: topic, Sequence: binary.LittleEndian.Uint32(frames[2])}
+		s.checkSequence(n)
+		return n, frames[1], nil
+	}
+}
+
+// maxMissed is the maximum number of notifications counted as missed. Larger
+// jumps of the sequence number, including backwards ones, are restarts.
+const maxMissed = 1 << 16
+
+// checkSequence sets Missed and Restarted of the notification and updates the
+// expected sequence number of the topic.
+func (s *Subscriber) checkSequence(n *Notification) {
+	expected, seen := s.next[n.Topic]
+	s.next[n.Topic] = n.Sequence + 1
+	if !seen || n.Sequence == expected {
+		return
+	}
+	// the sequence number wraps around after 2^32 notifications
+	missed := n.Sequence - expected
+	if missed > maxMissed {
+		n.Restarted = true
+		return
+	}
+	n.Missed = missed
+	s.missed[n.Topic] += uint64(n.Missed)
+}
+
+func decodeBody(n *Notification, body []byte) error {
+	if n.Topic == TopicRawTx {
+		tx, err := rawtx.DeserializeTx(body)
+		if err != nil {
+			return err
+		}
+		n.Tx = &tx
+		return nil
+	}
+	block, err := rawtx.DeserializeBlock(body)
+	if err != nil {
+		return err
+	}
+	n.Block = &block
+	return nil
+}
+
+// Missed returns the number of missed notifications on the topic since the
+// Subscriber was created.
+func (s *Subscriber) Missed(topic string) uint64 {
+	return s.missed[topic]
+}
+
+// DecodeError is returned by Subscriber.Next if a message could not be
+// decoded. The sequence number is still tracked, so the subscriber can
+// continue with the next message.
+type DecodeError struct {
+	Topic    string
+	Sequence uint32
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Topic == "" {
+		return fmt.Sprintf("invalid notification: %s", e.Err)
+	}
+	return fmt.Sprintf("invalid %s notification %d: %s", e.Topic, e.Sequence, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// StatsFunc is called by StreamStats with the stats of a transaction and the
+// notification it was received with.
+type StatsFunc func(stats *rawtx.TxStats, n *Notification) error
+
+// StreamStats calls fn with the stats of the transactions of each received
+// notification, for a block with the stats of all its transactions. Messages
+// that can't be decoded are skipped if skipInvalid is set. StreamStats
+// returns when the receiver or fn return an error or the context is canceled.
+func (s *Subscriber) StreamStats(ctx context.Context, skipInvalid bool, fn StatsFunc) error {
+	for {
+		n, err := s.Next(ctx)
+		if _, ok := err.(*DecodeError); ok && skipInvalid {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if n.Tx != nil {
+			if err := fn(n.Tx.Stats(), n); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := range n.Block.Transactions {
+			if err := fn(n.Block.Transactions[i].Stats(), n); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Source returns a rawtx.Source of the received transactions and blocks to
+// process them with rawtx.RunPipeline. onGap is called, if not nil, when
+// notifications were missed. Invalid message frames stop the pipeline, while
+// bodies that can't be deserialized are handled like other invalid items.
+func (s *Subscriber) Source(onGap func(topic string, missed uint32)) rawtx.Source {
+	return &source{subscriber: s, onGap: onGap}
+}
+
+type source struct {
+	subscriber *Subscriber
+	onGap      func(topic string, missed uint32)
+}
+
+// Next returns the raw transaction or block of the next notification. The
+// body is deserialized by the pipeline.
+func (s *source) Next(ctx context.Context) (rawtx.Item, error) {
+	n, body, err := s.subscriber.receive(ctx)
+	if err != nil {
+		return rawtx.Item{}, err
+	}
+	if n.Missed > 0 && s.onGap != nil {
+		s.onGap(n.Topic, n.Missed)
+	}
+	return rawtx.Item{Raw: body, IsBlock: n.Topic == TopicRawBlock}, nil
+}
@@ -0,0 +1,235 @@
+package zmqfeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/0xb10c/rawtx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func testRawTxns(t *testing.T) (rawTxns [][]byte) {
+	for _, testTx := range rawtx.GetTestTransactions() {
+		rawTx, err := hex.DecodeString(testTx.RawTx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		rawTxns = append(rawTxns, rawTx)
+	}
+	return rawTxns
+}
+
+func genesisBlock(t *testing.T) []byte {
+	var genesis bytes.Buffer
+	if err := chaincfg.MainNetParams.GenesisBlock.Serialize(&genesis); err != nil {
+		t.Fatal(err.Error())
+	}
+	return genesis.Bytes()
+}
+
+// frameReceiver is a Receiver returning the given messages.
+type frameReceiver [][][]byte
+
+func (r *frameReceiver) Recv(ctx context.Context) ([][]byte, error) {
+	if len(*r) == 0 {
+		return nil, ErrClosed
+	}
+	frames := (*r)[0]
+	*r = (*r)[1:]
+	return frames, nil
+}
+
+func message(topic string, body []byte, sequence uint32) [][]byte {
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, sequence)
+	return [][]byte{[]byte(topic), body, seq}
+}
+
+func TestSubscriber(t *testing.T) {
+	rawTxns := testRawTxns(t)
+	publisher := NewPublisher()
+	subscriber := NewSubscriber(publisher.Subscribe(10))
+	ctx := context.Background()
+
+	publisher.PublishTx(rawTxns[0])
+	publisher.Publish("hashtx", make([]byte, 32))
+	publisher.PublishBlock(genesisBlock(t))
+	publisher.PublishTx(rawTxns[1])
+	publisher.Close()
+
+	expected, _ := rawtx.DeserializeTx(rawTxns[0])
+	n, err := subscriber.Next(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.Topic != TopicRawTx || n.Sequence != 0 || n.Tx.TxID() != expected.TxID() || n.Block != nil {
+		t.Errorf("Expected the first transaction, but got %+v", n)
+	}
+
+	// the hashtx message is skipped
+	n, err = subscriber.Next(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.Topic != TopicRawBlock || n.Sequence != 0 || n.Block.Hash.String() != chaincfg.MainNetParams.GenesisHash.String() {
+		t.Errorf("Expected the genesis block, but got %+v", n)
+	}
+
+	n, err = subscriber.Next(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.Sequence != 1 || n.Missed != 0 {
+		t.Errorf("Expected the second transaction without missed notifications, but got %+v", n)
+	}
+
+	if _, err := subscriber.Next(ctx); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, but got %v", err)
+	}
+}
+
+func TestSubscriberGaps(t *testing.T) {
+	rawTxns := testRawTxns(t)
+	publisher := NewPublisher()
+	// a subscription to only the rawtx topic queuing two messages
+	subscriber := NewSubscriber(publisher.Subscribe(2, TopicRawTx))
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		publisher.PublishTx(rawTxns[i])
+	}
+	publisher.PublishBlock(genesisBlock(t))
+	for i := uint32(0); i < 2; i++ {
+		if n, err := subscriber.Next(ctx); err != nil || n.Sequence != i || n.Missed != 0 {
+			t.Fatalf("Expected the notification %d, but got %+v (%v)", i, n, err)
+		}
+	}
+
+	publisher.PublishTx(rawTxns[5])
+	n, err := subscriber.Next(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.Sequence != 5 || n.Missed != 3 || subscriber.Missed(TopicRawTx) != 3 || subscriber.Missed(TopicRawBlock) != 0 {
+		t.Errorf("Expected three missed notifications, but got %+v", n)
+	}
+
+	receiver := frameReceiver{
+		message(TopicRawTx, rawTxns[0], 0xfffffffe),
+		message(TopicRawTx, rawTxns[0], 1),
+		message(TopicRawTx, rawTxns[0], 2),
+		message(TopicRawTx, rawTxns[0], 0),
+		message(TopicRawTx, rawTxns[0], 1000),
+		message(TopicRawTx, rawTxns[0], 3),
+		message(TopicRawTx, rawTxns[0], 4),
+		message(TopicRawTx, rawTxns[0], 4),
+		message(TopicRawTx, rawTxns[0], 5),
+	}
+	subscriber = NewSubscriber(&receiver)
+	// the sequence number wraps around, while backwards and large jumps are
+	// restarts, like a restart with the sequence number 0 lost and a
+	// duplicated notification
+	expectedNotifications := []Notification{{Sequence: 0xfffffffe}, {Sequence: 1, Missed: 2}, {Sequence: 2}, {Sequence: 0, Restarted: true},
+		{Sequence: 1000, Missed: 999}, {Sequence: 3, Restarted: true}, {Sequence: 4}, {Sequence: 4, Restarted: true}, {Sequence: 5}}
+	for i, expected := range expectedNotifications {
+		n, err := subscriber.Next(ctx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n.Sequence != expected.Sequence || n.Missed != expected.Missed || n.Restarted != expected.Restarted {
+			t.Errorf("Expected the notification %d to be %+v, but got %+v", i, expected, n)
+		}
+	}
+	if missed := subscriber.Missed(TopicRawTx); missed != 1001 {
+		t.Errorf("Expected 1001 missed notifications, but got %d", missed)
+	}
+}
+
+func TestSubscriberDecodeErrors(t *testing.T) {
+	rawTxns := testRawTxns(t)
+	receiver := frameReceiver{
+		message(TopicRawTx, []byte{0x01}, 0),
+		{[]byte(TopicRawTx), rawTxns[0]},
+		message(TopicRawBlock, rawTxns[0], 0)[:2],
+		append(message(TopicRawBlock, rawTxns[0], 0)[:2], []byte{0x00}),
+		message(TopicRawTx, rawTxns[0], 1),
+	}
+	subscriber := NewSubscriber(&receiver)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if _, err := subscriber.Next(ctx); err == nil {
+			t.Errorf("Expected an error for the invalid message %d", i)
+		} else if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("Expected a DecodeError for the invalid message %d, but got %v", i, err)
+		}
+	}
+	// the sequence number of the invalid transaction was tracked
+	if n, err := subscriber.Next(ctx); err != nil || n.Missed != 0 {
+		t.Errorf("Expected the valid transaction without missed notifications, but got %+v (%v)", n, err)
+	}
+}
+
+func TestStreamStats(t *testing.T) {
+	rawTxns := testRawTxns(t)
+	publisher := NewPublisher()
+	subscriber := NewSubscriber(publisher.Subscribe(10))
+
+	publisher.PublishTx(rawTxns[0])
+	publisher.PublishTx([]byte{0x01})
+	publisher.PublishBlock(genesisBlock(t))
+	publisher.Close()
+
+	aggregator := rawtx.NewStatsAggregator()
+	var blockTxns int
+	err := subscriber.StreamStats(context.Background(), true, func(stats *rawtx.TxStats, n *Notification) error {
+		aggregator.Add(stats)
+		if n.Block != nil {
+			blockTxns++
+		}
+		return nil
+	})
+	if err != ErrClosed {
+		t.Errorf("Expected ErrClosed, but got %v", err)
+	}
+	if aggregator.Transactions != 2 || aggregator.Coinbases != 1 || blockTxns != 1 {
+		t.Errorf("Expected the stats of a transaction and the genesis coinbase, but got %+v", aggregator)
+	}
+}
+
+func TestSource(t *testing.T) {
+	rawTxns := testRawTxns(t)
+	publisher := NewPublisher()
+	subscriber := NewSubscriber(publisher.Subscribe(3))
+
+	for _, rawTx := range rawTxns[:5] {
+		publisher.PublishTx(rawTx)
+	}
+
+	var gaps []uint32
+	onGap := func(topic string, missed uint32) {
+		gaps = append(gaps, missed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var received int
+	sink := rawtx.SinkFunc(func(r *rawtx.Result) error {
+		received++
+		if received == 3 {
+			publisher.PublishTx(rawTxns[5])
+		} else if received == 4 {
+			cancel()
+		}
+		return nil
+	})
+
+	err := rawtx.RunPipeline(ctx, subscriber.Source(onGap), rawtx.PipelineConfig{Workers: 2, Ordered: true}, sink)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+	if received != 4 || len(gaps) != 1 || gaps[0] != 2 {
+		t.Errorf("Expected four transactions with a gap of two, but got %d and gaps %v", received, gaps)
+	}
+}